@@ -3,9 +3,18 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/prometheus/common/model"
+
+	"github.com/slok/ecs-exporter/collector"
 	"github.com/slok/ecs-exporter/log"
 )
 
@@ -13,11 +22,44 @@ const (
 	defaultListenAddress    = ":9222"
 	defaultAwsRegion        = ""
 	defaultMetricsPath      = "/metrics"
-	defaultClusterFilter    = ".*"
+	defaultClusterFilter    = ""
 	defaultDebug            = false
 	defaultDisableCIMetrics = false
+	defaultStaleGracePeriod = 0
+	defaultEnableProbe      = false
+	defaultEnableDebugState = false
+	defaultMaxRequests      = 0
+	defaultMaxServices      = 0
+	defaultRelabelConfig    = ""
+	defaultMaxSeries        = 0
+	defaultNamespace        = collector.DefaultNamespace
+	defaultARNLabels        = false
+	defaultARNInfo          = false
+	defaultEC2Info          = false
+	defaultCloudWatchPeriod = collector.DefaultCloudWatchPeriod
+	defaultCloudWatchDelay  = collector.DefaultCloudWatchDelay
+	defaultAutoScalingTag   = ""
+	defaultWebConfig        = ""
+	defaultShutdownTimeout  = 30 * time.Second
+	defaultPushURL          = ""
+	defaultPushJob          = "ecs_exporter"
+	defaultPushInterval     = time.Minute
+	defaultPushRetries      = 3
+	defaultPushBackoff      = 5 * time.Second
+	defaultGraphiteAddress  = ""
+	defaultGraphitePrefix   = ""
+	defaultGraphiteInterval = time.Minute
+	defaultGraphiteTimeout  = 15 * time.Second
+	defaultGraphiteOnError  = graphiteContinueOnError
+	defaultLogLevel         = "info"
+	defaultLogFormat        = "logfmt"
 )
 
+// collectorNotes are added to the help of the collector flags
+var collectorNotes = map[string]string{
+	"images": ". Only the ECR images of the exporter region get the age, the images of other regions and of other accounts without a repository policy for the exporter don't",
+}
+
 // Cfg is the global configuration
 var cfg *config
 
@@ -30,12 +72,204 @@ func parse(args []string) error {
 type config struct {
 	fs *flag.FlagSet
 
+	filters
+
 	listenAddress    string
-	awsRegion        string
 	metricsPath      string
-	clusterFilter    string
+	maxServices      int
+	relabelConfig    string
+	maxSeries        int
+	metricsNamespace string
+	constLabels      map[string]string
+	rawConstLabels   []string
+	arnLabels        bool
+	arnInfo          bool
+	ec2Info          bool
 	debug            bool
 	disableCIMetrics bool
+	staleGracePeriod time.Duration
+	cloudWatchPeriod time.Duration
+	cloudWatchDelay  time.Duration
+	autoScalingTag   string
+	collectors       map[string]bool
+	enableProbe      bool
+	probeRoles       []string
+	probeRolesRE     []*regexp.Regexp
+	enableDebugState bool
+	maxRequests      int
+	webConfig        string
+	shutdownTimeout  time.Duration
+	pushURL          string
+	pushJob          string
+	pushInterval     time.Duration
+	pushRetries      int
+	pushBackoff      time.Duration
+	graphiteAddress  string
+	graphitePrefix   string
+	graphiteInterval time.Duration
+	graphiteTimeout  time.Duration
+	graphiteOnError  string
+	logLevel         log.Level
+	logFormat        log.Format
+	rawLogLevel      string
+	rawLogFormat     string
+}
+
+// collectorFlag is a boolean flag that enables or disables a collector, used to
+// create the --collector.<name> and --no-collector.<name> flag pairs
+type collectorFlag struct {
+	name       string
+	enable     bool
+	collectors map[string]bool
+}
+
+// String implements flag.Value
+func (f *collectorFlag) String() string {
+	if f.collectors == nil {
+		return ""
+	}
+	return strconv.FormatBool(f.collectors[f.name] == f.enable)
+}
+
+// Set implements flag.Value
+func (f *collectorFlag) Set(value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	f.collectors[f.name] = b == f.enable
+	return nil
+}
+
+// IsBoolFlag implements the flag package boolFlag interface
+func (f *collectorFlag) IsBoolFlag() bool {
+	return true
+}
+
+// stringsFlag is a flag that can be repeated, if split is set every value can have
+// multiple comma separated items
+type stringsFlag struct {
+	values *[]string
+	split  bool
+}
+
+// String implements flag.Value
+func (f *stringsFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+// Set implements flag.Value
+func (f *stringsFlag) Set(value string) error {
+	items := []string{value}
+	if f.split {
+		items = strings.Split(value, ",")
+	}
+	for _, i := range items {
+		if i = strings.TrimSpace(i); i != "" {
+			*f.values = append(*f.values, i)
+		}
+	}
+	return nil
+}
+
+// filters are the region and the cluster and service filters, shared by the exporter and the inventory
+type filters struct {
+	awsRegion      string
+	clusterFilter  string
+	clusterInclude []string
+	clusterExclude []string
+	clusterNames   []string
+	clusterExNames []string
+	serviceInclude []string
+	serviceExclude []string
+}
+
+// register adds the filter flags to the flag set
+func (f *filters) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&f.awsRegion, "aws.region", defaultAwsRegion, "The AWS region to get metrics from")
+
+	fs.StringVar(
+		&f.clusterFilter, "aws.cluster-filter", defaultClusterFilter, "Regex used to filter the cluster names, if doesn't match the cluster is ignored (same as --aws.cluster-include)")
+
+	fs.Var(
+		&stringsFlag{values: &f.clusterInclude}, "aws.cluster-include", "Regex of the clusters to include, can be repeated. If it starts with 'arn:' or '^arn:' it's matched against the cluster ARN, otherwise against the name")
+
+	fs.Var(
+		&stringsFlag{values: &f.clusterExclude}, "aws.cluster-exclude", "Regex of the clusters to exclude, can be repeated and has priority over the inclusions. If it starts with 'arn:' or '^arn:' it's matched against the cluster ARN, otherwise against the name")
+
+	fs.Var(
+		&stringsFlag{values: &f.clusterNames, split: true}, "aws.cluster-include-names", "Comma separated names or ARNs of the clusters to include, can be repeated")
+
+	fs.Var(
+		&stringsFlag{values: &f.clusterExNames, split: true}, "aws.cluster-exclude-names", "Comma separated names or ARNs of the clusters to exclude, can be repeated and has priority over the inclusions")
+
+	fs.Var(
+		&stringsFlag{values: &f.serviceInclude}, "aws.service-include", "Regex of the service names to include, can be repeated")
+
+	fs.Var(
+		&stringsFlag{values: &f.serviceExclude}, "aws.service-exclude", "Regex of the service names to exclude, can be repeated and has priority over the inclusions")
+}
+
+// validate checks the region is set and the filters are valid regular expresions
+func (f *filters) validate() error {
+	if f.awsRegion == "" {
+		return fmt.Errorf("An aws region is required")
+	}
+
+	for _, p := range append(append([]string{f.clusterFilter}, f.clusterInclude...), f.clusterExclude...) {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("Invalid cluster filtering regex: %s", p)
+		}
+	}
+
+	for _, p := range append(append([]string{}, f.serviceInclude...), f.serviceExclude...) {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("Invalid service filtering regex: %s", p)
+		}
+	}
+	return nil
+}
+
+// clusters returns the cluster filter of the collector
+func (f *filters) clusters() collector.ClusterFilter {
+	return collector.ClusterFilter{
+		Include:      f.clusterInclude,
+		Exclude:      f.clusterExclude,
+		IncludeNames: f.clusterNames,
+		ExcludeNames: f.clusterExNames,
+	}
+}
+
+// services returns the service filter of the collector
+func (f *filters) services() collector.ServiceFilter {
+	return collector.ServiceFilter{
+		Include: f.serviceInclude,
+		Exclude: f.serviceExclude,
+	}
+}
+
+// parseConstLabels parses the key=value constant labels
+func parseConstLabels(raw []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, l := range raw {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid constant label, must be in key=value form: %s", l)
+		}
+		name := model.LabelName(kv[0])
+		if !name.IsValid() || strings.HasPrefix(kv[0], model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("Invalid constant label name: %s", kv[0])
+		}
+		if _, ok := labels[kv[0]]; ok {
+			return nil, fmt.Errorf("Duplicated constant label: %s", kv[0])
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
 }
 
 // init will load all the flags
@@ -46,26 +280,130 @@ func init() {
 // New returns an initialized config
 func new() *config {
 	c := &config{
-		fs: flag.NewFlagSet(os.Args[0], flag.ContinueOnError),
+		fs:         flag.NewFlagSet(os.Args[0], flag.ContinueOnError),
+		collectors: collector.Collectors(),
 	}
 
 	c.fs.StringVar(
 		&c.listenAddress, "web.listen-address", defaultListenAddress, "Address to listen on")
 
+	c.filters.register(c.fs)
+
 	c.fs.StringVar(
-		&c.awsRegion, "aws.region", defaultAwsRegion, "The AWS region to get metrics from")
+		&c.metricsPath, "web.telemetry-path", defaultMetricsPath, "The path where metrics will be exposed")
+
+	c.fs.IntVar(
+		&c.maxRequests, "web.max-requests", defaultMaxRequests, "Maximum number of parallel scrape requests, 0 means no limit")
 
 	c.fs.StringVar(
-		&c.clusterFilter, "aws.cluster-filter", defaultClusterFilter, "Regex used to filter the cluster names, if doesn't match the cluster is ignored")
+		&c.webConfig, "web.config", defaultWebConfig, "Path to the web configuration file with the TLS and basic auth settings, reloaded on change")
+
+	c.fs.DurationVar(
+		&c.shutdownTimeout, "web.shutdown-timeout", defaultShutdownTimeout, "The time the in-flight requests have to finish on shutdown before they are cancelled")
+
+	c.fs.BoolVar(
+		&c.enableProbe, "web.enable-probe", defaultEnableProbe, "Enable the /probe endpoint to export the metrics of any region, cluster and role on demand")
+
+	c.fs.Var(
+		&stringsFlag{values: &c.probeRoles}, "web.probe-allowed-role", "Regex of the role ARNs the /probe endpoint can assume, can be repeated. If missing any role can be probed")
+
+	c.fs.BoolVar(
+		&c.enableDebugState, "web.enable-debug-state", defaultEnableDebugState, "Enable the /debug/state endpoint with the data gathered from AWS on the last scrape")
+
+	c.fs.BoolVar(
+		&c.debug, "debug", defaultDebug, "Run exporter in debug mode (deprecated, use --log.level=debug)")
 
 	c.fs.StringVar(
-		&c.metricsPath, "web.telemetry-path", defaultMetricsPath, "The path where metrics will be exposed")
+		&c.pushURL, "push.url", defaultPushURL, "URL of the Pushgateway where the metrics are pushed on an interval, empty disables pushing")
+
+	c.fs.StringVar(
+		&c.pushJob, "push.job", defaultPushJob, "The job of the metrics pushed to the Pushgateway")
+
+	c.fs.DurationVar(
+		&c.pushInterval, "push.interval", defaultPushInterval, "The interval between the pushes to the Pushgateway")
+
+	c.fs.IntVar(
+		&c.pushRetries, "push.retries", defaultPushRetries, "The number of retries of a failed push to the Pushgateway")
+
+	c.fs.DurationVar(
+		&c.pushBackoff, "push.retry-backoff", defaultPushBackoff, "The time waited before retrying a failed push to the Pushgateway")
+
+	c.fs.StringVar(
+		&c.graphiteAddress, "graphite.address", defaultGraphiteAddress, "Address (host:port) of the Graphite server where the metrics are pushed on an interval, empty disables pushing")
+
+	c.fs.StringVar(
+		&c.graphitePrefix, "graphite.prefix", defaultGraphitePrefix, "The prefix of the metrics pushed to Graphite, the invalid characters (including dots) are replaced with underscores")
+
+	c.fs.DurationVar(
+		&c.graphiteInterval, "graphite.interval", defaultGraphiteInterval, "The interval between the pushes to Graphite")
+
+	c.fs.DurationVar(
+		&c.graphiteTimeout, "graphite.timeout", defaultGraphiteTimeout, "The timeout of the connection to Graphite")
+
+	c.fs.StringVar(
+		&c.graphiteOnError, "graphite.on-error", defaultGraphiteOnError, "What to do when gathering the metrics pushed to Graphite fails, one of: continue (push the gathered metrics), abort (skip the push)")
+
+	c.fs.StringVar(
+		&c.rawLogLevel, "log.level", defaultLogLevel, "The log level, one of: debug, info, warn, error")
+
+	c.fs.StringVar(
+		&c.rawLogFormat, "log.format", defaultLogFormat, "The log format, one of: logfmt, json")
 
 	c.fs.BoolVar(
-		&c.debug, "debug", defaultDebug, "Run exporter in debug mode")
+		&c.disableCIMetrics, "metrics.disable-cinstances", defaultDisableCIMetrics, "Disable clusters container instances metrics gathering (deprecated, use --no-collector.containerinstances)")
+
+	c.fs.IntVar(
+		&c.maxServices, "metrics.max-services-per-cluster", defaultMaxServices, "Maximum number of services exported per cluster, 0 means no limit")
+
+	c.fs.StringVar(
+		&c.relabelConfig, "metrics.relabel-config", defaultRelabelConfig, "Path to the file with the relabeling rules applied to every exposed series")
+
+	c.fs.IntVar(
+		&c.maxSeries, "metrics.max-series-per-family", defaultMaxSeries, "Maximum number of series exposed per metric family, 0 means no limit")
+
+	c.fs.StringVar(
+		&c.metricsNamespace, "metrics.namespace", defaultNamespace, "The namespace (prefix) of the exported ECS metrics")
+
+	c.fs.Var(
+		&stringsFlag{values: &c.rawConstLabels}, "metrics.const-label", "Label added to every exported ECS metric in key=value form, can be repeated")
+
+	c.fs.BoolVar(
+		&c.arnLabels, "metrics.arn-labels", defaultARNLabels, "Add the cluster_arn, service_arn and container_instance_arn labels to the ECS metrics")
 
 	c.fs.BoolVar(
-		&c.disableCIMetrics, "metrics.disable-cinstances", defaultDisableCIMetrics, "Disable clusters container instances metrics gathering")
+		&c.arnInfo, "metrics.arn-info", defaultARNInfo, "Export the ecs_cluster_info, ecs_service_info and ecs_container_instance_info metrics with the ARNs")
+
+	c.fs.BoolVar(
+		&c.ec2Info, "metrics.ec2-info", defaultEC2Info, "Describe the EC2 instances of the container instances to export their type, availability zone, lifecycle, launch time and private IP")
+
+	c.fs.DurationVar(
+		&c.staleGracePeriod, "metrics.stale-grace-period", defaultStaleGracePeriod, "The time the last good metrics of a cluster will be exported when gathering its data fails, 0 disables it")
+
+	c.fs.DurationVar(
+		&c.cloudWatchPeriod, "cloudwatch.period", defaultCloudWatchPeriod, "The period of the CloudWatch metrics of the cloudwatch collector, a multiple of a minute")
+
+	c.fs.DurationVar(
+		&c.cloudWatchDelay, "cloudwatch.delay", defaultCloudWatchDelay, "How old is the end of the CloudWatch metrics period of the cloudwatch collector, CloudWatch needs some time to have the data")
+
+	c.fs.StringVar(
+		&c.autoScalingTag, "autoscaling.cluster-tag", defaultAutoScalingTag, "The tag of the Auto Scaling groups whose value is the cluster name, the autoscaling collector finds the groups by the tag instead of by the container instances. Without it the groups whose instances never registered on the cluster are not found")
+
+	// Collector flag pairs
+	names := []string{}
+	for name := range c.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		state := "disabled"
+		if c.collectors[name] {
+			state = "enabled"
+		}
+		c.fs.Var(
+			&collectorFlag{name: name, enable: true, collectors: c.collectors}, "collector."+name, fmt.Sprintf("Enable the %s collector (default: %s)%s", name, state, collectorNotes[name]))
+		c.fs.Var(
+			&collectorFlag{name: name, enable: false, collectors: c.collectors}, "no-collector."+name, fmt.Sprintf("Disable the %s collector", name))
+	}
 
 	return c
 }
@@ -82,17 +420,127 @@ func (c *config) parse(args []string) error {
 		return fmt.Errorf("Invalid command line arguments. Help: %s -h", os.Args[0])
 	}
 
-	if c.awsRegion == "" {
-		return fmt.Errorf("An aws region is required")
+	if err := c.filters.validate(); err != nil {
+		return err
 	}
 
-	if _, err := regexp.Compile(c.clusterFilter); err != nil {
-		return fmt.Errorf("Invalid cluster filtering regex: %s", c.clusterFilter)
+	if c.maxServices < 0 {
+		return fmt.Errorf("Invalid maximum number of services per cluster: %d", c.maxServices)
+	}
+
+	if c.maxSeries < 0 {
+		return fmt.Errorf("Invalid maximum number of series per metric family: %d", c.maxSeries)
+	}
+
+	if !model.MetricNameRE.MatchString(c.metricsNamespace) {
+		return fmt.Errorf("Invalid metrics namespace: %s", c.metricsNamespace)
+	}
+
+	constLabels, err := parseConstLabels(c.rawConstLabels)
+	if err != nil {
+		return err
+	}
+	c.constLabels = constLabels
+
+	if c.staleGracePeriod < 0 {
+		return fmt.Errorf("Invalid stale grace period: %s", c.staleGracePeriod)
+	}
+
+	if c.cloudWatchPeriod < time.Minute || c.cloudWatchPeriod%time.Minute != 0 {
+		return fmt.Errorf("Invalid CloudWatch period, it must be a multiple of a minute: %s", c.cloudWatchPeriod)
+	}
+
+	if c.cloudWatchDelay <= 0 {
+		return fmt.Errorf("Invalid CloudWatch delay: %s", c.cloudWatchDelay)
+	}
+
+	if c.maxRequests < 0 {
+		return fmt.Errorf("Invalid maximum number of parallel scrape requests: %d", c.maxRequests)
+	}
+
+	c.probeRolesRE = []*regexp.Regexp{}
+	for _, r := range c.probeRoles {
+		re, err := regexp.Compile("^(?:" + r + ")$")
+		if err != nil {
+			return fmt.Errorf("Invalid probe role regex: %s", r)
+		}
+		c.probeRolesRE = append(c.probeRolesRE, re)
+	}
+
+	if c.pushURL != "" {
+		if _, err := url.Parse(c.pushURL); err != nil {
+			return fmt.Errorf("Invalid push URL: %s", c.pushURL)
+		}
+		if _, ok := c.constLabels[pushGroupingLabel]; ok {
+			return fmt.Errorf("The %s constant label can't be used when pushing, it's the push grouping label", pushGroupingLabel)
+		}
+		if c.pushJob == "" || strings.Contains(c.pushJob, "/") {
+			return fmt.Errorf("Invalid push job: %s", c.pushJob)
+		}
+		if c.pushInterval <= 0 {
+			return fmt.Errorf("Invalid push interval: %s", c.pushInterval)
+		}
+		if c.pushRetries < 0 {
+			return fmt.Errorf("Invalid number of push retries: %d", c.pushRetries)
+		}
+		if c.pushBackoff < 0 {
+			return fmt.Errorf("Invalid push retry backoff: %s", c.pushBackoff)
+		}
+	}
+
+	if c.graphiteAddress != "" {
+		if _, _, err := net.SplitHostPort(c.graphiteAddress); err != nil {
+			return fmt.Errorf("Invalid Graphite address: %s", c.graphiteAddress)
+		}
+		if c.graphiteInterval <= 0 {
+			return fmt.Errorf("Invalid Graphite interval: %s", c.graphiteInterval)
+		}
+		if c.graphiteTimeout <= 0 {
+			return fmt.Errorf("Invalid Graphite timeout: %s", c.graphiteTimeout)
+		}
+		if c.graphiteOnError != graphiteContinueOnError && c.graphiteOnError != graphiteAbortOnError {
+			return fmt.Errorf("Invalid Graphite error handling: %s", c.graphiteOnError)
+		}
+	}
+
+	if c.shutdownTimeout < 0 {
+		return fmt.Errorf("Invalid shutdown timeout: %s", c.shutdownTimeout)
+	}
+
+	level, err := log.ParseLevel(c.rawLogLevel)
+	if err != nil {
+		return fmt.Errorf("Invalid log level: %s", c.rawLogLevel)
+	}
+	c.logLevel = level
+	if c.debug {
+		log.Warnf("--debug is deprecated, use --log.level=debug")
+		c.logLevel = log.DebugLevel
+	}
+
+	format, err := log.ParseFormat(c.rawLogFormat)
+	if err != nil {
+		return fmt.Errorf("Invalid log format: %s", c.rawLogFormat)
+	}
+	c.logFormat = format
+
+	if c.disableCIMetrics {
+		log.Warnf("--metrics.disable-cinstances is deprecated, use --no-collector.containerinstances")
+		c.collectors["containerinstances"] = false
 	}
 
 	if c.clusterFilter != defaultClusterFilter {
 		log.Warnf("Filtering cluster metrics by: %s", c.clusterFilter)
 	}
+	if len(c.clusterInclude) > 0 || len(c.clusterNames) > 0 {
+		log.Warnf("Including only clusters matching: %s", strings.Join(append(c.clusterInclude, c.clusterNames...), ", "))
+	}
+	if len(c.clusterExclude) > 0 || len(c.clusterExNames) > 0 {
+		log.Warnf("Excluding clusters matching: %s", strings.Join(append(c.clusterExclude, c.clusterExNames...), ", "))
+	}
+
+	if c.collectors["autoscaling"] && c.autoScalingTag == "" {
+		log.Warnf("The autoscaling collector finds the Auto Scaling groups by the container instances, the groups without registered instances are not exported, set --autoscaling.cluster-tag to find them by tag")
+	}
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -14,8 +15,64 @@ func TestConfigParse(t *testing.T) {
 		{true, []string{"--aws.region", "eu-west-1", "--web.listen-address", "0.0.0.0:9999"}},
 		{true, []string{"--aws.region", "eu-west-1"}},
 		{true, []string{"--aws.region", "eu-west-1", "--debug"}},
+		{true, []string{"--aws.region", "eu-west-1", "--web.enable-probe"}},
+		{true, []string{"--aws.region", "eu-west-1", "--web.enable-probe", "--web.probe-allowed-role", "arn:aws:iam::123456789012:role/ecs-.*"}},
+		{false, []string{"--aws.region", "eu-west-1", "--web.enable-probe", "--web.probe-allowed-role", "["}},
+		{true, []string{"--aws.region", "eu-west-1", "--web.enable-debug-state"}},
+		{true, []string{"--aws.region", "eu-west-1", "--web.max-requests", "5"}},
+		{false, []string{"--aws.region", "eu-west-1", "--web.max-requests", "-1"}},
+		{true, []string{"--aws.region", "eu-west-1", "--web.config", "web.yml"}},
+		{true, []string{"--aws.region", "eu-west-1", "--web.shutdown-timeout", "10s"}},
+		{true, []string{"--aws.region", "eu-west-1", "--log.level", "warn", "--log.format", "json"}},
+		{false, []string{"--aws.region", "eu-west-1", "--log.level", "trace"}},
+		{false, []string{"--aws.region", "eu-west-1", "--log.format", "xml"}},
+		{false, []string{"--aws.region", "eu-west-1", "--web.shutdown-timeout", "-1s"}},
 		{true, []string{"--aws.region", "eu-west-1", "--aws.cluster-filter", ".*-prod-.*"}},
 		{false, []string{"--aws.region", "eu-west-1", "--aws.cluster-filter", "["}},
+		{true, []string{"--aws.region", "eu-west-1", "--aws.cluster-include", "^prod-", "--aws.cluster-include", "^staging-", "--aws.cluster-exclude", "-sandbox-"}},
+		{true, []string{"--aws.region", "eu-west-1", "--aws.cluster-include-names", "c1,c2", "--aws.cluster-exclude-names", "arn:aws:ecs:eu-west-1:111111111111:cluster/legacy"}},
+		{false, []string{"--aws.region", "eu-west-1", "--aws.cluster-include", "["}},
+		{false, []string{"--aws.region", "eu-west-1", "--aws.cluster-exclude", "["}},
+		{true, []string{"--aws.region", "eu-west-1", "--aws.service-include", "-prod$", "--aws.service-exclude", "canary"}},
+		{false, []string{"--aws.region", "eu-west-1", "--aws.service-include", "["}},
+		{true, []string{"--aws.region", "eu-west-1", "--metrics.max-services-per-cluster", "100"}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.max-services-per-cluster", "-1"}},
+		{true, []string{"--aws.region", "eu-west-1", "--metrics.relabel-config", "relabel.yml", "--metrics.max-series-per-family", "1000"}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.max-series-per-family", "-1"}},
+		{true, []string{"--aws.region", "eu-west-1", "--metrics.namespace", "aws_ecs", "--metrics.const-label", "environment=prod", "--metrics.const-label", "team=infra"}},
+		{true, []string{"--aws.region", "eu-west-1", "--metrics.const-label", "environment="}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.namespace", "aws-ecs"}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.namespace", ""}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.const-label", "environment"}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.const-label", "environment-name=prod"}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.const-label", "__environment=prod"}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.const-label", "environment=prod", "--metrics.const-label", "environment=dev"}},
+		{true, []string{"--aws.region", "eu-west-1", "--metrics.arn-labels", "--metrics.arn-info"}},
+		{true, []string{"--aws.region", "eu-west-1", "--metrics.ec2-info"}},
+		{true, []string{"--aws.region", "eu-west-1", "--metrics.stale-grace-period", "5m"}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.stale-grace-period", "-5m"}},
+		{false, []string{"--aws.region", "eu-west-1", "--metrics.stale-grace-period", "5"}},
+		{true, []string{"--aws.region", "eu-west-1", "--push.url", "http://pushgateway:9091", "--push.job", "ecs", "--push.interval", "30s", "--push.retries", "5", "--push.retry-backoff", "1s"}},
+		{false, []string{"--aws.region", "eu-west-1", "--push.url", "http://pushgateway:9091", "--push.job", "ecs/exporter"}},
+		{false, []string{"--aws.region", "eu-west-1", "--push.url", "http://pushgateway:9091", "--push.interval", "0s"}},
+		{false, []string{"--aws.region", "eu-west-1", "--push.url", "http://pushgateway:9091", "--push.retries", "-1"}},
+		{false, []string{"--aws.region", "eu-west-1", "--push.url", "%zz"}},
+		{false, []string{"--aws.region", "eu-west-1", "--push.url", "http://pushgateway:9091", "--metrics.const-label", "aws_region=eu-west-1"}},
+		{true, []string{"--aws.region", "eu-west-1", "--metrics.const-label", "aws_region=eu-west-1"}},
+		{true, []string{"--aws.region", "eu-west-1", "--graphite.address", "graphite:2003", "--graphite.prefix", "ecs_exporter", "--graphite.interval", "30s", "--graphite.timeout", "5s", "--graphite.on-error", "abort"}},
+		{false, []string{"--aws.region", "eu-west-1", "--graphite.address", "graphite"}},
+		{false, []string{"--aws.region", "eu-west-1", "--graphite.address", "graphite:2003", "--graphite.interval", "0s"}},
+		{false, []string{"--aws.region", "eu-west-1", "--graphite.address", "graphite:2003", "--graphite.timeout", "-1s"}},
+		{false, []string{"--aws.region", "eu-west-1", "--graphite.address", "graphite:2003", "--graphite.on-error", "ignore"}},
+		{true, []string{"--aws.region", "eu-west-1", "--collector.cloudwatch", "--cloudwatch.period", "5m", "--cloudwatch.delay", "3m"}},
+		{false, []string{"--aws.region", "eu-west-1", "--cloudwatch.period", "30s"}},
+		{false, []string{"--aws.region", "eu-west-1", "--cloudwatch.period", "90s"}},
+		{false, []string{"--aws.region", "eu-west-1", "--cloudwatch.delay", "0s"}},
+		{true, []string{"--aws.region", "eu-west-1", "--collector.autoscaling", "--autoscaling.cluster-tag", "ecs-cluster"}},
+		{true, []string{"--aws.region", "eu-west-1", "--no-collector.containerinstances", "--collector.services"}},
+		{true, []string{"--aws.region", "eu-west-1", "--collector.clusters=false"}},
+		{false, []string{"--aws.region", "eu-west-1", "--collector.wrong"}},
+		{false, []string{"--aws.region", "eu-west-1", "--no-collector.services=wrong"}},
 		{false, []string{"--web.listen-address", "0.0.0.0:9999", "--web.telemetry-path", "/metrics2"}},
 
 		{false, []string{}},
@@ -34,3 +91,114 @@ func TestConfigParse(t *testing.T) {
 		}
 	}
 }
+
+func TestConfigCollectors(t *testing.T) {
+	tests := []struct {
+		cmd  []string
+		want map[string]bool
+	}{
+		{
+			[]string{"--aws.region", "eu-west-1"},
+			map[string]bool{"autoscaling": false, "cloudwatch": false, "images": false, "servicescaling": false, "states": false, "targethealth": false, "clusters": true, "services": true, "containerinstances": true},
+		},
+		{
+			[]string{"--aws.region", "eu-west-1", "--no-collector.containerinstances"},
+			map[string]bool{"autoscaling": false, "cloudwatch": false, "images": false, "servicescaling": false, "states": false, "targethealth": false, "clusters": true, "services": true, "containerinstances": false},
+		},
+		{
+			[]string{"--aws.region", "eu-west-1", "--metrics.disable-cinstances"},
+			map[string]bool{"autoscaling": false, "cloudwatch": false, "images": false, "servicescaling": false, "states": false, "targethealth": false, "clusters": true, "services": true, "containerinstances": false},
+		},
+		{
+			[]string{"--aws.region", "eu-west-1", "--no-collector.services", "--collector.services"},
+			map[string]bool{"autoscaling": false, "cloudwatch": false, "images": false, "servicescaling": false, "states": false, "targethealth": false, "clusters": true, "services": true, "containerinstances": true},
+		},
+		{
+			[]string{"--aws.region", "eu-west-1", "--collector.clusters=false", "--no-collector.services=true"},
+			map[string]bool{"autoscaling": false, "cloudwatch": false, "images": false, "servicescaling": false, "states": false, "targethealth": false, "clusters": false, "services": false, "containerinstances": true},
+		},
+		{
+			[]string{"--aws.region", "eu-west-1", "--collector.autoscaling"},
+			map[string]bool{"autoscaling": true, "cloudwatch": false, "images": false, "servicescaling": false, "states": false, "targethealth": false, "clusters": true, "services": true, "containerinstances": true},
+		},
+	}
+
+	for _, test := range tests {
+		c := new()
+		if err := c.parse(test.cmd); err != nil {
+			t.Errorf("\n- %v\n- Cmd parsing shoudn't fail, it did: %v", test, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(c.collectors, test.want) {
+			t.Errorf("\n- %v\n- Collectors are wrong, want: %v; got: %v", test, test.want, c.collectors)
+		}
+	}
+}
+
+func TestConfigClusterFilters(t *testing.T) {
+	tests := []struct {
+		cmd              []string
+		wantInclude      []string
+		wantIncludeNames []string
+	}{
+		{
+			[]string{"--aws.region", "eu-west-1"},
+			nil,
+			nil,
+		},
+		{
+			[]string{"--aws.region", "eu-west-1", "--aws.cluster-include", "^prod-{1,2}", "--aws.cluster-include", "^staging-"},
+			[]string{"^prod-{1,2}", "^staging-"},
+			nil,
+		},
+		{
+			[]string{"--aws.region", "eu-west-1", "--aws.cluster-include-names", "c1, c2,", "--aws.cluster-include-names", "c3"},
+			nil,
+			[]string{"c1", "c2", "c3"},
+		},
+	}
+
+	for _, test := range tests {
+		c := new()
+		if err := c.parse(test.cmd); err != nil {
+			t.Errorf("\n- %v\n- Cmd parsing shoudn't fail, it did: %v", test, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(c.clusterInclude, test.wantInclude) {
+			t.Errorf("\n- %v\n- Cluster inclusions are wrong, want: %v; got: %v", test, test.wantInclude, c.clusterInclude)
+		}
+		if !reflect.DeepEqual(c.clusterNames, test.wantIncludeNames) {
+			t.Errorf("\n- %v\n- Cluster name inclusions are wrong, want: %v; got: %v", test, test.wantIncludeNames, c.clusterNames)
+		}
+	}
+}
+
+func TestConfigConstLabels(t *testing.T) {
+	tests := []struct {
+		cmd  []string
+		want map[string]string
+	}{
+		{
+			[]string{"--aws.region", "eu-west-1"},
+			map[string]string{},
+		},
+		{
+			[]string{"--aws.region", "eu-west-1", "--metrics.const-label", "environment=prod", "--metrics.const-label", "url=http://a.b/?c=d"},
+			map[string]string{"environment": "prod", "url": "http://a.b/?c=d"},
+		},
+	}
+
+	for _, test := range tests {
+		c := new()
+		if err := c.parse(test.cmd); err != nil {
+			t.Errorf("\n- %v\n- Cmd parsing shoudn't fail, it did: %v", test, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(c.constLabels, test.want) {
+			t.Errorf("\n- %v\n- Constant labels are wrong, want: %v; got: %v", test, test.want, c.constLabels)
+		}
+	}
+}
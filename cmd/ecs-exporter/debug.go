@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/slok/ecs-exporter/collector"
+)
+
+const debugStatePath = "/debug/state"
+
+// stateProvider has the data gathered on the last scrape
+type stateProvider interface {
+	State() *collector.State
+}
+
+// debugState is the debug state response
+type debugState struct {
+	Regions map[string]*collector.State `json:"regions"` // The last scrape data by region
+}
+
+// debugStateHandler returns the data gathered from AWS on the last scrape of the exporters as JSON
+func debugStateHandler(providers ...stateProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := debugState{Regions: map[string]*collector.State{}}
+		for _, p := range providers {
+			if st := p.State(); st != nil {
+				res.Regions[st.Region] = st
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(res)
+	})
+}
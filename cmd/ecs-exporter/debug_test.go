@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/slok/ecs-exporter/collector"
+)
+
+type testStateProvider struct {
+	state *collector.State
+}
+
+func (p testStateProvider) State() *collector.State {
+	return p.state
+}
+
+func TestDebugStateHandler(t *testing.T) {
+	tests := []struct {
+		providers       []stateProvider
+		expectedRegions []string
+	}{
+		{[]stateProvider{}, []string{}},
+		{[]stateProvider{testStateProvider{}}, []string{}},
+		{[]stateProvider{testStateProvider{&collector.State{Region: "eu-west-1"}}}, []string{"eu-west-1"}},
+		{[]stateProvider{testStateProvider{&collector.State{Region: "eu-west-1"}}, testStateProvider{&collector.State{Region: "us-east-1"}}}, []string{"eu-west-1", "us-east-1"}},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", debugStatePath, nil)
+		w := httptest.NewRecorder()
+		debugStateHandler(test.providers...).ServeHTTP(w, req)
+
+		got := debugState{}
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("\n- %v\n- State should be valid JSON: %v", test, err)
+		}
+		if len(got.Regions) != len(test.expectedRegions) {
+			t.Errorf("\n- %v\n- Regions are wrong, want: %d; got: %d", test, len(test.expectedRegions), len(got.Regions))
+		}
+		for _, r := range test.expectedRegions {
+			if _, ok := got.Regions[r]; !ok {
+				t.Errorf("\n- %v\n- Region %s should be present, it wasn't", test, r)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/graphite"
+)
+
+const (
+	graphiteContinueOnError = "continue"
+	graphiteAbortOnError    = "abort"
+)
+
+// newGraphiteBridge returns a bridge that pushes the metrics of a gatherer to a Graphite server on an interval,
+// onError sets if a push continues with the gathered metrics or is aborted when the gathering fails
+func newGraphiteBridge(address, prefix string, interval, timeout time.Duration, onError string, g prometheus.Gatherer) (*graphite.Bridge, error) {
+	var errorHandling graphite.HandlerErrorHandling
+	switch onError {
+	case graphiteContinueOnError:
+		errorHandling = graphite.ContinueOnError
+	case graphiteAbortOnError:
+		errorHandling = graphite.AbortOnError
+	default:
+		return nil, fmt.Errorf("Invalid Graphite error handling: %s", onError)
+	}
+
+	return graphite.NewBridge(&graphite.Config{
+		URL:           address,
+		Prefix:        prefix,
+		Interval:      interval,
+		Timeout:       timeout,
+		Gatherer:      g,
+		Logger:        promLogger{},
+		ErrorHandling: errorHandling,
+	})
+}
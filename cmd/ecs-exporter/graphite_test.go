@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// failingGatherer returns the metrics of a gatherer along with an error
+type failingGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g failingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, _ := g.Gatherer.Gather()
+	return mfs, errors.New("wanted")
+}
+
+func TestGraphiteBridgePush(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ecs_up", Help: "test"}, []string{"region"})
+	g.WithLabelValues("eu-west-1").Set(1)
+	reg.MustRegister(g)
+
+	tests := []struct {
+		onError     string
+		gatherer    prometheus.Gatherer
+		expectError bool
+		expected    string
+	}{
+		{"continue", reg, false, "ecs_exporter.ecs_up.region.eu_west_1 1 "},
+		{"continue", failingGatherer{reg}, false, "ecs_exporter.ecs_up.region.eu_west_1 1 "},
+		{"abort", reg, false, "ecs_exporter.ecs_up.region.eu_west_1 1 "},
+		{"abort", failingGatherer{reg}, true, ""},
+	}
+
+	for _, test := range tests {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := make(chan string, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				received <- ""
+				return
+			}
+			defer conn.Close()
+			b, _ := ioutil.ReadAll(conn)
+			received <- string(b)
+		}()
+
+		b, err := newGraphiteBridge(ln.Addr().String(), "ecs_exporter", time.Minute, time.Second, test.onError, test.gatherer)
+		if err != nil {
+			t.Fatalf("\n- %v\n- Creating the bridge shouldn't error: %v", test, err)
+		}
+
+		err = b.Push()
+		if test.expectError {
+			if err == nil {
+				t.Errorf("\n- %v\n- Push should error, it didn't", test)
+			}
+			ln.Close()
+			continue
+		}
+		if err != nil {
+			t.Errorf("\n- %v\n- Push shouldn't error: %v", test, err)
+		}
+
+		select {
+		case got := <-received:
+			if !strings.HasPrefix(got, test.expected) {
+				t.Errorf("\n- %v\n- Pushed metrics are wrong, want: %q; got: %q", test, test.expected, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("\n- %v\n- Metrics should be pushed, they weren't", test)
+		}
+		ln.Close()
+	}
+
+	if _, err := newGraphiteBridge("127.0.0.1:2003", "", time.Minute, time.Second, "ignore", reg); err == nil {
+		t.Errorf("Creating the bridge with invalid error handling should error, it didn't")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prometheus/common/version"
+
+	"github.com/slok/ecs-exporter/log"
+)
+
+const (
+	healthyPath = "/-/healthy"
+	readyPath   = "/-/ready"
+	versionPath = "/version"
+)
+
+// readyChecker knows if the exporter is ready to serve metrics
+type readyChecker interface {
+	Ready() error
+}
+
+// healthyHandler returns 200 while the exporter is running
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ECS exporter is healthy.\n"))
+}
+
+// readyHandler returns 200 when the exporter is ready to serve metrics, 503 otherwise
+func readyHandler(c readyChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.Ready(); err != nil {
+			log.Warnf("Exporter is not ready: %v", err)
+			http.Error(w, "ECS exporter is not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ECS exporter is ready.\n"))
+	})
+}
+
+// versionInfo is the exporter build information
+type versionInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// versionHandler returns the exporter build information as JSON
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versionInfo{
+		Version:   version.Version,
+		Revision:  version.Revision,
+		Branch:    version.Branch,
+		BuildUser: version.BuildUser,
+		BuildDate: version.BuildDate,
+		GoVersion: version.GoVersion,
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/version"
+)
+
+type testReadyChecker struct {
+	err error
+}
+
+func (c testReadyChecker) Ready() error {
+	return c.err
+}
+
+func TestReadyHandler(t *testing.T) {
+	tests := []struct {
+		err          error
+		expectedCode int
+	}{
+		{nil, http.StatusOK},
+		{errors.New("wanted"), http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", readyPath, nil)
+		w := httptest.NewRecorder()
+		readyHandler(testReadyChecker{err: test.err}).ServeHTTP(w, req)
+
+		if w.Code != test.expectedCode {
+			t.Errorf("\n- %v\n- Status code is wrong, want: %d; got: %d", test, test.expectedCode, w.Code)
+		}
+	}
+}
+
+func TestHealthyHandler(t *testing.T) {
+	req, _ := http.NewRequest("GET", healthyPath, nil)
+	w := httptest.NewRecorder()
+	http.HandlerFunc(healthyHandler).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Status code is wrong, want: %d; got: %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	version.Version = "1.2.3"
+	version.Revision = "abcdef"
+	defer func() {
+		version.Version = ""
+		version.Revision = ""
+	}()
+
+	req, _ := http.NewRequest("GET", versionPath, nil)
+	w := httptest.NewRecorder()
+	http.HandlerFunc(versionHandler).ServeHTTP(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content type is wrong, want: %s; got: %s", "application/json", ct)
+	}
+
+	got := versionInfo{}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Version should be valid JSON: %v", err)
+	}
+	if got.Version != "1.2.3" || got.Revision != "abcdef" || got.GoVersion != version.GoVersion {
+		t.Errorf("Version is wrong, got: %+v", got)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/openmetrics"
+)
+
+// httpMetrics are the metrics of the exporter HTTP handlers
+type httpMetrics struct {
+	inFlight prometheus.Gauge
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// newHTTPMetrics returns the HTTP metrics registered on the registry
+func newHTTPMetrics(reg prometheus.Registerer) (*httpMetrics, error) {
+	m := &httpMetrics{
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "ecs_exporter",
+			Name:      "http_requests_in_flight",
+			Help:      "The number of HTTP requests being served.",
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "ecs_exporter",
+			Name:      "http_requests_total",
+			Help:      "The total number of HTTP requests by handler and status code.",
+		}, []string{"handler", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "ecs_exporter",
+			Name:      "http_request_duration_seconds",
+			Help:      "The duration of the HTTP requests by handler.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"handler"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.inFlight, m.requests, m.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// instrument wraps a handler measuring its requests
+func (m *httpMetrics) instrument(handlerName string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sr, r)
+
+		m.duration.WithLabelValues(handlerName).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(handlerName, strconv.Itoa(sr.status)).Inc()
+	})
+}
+
+// statusRecorder is a response writer that records the status code of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// limitRequests wraps a handler limiting the requests served concurrently, the requests
+// over the limit will get a 503 status code. 0 means no limit
+func limitRequests(max int, h http.Handler) http.Handler {
+	if max <= 0 {
+		return h
+	}
+
+	sem := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			h.ServeHTTP(w, r)
+		default:
+			log.Warnf("Limit of concurrent requests reached (%d), rejecting request", max)
+			http.Error(w, fmt.Sprintf("Limit of concurrent requests reached (%d), try again later.", max), http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// promLogger logs the errors of the Prometheus HTTP handlers
+type promLogger struct{}
+
+// Println implements promhttp.Logger
+func (promLogger) Println(v ...interface{}) {
+	log.Errorln(v...)
+}
+
+// metricsHandler returns the handler of the metrics of the gatherer, the metrics are served in the
+// OpenMetrics format with the family types when the request prefers it and in the Prometheus formats
+// otherwise. The gathering errors are logged and the gathered metrics are served anyway
+func metricsHandler(g prometheus.Gatherer, types openmetrics.FamilyTypes) http.Handler {
+	promHandler := promhttp.HandlerFor(g, promhttp.HandlerOpts{
+		ErrorLog:      promLogger{},
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !openmetrics.Negotiate(r.Header) {
+			promHandler.ServeHTTP(w, r)
+			return
+		}
+
+		mfs, err := g.Gather()
+		if err != nil {
+			log.Errorf("Error gathering metrics: %v", err)
+			if len(mfs) == 0 {
+				http.Error(w, fmt.Sprintf("An error has occurred during metrics gathering:\n\n%s", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := openmetrics.Write(&buf, mfs, types); err != nil {
+			log.Errorf("Error encoding metrics: %v", err)
+			http.Error(w, fmt.Sprintf("An error has occurred during metrics encoding:\n\n%s", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", openmetrics.ContentType)
+		if !gzipAccepted(r) {
+			w.Write(buf.Bytes())
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(buf.Bytes())
+		gz.Close()
+	})
+}
+
+// gzipAccepted returns true if the request accepts gzip encoded responses
+func gzipAccepted(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := newHTTPMetrics(reg)
+	if err != nil {
+		t.Fatalf("Creation of HTTP metrics shouldn't error: %v", err)
+	}
+
+	ok := m.instrument("ok", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	notFound := m.instrument("notfound", http.NotFoundHandler())
+	for _, h := range []http.Handler{ok, ok, notFound} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, req)
+
+	expectedMs := []string{
+		`ecs_exporter_http_requests_in_flight 0`,
+		`ecs_exporter_http_requests_total{code="200",handler="ok"} 2`,
+		`ecs_exporter_http_requests_total{code="404",handler="notfound"} 1`,
+		`ecs_exporter_http_request_duration_seconds_count{handler="ok"} 2`,
+		`ecs_exporter_http_request_duration_seconds_count{handler="notfound"} 1`,
+	}
+	got := w.Body.String()
+	for _, m := range expectedMs {
+		if !strings.Contains(got, m) {
+			t.Errorf("Expected metric data but missing: %s", m)
+		}
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	tests := []struct {
+		max          int
+		requests     int
+		wantRejected int
+	}{
+		{0, 5, 0},
+		{1, 5, 4},
+		{3, 5, 2},
+		{5, 5, 0},
+	}
+
+	for _, test := range tests {
+		// Block the requests until all of them have been made
+		release := make(chan struct{})
+		var served sync.WaitGroup
+		h := limitRequests(test.max, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served.Done()
+			<-release
+		}))
+
+		results := make(chan int, test.requests)
+		var wg sync.WaitGroup
+		for i := 0; i < test.requests; i++ {
+			wg.Add(1)
+			served.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest("GET", "/metrics", nil)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				if w.Code == http.StatusServiceUnavailable {
+					served.Done()
+				}
+				results <- w.Code
+			}()
+		}
+		served.Wait()
+		close(release)
+		wg.Wait()
+		close(results)
+
+		rejected := 0
+		for code := range results {
+			if code == http.StatusServiceUnavailable {
+				rejected++
+			}
+		}
+
+		if rejected != test.wantRejected {
+			t.Errorf("\n- %v\n- Rejected requests are wrong, want: %d; got: %d", test, test.wantRejected, rejected)
+		}
+	}
+}
+
+func TestMetricsHandlerNegotiation(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "ecs_up", Help: "Was the last query of ecs successful."}, func() float64 { return 1 }))
+
+	tests := []struct {
+		accept              string
+		acceptEncoding      string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"", "", "text/plain; version=0.0.4", "# HELP ecs_up Was the last query of ecs successful.\n# TYPE ecs_up gauge\necs_up 1\n"},
+		{"text/html,*/*;q=0.8", "", "text/plain; version=0.0.4", "# HELP ecs_up Was the last query of ecs successful.\n# TYPE ecs_up gauge\necs_up 1\n"},
+		{"application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", "",
+			"application/openmetrics-text; version=1.0.0; charset=utf-8", "# TYPE ecs_up gauge\n# HELP ecs_up Was the last query of ecs successful.\necs_up 1\n# EOF\n"},
+		{"application/openmetrics-text;version=1.0.0", "gzip", "application/openmetrics-text; version=1.0.0; charset=utf-8", ""},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", test.accept)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		w := httptest.NewRecorder()
+		metricsHandler(reg, nil).ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Type"); got != test.expectedContentType {
+			t.Errorf("\n- %v\n- Content type is wrong, want: %s; got: %s", test, test.expectedContentType, got)
+		}
+		if test.acceptEncoding != "" {
+			if got := w.Header().Get("Content-Encoding"); got != test.acceptEncoding {
+				t.Errorf("\n- %v\n- Content encoding is wrong, want: %s; got: %s", test, test.acceptEncoding, got)
+			}
+			continue
+		}
+		if got := w.Body.String(); got != test.expectedBody {
+			t.Errorf("\n- %v\n- Body is wrong, want: %q; got: %q", test, test.expectedBody, got)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/slok/ecs-exporter/collector"
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/types"
+)
+
+const (
+	inventoryCommand = "inventory"
+
+	inventoryJSON  = "json"
+	inventoryCSV   = "csv"
+	inventoryTable = "table"
+
+	defaultInventoryOutput   = inventoryTable
+	defaultInventoryLogLevel = "warn"
+)
+
+// inventoryColumns are the columns of the CSV and table inventory outputs, every row is a cluster,
+// a service or a container instance and the columns that don't apply to it are empty
+var inventoryColumns = []string{"kind", "cluster", "name", "desired", "running", "pending", "instance_id", "status", "agent_connected", "arn"}
+
+// inventoryConfig is the configuration of the inventory command
+type inventoryConfig struct {
+	fs *flag.FlagSet
+
+	filters
+
+	output      string
+	logLevel    log.Level
+	rawLogLevel string
+}
+
+// newInventoryConfig returns an initialized inventory configuration
+func newInventoryConfig() *inventoryConfig {
+	c := &inventoryConfig{
+		fs: flag.NewFlagSet(os.Args[0]+" "+inventoryCommand, flag.ContinueOnError),
+	}
+
+	c.filters.register(c.fs)
+
+	c.fs.StringVar(
+		&c.output, "output", defaultInventoryOutput, "The output format, one of: json, csv, table")
+
+	c.fs.StringVar(
+		&c.rawLogLevel, "log.level", defaultInventoryLogLevel, "The log level, one of: debug, info, warn, error")
+
+	return c
+}
+
+// parse parses the inventory flags
+func (c *inventoryConfig) parse(args []string) error {
+	if err := c.fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(c.fs.Args()) != 0 {
+		return fmt.Errorf("Invalid command line arguments. Help: %s %s -h", os.Args[0], inventoryCommand)
+	}
+
+	if err := c.filters.validate(); err != nil {
+		return err
+	}
+
+	switch c.output {
+	case inventoryJSON, inventoryCSV, inventoryTable:
+	default:
+		return fmt.Errorf("Invalid inventory output: %s", c.output)
+	}
+
+	level, err := log.ParseLevel(c.rawLogLevel)
+	if err != nil {
+		return fmt.Errorf("Invalid log level: %s", c.rawLogLevel)
+	}
+	c.logLevel = level
+
+	return nil
+}
+
+// inventory gathers the clusters, services and container instances that pass the filters, writes them
+// to w in the output format and returns the exit code
+func inventory(args []string, w io.Writer) int {
+	c := newInventoryConfig()
+	if err := c.parse(args); err != nil {
+		log.Error(err)
+		return 1
+	}
+	log.SetLevel(c.logLevel)
+
+	inv, err := collector.GetInventory(collector.Config{
+		Region:        c.awsRegion,
+		ClusterFilter: c.clusterFilter,
+		Clusters:      c.clusters(),
+		Services:      c.services(),
+		Logger:        log.Base(),
+	})
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	if err := writeInventory(w, c.output, inv); err != nil {
+		log.Error(err)
+		return 1
+	}
+	return 0
+}
+
+// writeInventory writes the inventory in the output format
+func writeInventory(w io.Writer, output string, inv *collector.Inventory) error {
+	switch output {
+	case inventoryJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(inv)
+	case inventoryCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(inventoryColumns); err != nil {
+			return err
+		}
+		return cw.WriteAll(inventoryRows(inv))
+	case inventoryTable:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(inventoryColumns, "\t")))
+		for _, r := range inventoryRows(inv) {
+			fmt.Fprintln(tw, strings.Join(r, "\t"))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("invalid inventory output: %s", output)
+}
+
+// inventoryRows returns the inventory rows, every cluster is followed by its services and container instances
+func inventoryRows(inv *collector.Inventory) [][]string {
+	rows := [][]string{}
+	for _, c := range inv.Clusters {
+		rows = append(rows, []string{"cluster", c.Cluster.Name, c.Cluster.Name, "", "", "", "", "", "", c.Cluster.ID})
+		for _, s := range c.Services {
+			rows = append(rows, []string{"service", c.Cluster.Name, s.Name,
+				strconv.FormatInt(s.DesiredT, 10), strconv.FormatInt(s.RunningT, 10), strconv.FormatInt(s.PendingT, 10),
+				"", "", "", s.ID})
+		}
+		for _, ci := range c.ContainerInstances {
+			// The status can be missing on the container instances that only set the active state
+			status := ci.Status
+			if status == "" {
+				status = types.ContainerInstanceStatusInactive
+				if ci.Active {
+					status = types.ContainerInstanceStatusActive
+				}
+			}
+			rows = append(rows, []string{"container_instance", c.Cluster.Name, ci.ID[strings.LastIndex(ci.ID, "/")+1:],
+				"", "", strconv.FormatInt(ci.PendingT, 10),
+				ci.InstanceID, status, strconv.FormatBool(ci.AgentConn), ci.ID})
+		}
+	}
+	return rows
+}
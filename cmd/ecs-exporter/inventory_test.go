@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/slok/ecs-exporter/collector"
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestInventoryConfigParse(t *testing.T) {
+	tests := []struct {
+		ok  bool
+		cmd []string
+	}{
+		{true, []string{"--aws.region", "eu-west-1"}},
+		{true, []string{"--aws.region", "eu-west-1", "--output", "json"}},
+		{true, []string{"--aws.region", "eu-west-1", "--output", "csv", "--log.level", "error"}},
+		{true, []string{"--aws.region", "eu-west-1", "--aws.cluster-include", "^prod-", "--aws.cluster-exclude-names", "legacy", "--aws.service-exclude", "canary"}},
+		{false, []string{"--aws.region", "eu-west-1", "--output", "yaml"}},
+		{false, []string{"--aws.region", "eu-west-1", "--aws.service-include", "["}},
+		{false, []string{"--aws.region", "eu-west-1", "--log.level", "trace"}},
+		{false, []string{"--aws.region", "eu-west-1", "--web.listen-address", ":9222"}},
+		{false, []string{"--aws.region", "eu-west-1", "clusters"}},
+		{false, []string{"--output", "json"}},
+	}
+
+	for _, test := range tests {
+		c := newInventoryConfig()
+		err := c.parse(test.cmd)
+		if test.ok && err != nil {
+			t.Errorf("\n- %v\n- Parsing the inventory flags shouldn't fail: %v", test, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("\n- %v\n- Parsing the inventory flags should fail, it didn't", test)
+		}
+	}
+}
+
+func TestWriteInventory(t *testing.T) {
+	inv := &collector.Inventory{
+		Region: "eu-west-1",
+		Clusters: []*collector.ClusterInventory{
+			&collector.ClusterInventory{
+				Cluster: &types.ECSCluster{ID: "arn:aws:ecs:eu-west-1:111111111111:cluster/prod", Name: "prod"},
+				Services: []*types.ECSService{
+					&types.ECSService{ID: "arn:aws:ecs:eu-west-1:111111111111:service/api", Name: "api", DesiredT: 3, RunningT: 2, PendingT: 1},
+				},
+				ContainerInstances: []*types.ECSContainerInstance{
+					&types.ECSContainerInstance{ID: "arn:aws:ecs:eu-west-1:111111111111:container-instance/ci1", InstanceID: "i-1", Active: true, Status: "ACTIVE", AgentConn: false},
+					&types.ECSContainerInstance{ID: "arn:aws:ecs:eu-west-1:111111111111:container-instance/ci2", InstanceID: "i-2", Active: false, Status: "DRAINING", AgentConn: true},
+					&types.ECSContainerInstance{ID: "arn:aws:ecs:eu-west-1:111111111111:container-instance/ci3", InstanceID: "i-3", Active: false, AgentConn: false},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{inventoryCSV, `kind,cluster,name,desired,running,pending,instance_id,status,agent_connected,arn
+cluster,prod,prod,,,,,,,arn:aws:ecs:eu-west-1:111111111111:cluster/prod
+service,prod,api,3,2,1,,,,arn:aws:ecs:eu-west-1:111111111111:service/api
+container_instance,prod,ci1,,,0,i-1,ACTIVE,false,arn:aws:ecs:eu-west-1:111111111111:container-instance/ci1
+container_instance,prod,ci2,,,0,i-2,DRAINING,true,arn:aws:ecs:eu-west-1:111111111111:container-instance/ci2
+container_instance,prod,ci3,,,0,i-3,INACTIVE,false,arn:aws:ecs:eu-west-1:111111111111:container-instance/ci3
+`},
+		{inventoryTable, `KIND                CLUSTER  NAME  DESIRED  RUNNING  PENDING  INSTANCE_ID  STATUS    AGENT_CONNECTED  ARN
+cluster             prod     prod                                                                     arn:aws:ecs:eu-west-1:111111111111:cluster/prod
+service             prod     api   3        2        1                                                arn:aws:ecs:eu-west-1:111111111111:service/api
+container_instance  prod     ci1                     0        i-1          ACTIVE    false            arn:aws:ecs:eu-west-1:111111111111:container-instance/ci1
+container_instance  prod     ci2                     0        i-2          DRAINING  true             arn:aws:ecs:eu-west-1:111111111111:container-instance/ci2
+container_instance  prod     ci3                     0        i-3          INACTIVE  false            arn:aws:ecs:eu-west-1:111111111111:container-instance/ci3
+`},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := writeInventory(&b, test.output, inv); err != nil {
+			t.Fatalf("\n- %v\n- Writing the inventory shouldn't fail: %v", test, err)
+		}
+		if got := b.String(); got != test.expected {
+			t.Errorf("\n- %v\n- Inventory is wrong, want:\n%s\ngot:\n%s", test, test.expected, got)
+		}
+	}
+
+	// The JSON output is the inventory
+	var b bytes.Buffer
+	if err := writeInventory(&b, inventoryJSON, inv); err != nil {
+		t.Fatalf("Writing the inventory shouldn't fail: %v", err)
+	}
+	got := &collector.Inventory{}
+	if err := json.Unmarshal(b.Bytes(), got); err != nil {
+		t.Fatalf("The inventory should be valid JSON: %v", err)
+	}
+	if len(got.Clusters) != 1 || got.Clusters[0].Services[0].DesiredT != 3 || got.Clusters[0].ContainerInstances[0].InstanceID != "i-1" {
+		t.Errorf("JSON inventory is wrong, got: %s", b.String())
+	}
+
+	// The write errors are returned
+	for _, output := range []string{inventoryCSV, inventoryTable, inventoryJSON} {
+		if err := writeInventory(errWriter{}, output, inv); err == nil {
+			t.Errorf("Writing the %s inventory should fail, it didn't", output)
+		}
+	}
+}
+
+// errWriter is a writer that always fails
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("wanted")
+}
@@ -3,17 +3,30 @@ package main
 //import _ "net/http/pprof"
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/graphite"
+	"github.com/prometheus/common/version"
 
 	"github.com/slok/ecs-exporter/collector"
 	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/relabel"
+	"github.com/slok/ecs-exporter/web"
 )
 
 // Main is the application entry point
 func Main() int {
+	// The inventory command writes a snapshot of the clusters and exits
+	if len(os.Args) > 1 && os.Args[1] == inventoryCommand {
+		return inventory(os.Args[2:], os.Stdout)
+	}
+
 	log.Infof("Starting ECS exporter...")
 
 	// Parse command line flags
@@ -22,40 +35,187 @@ func Main() int {
 		return 1
 	}
 
-	if cfg.debug {
-		log.SetLevel(log.DebugLevel)
+	log.SetLevel(cfg.logLevel)
+	log.SetFormat(cfg.logFormat)
+
+	for name, enabled := range cfg.collectors {
+		if !enabled {
+			log.Warnf("Collector '%s' has been disabled", name)
+		}
+	}
+
+	if cfg.staleGracePeriod > 0 {
+		log.Infof("Last good cluster metrics will be exported for %s when gathering fails", cfg.staleGracePeriod)
 	}
 
-	if cfg.disableCIMetrics {
-		log.Warnf("Cluster container instance metrics have been disabled")
+	// Create the registry with the exporter process metrics
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		version.NewCollector("ecs_exporter"),
+		prometheus.NewProcessCollector(os.Getpid(), ""),
+		prometheus.NewGoCollector(),
+	)
+	httpMetrics, err := newHTTPMetrics(reg)
+	if err != nil {
+		log.Error(err)
+		return 1
 	}
 
+	// Load the relabeling rules and series limits applied to every exposed series
+	var relabelCfg *relabel.Config
+	if cfg.relabelConfig != "" {
+		if relabelCfg, err = relabel.LoadFile(cfg.relabelConfig); err != nil {
+			log.Error(err)
+			return 1
+		}
+		log.Infof("Loaded %d relabeling rules", len(relabelCfg.Rules))
+	}
+	processor, err := relabel.NewProcessor(relabelCfg, cfg.maxSeries, reg)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	// The collections are cancelled when the exporter is shut down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Create the exporter and register it
-	exporter, err := collector.New(cfg.awsRegion, cfg.clusterFilter, cfg.disableCIMetrics)
+	exporter, err := collector.New(collector.Config{
+		Region:           cfg.awsRegion,
+		ClusterFilter:    cfg.clusterFilter,
+		Clusters:         cfg.clusters(),
+		Services:         cfg.services(),
+		MaxServices:      cfg.maxServices,
+		Namespace:        cfg.metricsNamespace,
+		ConstLabels:      cfg.constLabels,
+		ARNLabels:        cfg.arnLabels,
+		ARNInfo:          cfg.arnInfo,
+		EC2Info:          cfg.ec2Info,
+		Collectors:       cfg.collectors,
+		StaleGracePeriod: cfg.staleGracePeriod,
+		CloudWatchPeriod: cfg.cloudWatchPeriod,
+		CloudWatchDelay:  cfg.cloudWatchDelay,
+		AutoScalingTag:   cfg.autoScalingTag,
+		Registerer:       reg,
+		Context:          ctx,
+		Logger:           log.Base(),
+	})
 	if err != nil {
 		log.Error(err)
 		return 1
 	}
-	prometheus.MustRegister(exporter)
 
 	// Serve metrics
-	http.Handle(cfg.metricsPath, prometheus.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	if cfg.maxRequests > 0 {
+		log.Infof("Parallel scrape requests limited to %d", cfg.maxRequests)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(cfg.metricsPath, httpMetrics.instrument("metrics", limitRequests(cfg.maxRequests, metricsHandler(processor.Gatherer(reg), exporter.FamilyTypes()))))
+	if cfg.enableProbe {
+		log.Infof("Probe endpoint enabled on %s", probePath)
+		mux.Handle(probePath, httpMetrics.instrument("probe", limitRequests(cfg.maxRequests, newProbeHandler(collector.Config{
+			ClusterFilter:    cfg.clusterFilter,
+			Clusters:         cfg.clusters(),
+			Services:         cfg.services(),
+			MaxServices:      cfg.maxServices,
+			Namespace:        cfg.metricsNamespace,
+			ConstLabels:      cfg.constLabels,
+			ARNLabels:        cfg.arnLabels,
+			ARNInfo:          cfg.arnInfo,
+			EC2Info:          cfg.ec2Info,
+			Collectors:       cfg.collectors,
+			StaleGracePeriod: cfg.staleGracePeriod,
+			CloudWatchPeriod: cfg.cloudWatchPeriod,
+			CloudWatchDelay:  cfg.cloudWatchDelay,
+			AutoScalingTag:   cfg.autoScalingTag,
+			Context:          ctx,
+		}, cfg.probeRolesRE, processor))))
+	}
+	if cfg.enableDebugState {
+		log.Infof("Debug state endpoint enabled on %s", debugStatePath)
+		mux.Handle(debugStatePath, debugStateHandler(exporter))
+	}
+	mux.HandleFunc(healthyPath, healthyHandler)
+	mux.Handle(readyPath, readyHandler(exporter))
+	mux.HandleFunc(versionPath, versionHandler)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
              <head><title>ECS Exporter</title></head>
              <body>
              <h1>ECS Exporter</h1>
              <p><a href='` + cfg.metricsPath + `'>Metrics</a></p>
+             <p><a href='` + versionPath + `'>Version</a></p>
              </body>
              </html>`))
 	})
 
+	// Create the pushers before serving so a wrong configuration doesn't leave the server running
+	var p *pusher
+	if cfg.pushURL != "" {
+		p = newPusher(cfg.pushURL, cfg.pushJob, cfg.awsRegion, cfg.pushInterval, cfg.pushRetries, cfg.pushBackoff, processor.Gatherer(reg))
+	}
+	var b *graphite.Bridge
+	if cfg.graphiteAddress != "" {
+		if b, err = newGraphiteBridge(cfg.graphiteAddress, cfg.graphitePrefix, cfg.graphiteInterval, cfg.graphiteTimeout, cfg.graphiteOnError, processor.Gatherer(reg)); err != nil {
+			log.Error(err)
+			return 1
+		}
+	}
+
 	log.Infoln("Listening on", cfg.listenAddress)
-	log.Fatal(http.ListenAndServe(cfg.listenAddress, nil))
+	srv := &http.Server{Addr: cfg.listenAddress, Handler: mux}
+	errC := make(chan error, 1)
+	go func() {
+		errC <- web.ListenAndServe(srv, cfg.webConfig)
+	}()
+
+	// Push the metrics until the exporter is shut down
+	if p != nil {
+		log.Infof("Pushing the metrics to %s every %s", cfg.pushURL, cfg.pushInterval)
+		go p.run(ctx)
+	}
+
+	// Push the metrics to Graphite until the exporter is shut down
+	if b != nil {
+		log.Infof("Pushing the metrics to Graphite %s every %s", cfg.graphiteAddress, cfg.graphiteInterval)
+		go b.Run(ctx)
+	}
+
+	// Wait until the server fails or a shutdown signal is received
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-errC:
+		log.Error(err)
+		return 1
+	case sig := <-sigC:
+		log.Infof("Received %s, shutting down...", sig)
+	}
 
+	if err := shutdown(srv, cfg.shutdownTimeout, cancel); err != nil {
+		log.Error(err)
+		return 1
+	}
+	log.Infof("Exporter stopped")
 	return 0
 }
 
+// shutdown stops the server waiting the in-flight requests to finish for the timeout, when the
+// timeout expires the running collections are cancelled and the connections closed
+func shutdown(srv *http.Server, timeout time.Duration, cancelCollections func()) error {
+	defer cancelCollections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Warnf("In-flight requests didn't finish in %s, cancelling them", timeout)
+		cancelCollections()
+		return srv.Close()
+	}
+	return nil
+}
+
 func main() {
 	// Run main program
 	exCode := Main()
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		requestDuration time.Duration
+		timeout         time.Duration
+		expectedDrained bool
+	}{
+		{0, time.Second, true},
+		{100 * time.Millisecond, time.Second, true},
+		{time.Second, 100 * time.Millisecond, false},
+	}
+
+	for _, test := range tests {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		started := make(chan struct{})
+		cancelled := make(chan struct{})
+		finished := make(chan bool, 1)
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			select {
+			case <-time.After(test.requestDuration):
+				finished <- true
+			case <-cancelled:
+				finished <- false
+			}
+		})}
+		go srv.Serve(ln)
+		go http.Get("http://" + ln.Addr().String())
+		<-started
+
+		cancelCalls := 0
+		shutdown(srv, test.timeout, func() {
+			if cancelCalls == 0 {
+				close(cancelled)
+			}
+			cancelCalls++
+		})
+
+		if cancelCalls == 0 {
+			t.Errorf("\n- %v\n- Collections should be cancelled on shutdown, they weren't", test)
+		}
+		if drained := <-finished; drained != test.expectedDrained {
+			t.Errorf("\n- %v\n- In-flight request drain is wrong, want: %t; got: %t", test, test.expectedDrained, drained)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/collector"
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/relabel"
+)
+
+const probePath = "/probe"
+
+// probeHandler serves the metrics of a short lived exporter created for the region,
+// cluster and role of each request
+type probeHandler struct {
+	base      collector.Config        // The configuration shared by the probe exporters (context, collectors and metrics settings)
+	roles     []*regexp.Regexp        // The role ARNs that can be probed, if empty any role can be probed
+	sessions  *collector.SessionCache // The AWS sessions reused between probes
+	processor *relabel.Processor      // The relabeling and series limits applied to the probe metrics
+}
+
+// newProbeHandler returns an initialized probe handler, the region, clusters and session of the
+// base configuration are set on each probe
+func newProbeHandler(base collector.Config, roles []*regexp.Regexp, processor *relabel.Processor) *probeHandler {
+	return &probeHandler{
+		base:      base,
+		roles:     roles,
+		sessions:  collector.NewSessionCache(collector.DefaultSessionTTL, collector.DefaultMaxSessions),
+		processor: processor,
+	}
+}
+
+// allowedRole returns true if the role ARN can be probed
+func (p *probeHandler) allowedRole(roleARN string) bool {
+	if len(p.roles) == 0 {
+		return true
+	}
+	for _, re := range p.roles {
+		if re.MatchString(roleARN) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP implements http.Handler
+func (p *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	region := q.Get("region")
+	cluster := q.Get("cluster")
+	roleARN := q.Get("role_arn")
+
+	if region == "" {
+		http.Error(w, "'region' parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	if !collector.ValidRegion(region) {
+		http.Error(w, fmt.Sprintf("Invalid 'region' parameter: %s", region), http.StatusBadRequest)
+		return
+	}
+
+	if roleARN != "" && !strings.HasPrefix(roleARN, "arn:") {
+		http.Error(w, fmt.Sprintf("Invalid 'role_arn' parameter: %s", roleARN), http.StatusBadRequest)
+		return
+	}
+
+	if roleARN != "" && !p.allowedRole(roleARN) {
+		http.Error(w, fmt.Sprintf("Role not allowed: %s", roleARN), http.StatusForbidden)
+		return
+	}
+
+	// Scope the exporter to the cluster if present, the cluster replaces the inclusions
+	// of the base configuration but its exclusions are kept
+	probeCfg := p.base
+	if cluster != "" {
+		probeCfg.ClusterFilter = ""
+		probeCfg.Clusters = collector.ClusterFilter{
+			IncludeNames: []string{cluster},
+			Exclude:      p.base.Clusters.Exclude,
+			ExcludeNames: p.base.Clusters.ExcludeNames,
+		}
+	}
+
+	s, err := p.sessions.Get(region, roleARN)
+	if err != nil {
+		log.Errorf("Error probing region '%s': %v", region, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	probeCfg.Region = region
+	probeCfg.Session = s
+	exporter, err := collector.New(probeCfg)
+	if err != nil {
+		log.Errorf("Error probing region '%s': %v", region, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Debugf("Probing region '%s', cluster '%s' and role '%s'", region, cluster, roleARN)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(exporter)
+	metricsHandler(p.processor.Gatherer(reg), exporter.FamilyTypes()).ServeHTTP(w, r)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/collector"
+	"github.com/slok/ecs-exporter/relabel"
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestProbeHandlerBadRequest(t *testing.T) {
+	tests := []struct {
+		query string
+	}{
+		{""},
+		{"?cluster=cluster1"},
+		{"?cluster=cluster1&role_arn=arn:aws:iam::123456789012:role/ecs-exporter"},
+		{"?region=eu-west-1&role_arn=wrong"},
+		{"?region=eu-west-1%2F..%2Fx"},
+		{"?region=not-a-region"},
+	}
+
+	for _, test := range tests {
+		h := newProbeHandler(collector.Config{Context: context.Background()}, nil, nil)
+
+		req, _ := http.NewRequest("GET", probePath+test.query, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("\n- %v\n- Probe status code is wrong, got: %d; want: %d", test, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestProbeHandlerRoles(t *testing.T) {
+	roles := []*regexp.Regexp{regexp.MustCompile("^(?:arn:aws:iam::123456789012:role/ecs-.*)$")}
+	tests := []struct {
+		role         string
+		expectedCode int
+	}{
+		{"arn:aws:iam::999999999999:role/ecs-exporter", http.StatusForbidden},
+		{"arn:aws:iam::123456789012:role/admin", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		h := newProbeHandler(collector.Config{Context: context.Background()}, roles, nil)
+
+		req, _ := http.NewRequest("GET", probePath+"?region=eu-west-1&role_arn="+test.role, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.expectedCode {
+			t.Errorf("\n- %v\n- Probe status code is wrong, got: %d; want: %d", test, w.Code, test.expectedCode)
+		}
+		if h.sessions.Len() != 0 {
+			t.Errorf("\n- %v\n- Not allowed roles shouldn't create sessions, they did", test)
+		}
+	}
+
+	h := newProbeHandler(collector.Config{}, roles, nil)
+	if !h.allowedRole("arn:aws:iam::123456789012:role/ecs-exporter") {
+		t.Errorf("Matching role should be allowed, it wasn't")
+	}
+}
+
+// probeTestGatherer returns fixed clusters without services nor container instances
+type probeTestGatherer struct {
+	collector.ECSGatherer
+	clusters []*types.ECSCluster
+}
+
+func (g *probeTestGatherer) GetClusters() ([]*types.ECSCluster, error) {
+	return g.clusters, nil
+}
+
+func (g *probeTestGatherer) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSService, error) {
+	return []*types.ECSService{}, nil
+}
+
+func (g *probeTestGatherer) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*types.ECSContainerInstance, error) {
+	return []*types.ECSContainerInstance{}, nil
+}
+
+func TestProbeHandler(t *testing.T) {
+	g := &probeTestGatherer{clusters: []*types.ECSCluster{
+		{ID: "arn:aws:ecs:eu-west-1:000000000000:cluster/cluster1", Name: "cluster1"},
+		{ID: "arn:aws:ecs:eu-west-1:000000000000:cluster/cluster2", Name: "cluster2"},
+		{ID: "arn:aws:ecs:eu-west-1:000000000000:cluster/cluster3", Name: "cluster3"},
+	}}
+	processor, err := relabel.NewProcessor(nil, 0, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("Creating the processor shouldn't error: %v", err)
+	}
+	h := newProbeHandler(collector.Config{
+		ClusterFilter: "cluster2",
+		Clusters:      collector.ClusterFilter{ExcludeNames: []string{"cluster3"}},
+		Gatherer:      g,
+		Context:       context.Background(),
+	}, nil, processor)
+
+	tests := []struct {
+		cluster     string
+		expClusters []string
+		expMissing  []string
+	}{
+		{"cluster1", []string{"cluster1"}, []string{"cluster2", "cluster3"}},
+		{"cluster2", []string{"cluster2"}, []string{"cluster1", "cluster3"}},
+		{"cluster3", []string{}, []string{"cluster1", "cluster2", "cluster3"}},
+		{"", []string{"cluster2"}, []string{"cluster1", "cluster3"}},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", probePath+"?region=eu-west-1&cluster="+test.cluster, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("\n- %v\n- Probe status code is wrong, got: %d; want: %d", test, w.Code, http.StatusOK)
+		}
+		body := w.Body.String()
+		for _, c := range test.expClusters {
+			if !strings.Contains(body, `cluster="`+c+`"`) {
+				t.Errorf("\n- %v\n- Probe should export the metrics of %s, it didn't:\n%s", test, c, body)
+			}
+		}
+		for _, c := range test.expMissing {
+			if strings.Contains(body, `cluster="`+c+`"`) {
+				t.Errorf("\n- %v\n- Probe shouldn't export the metrics of %s, it did:\n%s", test, c, body)
+			}
+		}
+	}
+
+	if h.sessions.Len() != 1 {
+		t.Errorf("Probes of the same region and role should reuse the session, got: %d sessions; want: 1", h.sessions.Len())
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"github.com/slok/ecs-exporter/log"
+)
+
+// pushGroupingLabel is the Pushgateway grouping label with the region of the exporter, the metrics
+// already have a region label so it can't be used as grouping label
+const pushGroupingLabel = "aws_region"
+
+// pushFunc pushes the metrics of a gatherer to a Pushgateway replacing the metrics of the group
+type pushFunc func(job string, grouping map[string]string, url string, g prometheus.Gatherer) error
+
+// pusher pushes the gathered metrics to a Pushgateway on an interval
+type pusher struct {
+	url      string
+	job      string
+	grouping map[string]string
+	interval time.Duration
+	retries  int           // The number of retries of a failed push
+	backoff  time.Duration // The time waited before retrying a failed push
+	gatherer prometheus.Gatherer
+	push     pushFunc
+}
+
+// newPusher returns a pusher of the metrics of a region
+func newPusher(url, job, region string, interval time.Duration, retries int, backoff time.Duration, g prometheus.Gatherer) *pusher {
+	return &pusher{
+		url:      url,
+		job:      job,
+		grouping: map[string]string{pushGroupingLabel: region},
+		interval: interval,
+		retries:  retries,
+		backoff:  backoff,
+		gatherer: g,
+		push:     push.FromGatherer,
+	}
+}
+
+// run pushes the metrics on every interval until the context is done, the first push is made on start
+func (p *pusher) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.pushRetry(ctx); err != nil {
+			log.Errorf("Error pushing the metrics to %s: %v", p.url, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pushRetry pushes the metrics retrying the failed pushes, the last error is returned
+func (p *pusher) pushRetry(ctx context.Context) error {
+	var err error
+	for i := 0; i <= p.retries; i++ {
+		if i > 0 {
+			log.Warnf("Error pushing the metrics, retrying in %s: %v", p.backoff, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(p.backoff):
+			}
+		}
+
+		if err = p.push(p.job, p.grouping, p.url, p.gatherer); err == nil {
+			log.Debugf("Pushed the metrics to %s", p.url)
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPusherPushRetry(t *testing.T) {
+	tests := []struct {
+		failures      int
+		retries       int
+		expectedCalls int
+		expectError   bool
+	}{
+		{0, 3, 1, false},
+		{2, 3, 3, false},
+		{3, 3, 4, false},
+		{4, 3, 4, true},
+		{1, 0, 1, true},
+	}
+
+	for _, test := range tests {
+		calls := 0
+		p := newPusher("localhost:9091", "ecs_exporter", "eu-west-1", time.Minute, test.retries, time.Millisecond, prometheus.NewRegistry())
+		p.push = func(job string, grouping map[string]string, url string, g prometheus.Gatherer) error {
+			calls++
+			if calls <= test.failures {
+				return errors.New("wanted")
+			}
+			return nil
+		}
+
+		err := p.pushRetry(context.Background())
+		if test.expectError != (err != nil) {
+			t.Errorf("\n- %v\n- Push error is wrong, want error: %t; got: %v", test, test.expectError, err)
+		}
+		if calls != test.expectedCalls {
+			t.Errorf("\n- %v\n- Push calls are wrong, want: %d; got: %d", test, test.expectedCalls, calls)
+		}
+	}
+}
+
+func TestPusherRun(t *testing.T) {
+	var mu sync.Mutex
+	paths := []string{}
+	methods := []string{}
+	pushed := make(chan struct{}, 10)
+	fails := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		methods = append(methods, r.Method)
+		// The first push fails to check the retries
+		if fails > 0 {
+			fails--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		pushed <- struct{}{}
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "ecs_up", Help: "test"})
+	reg.MustRegister(g)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	p := newPusher(srv.URL, "ecs_exporter", "eu-west-1", 10*time.Millisecond, 1, time.Millisecond, reg)
+	go func() {
+		p.run(ctx)
+		close(done)
+	}()
+
+	// Wait for two successful pushes
+	for i := 0; i < 2; i++ {
+		select {
+		case <-pushed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Metrics should be pushed, they weren't")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Pusher should stop when the context is cancelled, it didn't")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, path := range paths {
+		if path != "/metrics/job/ecs_exporter/aws_region/eu-west-1" {
+			t.Errorf("Push path is wrong: %s", path)
+		}
+		if methods[i] != http.MethodPut {
+			t.Errorf("Push method is wrong: %s", methods[i])
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func init() {
+	registerCollector("autoscaling", false, newAutoScalingCollector)
+}
+
+// autoScalingCollector collects the metrics of the Auto Scaling groups of the clusters
+type autoScalingCollector struct {
+	region string
+	tag    string // The tag of the Auto Scaling groups whose value is the cluster name, if empty the groups are found by the container instances
+	d      descBuilder
+
+	// Metrics descriptions
+	asgDesired      *prometheus.Desc
+	asgMin          *prometheus.Desc
+	asgMax          *prometheus.Desc
+	asgInService    *prometheus.Desc
+	asgRegistered   *prometheus.Desc
+	asgUnregistered *prometheus.Desc
+}
+
+// newAutoScalingCollector returns an initialized Auto Scaling collector
+func newAutoScalingCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	return &autoScalingCollector{
+		region: cfg.Region,
+		tag:    cfg.AutoScalingTag,
+		d:      d,
+
+		asgDesired: d.desc("autoscaling_group", "desired_capacity",
+			"The desired capacity of the Auto Scaling group",
+			"region", "cluster", "autoscaling_group"),
+		asgMin: d.desc("autoscaling_group", "min_size",
+			"The minimum size of the Auto Scaling group",
+			"region", "cluster", "autoscaling_group"),
+		asgMax: d.desc("autoscaling_group", "max_size",
+			"The maximum size of the Auto Scaling group",
+			"region", "cluster", "autoscaling_group"),
+		asgInService: d.desc("autoscaling_group", "in_service_instances",
+			"The number of instances of the Auto Scaling group in the InService state",
+			"region", "cluster", "autoscaling_group"),
+		asgRegistered: d.desc("autoscaling_group", "registered_instances",
+			"The number of instances of the Auto Scaling group registered as container instances on the cluster",
+			"region", "cluster", "autoscaling_group"),
+		asgUnregistered: d.desc("autoscaling_group", "unregistered_instances",
+			"The number of instances of the Auto Scaling group in the InService state not registered as container instances on the cluster",
+			"region", "cluster", "autoscaling_group"),
+	}
+}
+
+// Describe implements subCollector
+func (c *autoScalingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.asgDesired
+	ch <- c.asgMin
+	ch <- c.asgMax
+	ch <- c.asgInService
+	ch <- c.asgRegistered
+	ch <- c.asgUnregistered
+}
+
+// Update implements subCollector
+func (c *autoScalingCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	return s.forEachCluster(func(cluster *types.ECSCluster) error {
+		cis, err := s.containerInstances(cluster)
+
+		var groups []*types.AutoScalingGroup
+		var asgErr error
+		if c.tag != "" {
+			// The container instances are only used to know the registered instances of the groups
+			groups, asgErr = s.taggedAutoScalingGroups(cluster, c.tag)
+		} else {
+			// The Auto Scaling groups are found by the container instances
+			if len(cis) == 0 {
+				return err
+			}
+			groups, asgErr = s.autoScalingGroups(cluster, cis)
+		}
+		if asgErr == nil || groups != nil {
+			c.collectClusterAutoScalingMetrics(ctx, ch, cluster, cis, groups)
+		}
+		if err == nil {
+			err = asgErr
+		}
+		return err
+	})
+}
+
+// collectClusterAutoScalingMetrics collects the metrics of the Auto Scaling groups, the registered and unregistered
+// instances are not collected without the container instances (nil)
+func (c *autoScalingCollector) collectClusterAutoScalingMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, cInstances []*types.ECSContainerInstance, groups []*types.AutoScalingGroup) {
+	registered := map[string]bool{}
+	for _, ci := range cInstances {
+		registered[ci.InstanceID] = true
+	}
+
+	for _, g := range groups {
+		var inService, reg, unreg int
+		for _, i := range g.Instances {
+			if registered[i.InstanceID] {
+				reg++
+			}
+			if i.LifecycleState != types.AutoScalingLifecycleInService {
+				continue
+			}
+			inService++
+			if !registered[i.InstanceID] {
+				unreg++
+			}
+		}
+
+		values := c.d.values([]string{c.region, cluster.Name, g.Name}, cluster.ID)
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.asgDesired, prometheus.GaugeValue, float64(g.DesiredCapacity), values...))
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.asgMin, prometheus.GaugeValue, float64(g.MinSize), values...))
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.asgMax, prometheus.GaugeValue, float64(g.MaxSize), values...))
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.asgInService, prometheus.GaugeValue, float64(inService), values...))
+		if cInstances == nil {
+			continue
+		}
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.asgRegistered, prometheus.GaugeValue, float64(reg), values...))
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.asgUnregistered, prometheus.GaugeValue, float64(unreg), values...))
+	}
+}
@@ -0,0 +1,207 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestCollectClusterAutoScalingMetrics(t *testing.T) {
+	exp := newAutoScalingCollector(Config{Region: "eu-west-1"}).(*autoScalingCollector)
+	ch := make(chan prometheus.Metric)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testCIs := []*types.ECSContainerInstance{
+		&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-0"},
+		&types.ECSContainerInstance{ID: "ci1", InstanceID: "i-1"},
+		&types.ECSContainerInstance{ID: "ci2", InstanceID: "i-2"},
+	}
+	testGs := []*types.AutoScalingGroup{
+		&types.AutoScalingGroup{
+			ID: "asg1", Name: "asg1", DesiredCapacity: 4, MinSize: 1, MaxSize: 10,
+			Instances: []*types.AutoScalingInstance{
+				&types.AutoScalingInstance{InstanceID: "i-0", LifecycleState: "InService"},
+				&types.AutoScalingInstance{InstanceID: "i-1", LifecycleState: "InService"},
+				&types.AutoScalingInstance{InstanceID: "i-3", LifecycleState: "InService"},
+				&types.AutoScalingInstance{InstanceID: "i-4", LifecycleState: "Pending"},
+			},
+		},
+		&types.AutoScalingGroup{
+			ID: "asg2", Name: "asg2", DesiredCapacity: 1, MinSize: 0, MaxSize: 2,
+			Instances: []*types.AutoScalingInstance{
+				&types.AutoScalingInstance{InstanceID: "i-2", LifecycleState: "Terminating"},
+			},
+		},
+	}
+	go func() {
+		exp.collectClusterAutoScalingMetrics(context.TODO(), ch, testC, testCIs, testGs)
+		close(ch)
+	}()
+
+	got := map[string]map[string]float64{}
+	for m := range ch {
+		g := readGauge(m)
+		desc := m.Desc().String()
+		name := desc[strings.Index(desc, `"`)+1 : strings.Index(desc, `",`)]
+		if got[g.labels["autoscaling_group"]] == nil {
+			got[g.labels["autoscaling_group"]] = map[string]float64{}
+		}
+		got[g.labels["autoscaling_group"]][name] = g.value
+		if g.labels["cluster"] != "cluster1" || g.labels["region"] != "eu-west-1" {
+			t.Errorf("Labels are wrong: %v", g.labels)
+		}
+	}
+
+	expected := map[string]map[string]float64{
+		"asg1": {
+			"ecs_autoscaling_group_desired_capacity":       4,
+			"ecs_autoscaling_group_min_size":               1,
+			"ecs_autoscaling_group_max_size":               10,
+			"ecs_autoscaling_group_in_service_instances":   3,
+			"ecs_autoscaling_group_registered_instances":   2,
+			"ecs_autoscaling_group_unregistered_instances": 1,
+		},
+		"asg2": {
+			"ecs_autoscaling_group_desired_capacity":       1,
+			"ecs_autoscaling_group_min_size":               0,
+			"ecs_autoscaling_group_max_size":               2,
+			"ecs_autoscaling_group_in_service_instances":   0,
+			"ecs_autoscaling_group_registered_instances":   1,
+			"ecs_autoscaling_group_unregistered_instances": 0,
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Metrics are wrong, want: %v; got: %v", expected, got)
+	}
+}
+
+func TestCollectClusterAutoScalingMetricsTimeout(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Test shouldn't panic, it did: %v", r)
+		}
+	}()
+
+	exp := newAutoScalingCollector(Config{Region: "eu-west-1"}).(*autoScalingCollector)
+	ch := make(chan prometheus.Metric)
+	close(ch)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testGs := []*types.AutoScalingGroup{&types.AutoScalingGroup{ID: "asg1", Name: "asg1"}}
+
+	// Cancel the context to mock as a finished main function
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exp.collectClusterAutoScalingMetrics(ctx, ch, testC, nil, testGs)
+}
+
+// autoScalingTestGatherer is an ECSGatherer with a cluster, its container instances and its tagged Auto Scaling groups
+type autoScalingTestGatherer struct {
+	ECSGatherer
+	cInstances    []*types.ECSContainerInstance
+	cInstancesErr error
+	groups        []*types.AutoScalingGroup
+	tag           string
+}
+
+func (c *autoScalingTestGatherer) GetClusters() ([]*types.ECSCluster, error) {
+	return []*types.ECSCluster{&types.ECSCluster{ID: "c1", Name: "cluster1"}}, nil
+}
+
+func (c *autoScalingTestGatherer) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*types.ECSContainerInstance, error) {
+	return c.cInstances, c.cInstancesErr
+}
+
+func (c *autoScalingTestGatherer) GetTaggedAutoScalingGroups(key, value string) ([]*types.AutoScalingGroup, error) {
+	c.tag = key + "=" + value
+	return c.groups, nil
+}
+
+func TestAutoScalingUpdateTagged(t *testing.T) {
+	groups := []*types.AutoScalingGroup{
+		&types.AutoScalingGroup{
+			ID: "asg1", Name: "asg1", DesiredCapacity: 2,
+			Instances: []*types.AutoScalingInstance{
+				&types.AutoScalingInstance{InstanceID: "i-1", LifecycleState: "InService"},
+				&types.AutoScalingInstance{InstanceID: "i-2", LifecycleState: "InService"},
+			},
+		},
+	}
+	tests := []struct {
+		cInstances    []*types.ECSContainerInstance
+		cInstancesErr error
+		expectedErr   bool
+		expected      map[string]float64
+	}{
+		{
+			// The groups are found without registered container instances
+			[]*types.ECSContainerInstance{}, nil, false,
+			map[string]float64{
+				"ecs_autoscaling_group_desired_capacity":       2,
+				"ecs_autoscaling_group_min_size":               0,
+				"ecs_autoscaling_group_max_size":               0,
+				"ecs_autoscaling_group_in_service_instances":   2,
+				"ecs_autoscaling_group_registered_instances":   0,
+				"ecs_autoscaling_group_unregistered_instances": 2,
+			},
+		},
+		{
+			[]*types.ECSContainerInstance{&types.ECSContainerInstance{ID: "ci1", InstanceID: "i-1"}}, nil, false,
+			map[string]float64{
+				"ecs_autoscaling_group_desired_capacity":       2,
+				"ecs_autoscaling_group_min_size":               0,
+				"ecs_autoscaling_group_max_size":               0,
+				"ecs_autoscaling_group_in_service_instances":   2,
+				"ecs_autoscaling_group_registered_instances":   1,
+				"ecs_autoscaling_group_unregistered_instances": 1,
+			},
+		},
+		{
+			// Without the container instances the registered instances are unknown
+			nil, errors.New("wanted"), true,
+			map[string]float64{
+				"ecs_autoscaling_group_desired_capacity":     2,
+				"ecs_autoscaling_group_min_size":             0,
+				"ecs_autoscaling_group_max_size":             0,
+				"ecs_autoscaling_group_in_service_instances": 2,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		exp := newAutoScalingCollector(Config{Region: "eu-west-1", AutoScalingTag: "ecs-cluster"}).(*autoScalingCollector)
+		client := &autoScalingTestGatherer{cInstances: test.cInstances, cInstancesErr: test.cInstancesErr, groups: groups}
+		s := newScrape("eu-west-1", client, newDataCache(), 0, log.Base())
+		s.loadClusters(func(*types.ECSCluster) bool { return true })
+
+		ch := make(chan prometheus.Metric)
+		var err error
+		go func() {
+			err = exp.Update(context.TODO(), s, ch)
+			close(ch)
+		}()
+
+		got := map[string]float64{}
+		for m := range ch {
+			desc := m.Desc().String()
+			got[desc[strings.Index(desc, `"`)+1:strings.Index(desc, `",`)]] = readGauge(m).value
+		}
+
+		if (err != nil) != test.expectedErr {
+			t.Errorf("\n- %v\n- Error is wrong, want error: %t; got: %v", test, test.expectedErr, err)
+		}
+		if client.tag != "ecs-cluster=cluster1" {
+			t.Errorf("\n- %v\n- Groups tag is wrong, want: %s; got: %s", test, "ecs-cluster=cluster1", client.tag)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("\n- %v\n- Metrics are wrong, want: %v; got: %v", test, test.expected, got)
+		}
+	}
+}
@@ -2,18 +2,63 @@ package collector
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling/applicationautoscalingiface"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
 
 	"github.com/slok/ecs-exporter/log"
 	"github.com/slok/ecs-exporter/types"
 )
 
 const (
-	maxServicesAPI = 10
+	maxServicesAPI    = 10
+	maxInstancesAPI   = 100
+	maxAutoScalingAPI = 50
+	maxScalableAPI    = 50
+	maxCloudWatchAPI  = 10 // The maximum number of parallel CloudWatch calls
+	maxImagesAPI      = 100
+	instanceCacheTTL  = time.Hour
+	missingCacheTTL   = 5 * time.Minute // The time the instances that weren't found are not described again
+	taskDefCacheTTL   = time.Hour
+	ecrDigestCacheTTL = 24 * time.Hour  // The time an unused ECR image is cached, the push date of a digest never changes
+	ecrTagCacheTTL    = 5 * time.Minute // The time the digest of an ECR image tag is cached, the tags can be moved
+	cloudWatchNS      = "AWS/ECS"
+)
+
+var (
+	// ecrRegistryRE matches the ECR registries, the first group is the account ID and the second the region
+	ecrRegistryRE = regexp.MustCompile(`^(\d{12})\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+	// cloudWatchClusterMetrics are the CloudWatch metrics gathered for the clusters
+	cloudWatchClusterMetrics = []string{
+		types.CloudWatchCPUUtilization,
+		types.CloudWatchMemoryUtilization,
+		types.CloudWatchCPUReservation,
+		types.CloudWatchMemoryReservation,
+	}
+	// cloudWatchServiceMetrics are the CloudWatch metrics gathered for the services
+	cloudWatchServiceMetrics = []string{
+		types.CloudWatchCPUUtilization,
+		types.CloudWatchMemoryUtilization,
+	}
 )
 
 // ECSGatherer is the interface that implements the methods required to gather ECS data
@@ -21,6 +66,13 @@ type ECSGatherer interface {
 	GetClusters() ([]*types.ECSCluster, error)
 	GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSService, error)
 	GetClusterContainerInstances(cluster *types.ECSCluster) ([]*types.ECSContainerInstance, error)
+	GetInstances(instanceIDs []string) ([]*types.EC2Instance, error)
+	GetAutoScalingGroups(instanceIDs []string) ([]*types.AutoScalingGroup, error)
+	GetTaggedAutoScalingGroups(key, value string) ([]*types.AutoScalingGroup, error)
+	GetServiceScalableTargets(cluster *types.ECSCluster, services []*types.ECSService) ([]*types.ScalableTarget, error)
+	GetTargetHealth(targetGroupARNs []string) ([]*types.TargetHealth, error)
+	GetCloudWatchMetrics(cluster *types.ECSCluster, services []*types.ECSService, period, delay time.Duration) ([]*types.CloudWatchMetric, error)
+	GetTaskDefinitionImages(taskDefinitionARNs []string) ([]*types.ContainerImage, error)
 }
 
 // Generate ECS API mocks running go generate
@@ -29,7 +81,20 @@ type ECSGatherer interface {
 // ECSClient is a wrapper for AWS ecs client that implements helpers to get ECS clusters metrics
 type ECSClient struct {
 	client        ecsiface.ECSAPI
+	ec2           ec2iface.EC2API
+	autoscaling   autoscalingiface.AutoScalingAPI
+	appScaling    applicationautoscalingiface.ApplicationAutoScalingAPI
+	elbv2         elbv2iface.ELBV2API
+	cloudwatch    cloudwatchiface.CloudWatchAPI
+	ecr           ecriface.ECRAPI
+	region        string
 	apiMaxResults int64
+	logger        log.Logger
+	serviceFilter *serviceMatcher // The filter of the services, nil if all the services are gathered
+	instances     *instanceCache  // The described EC2 instances
+	statistics    *dataCache      // The CloudWatch datapoints by metric and period
+	taskDefs      *dataCache      // The container images of the task definitions by ARN
+	ecrImages     *dataCache      // The digest and push date of the ECR images by repository and digest or tag
 }
 
 // NewECSClient will return an initialized ECSClient
@@ -40,10 +105,27 @@ func NewECSClient(awsRegion string) (*ECSClient, error) {
 		return nil, fmt.Errorf("error creating aws session")
 	}
 
+	return NewECSClientFromSession(s), nil
+}
+
+// NewECSClientFromSession will return an initialized ECSClient that uses an already created AWS session
+func NewECSClientFromSession(s *session.Session) *ECSClient {
 	return &ECSClient{
 		client:        ecs.New(s),
+		ec2:           ec2.New(s),
+		autoscaling:   autoscaling.New(s),
+		appScaling:    applicationautoscaling.New(s),
+		elbv2:         elbv2.New(s),
+		cloudwatch:    cloudwatch.New(s),
+		ecr:           ecr.New(s),
+		region:        aws.StringValue(s.Config.Region),
 		apiMaxResults: 100,
-	}, nil
+		logger:        log.Base(),
+		instances:     newInstanceCache(instanceCacheTTL, missingCacheTTL),
+		statistics:    newDataCache(),
+		taskDefs:      newDataCache(),
+		ecrImages:     newDataCache(),
+	}
 }
 
 // GetClusters will get the clusters from the ECS API
@@ -54,7 +136,7 @@ func (e *ECSClient) GetClusters() ([]*types.ECSCluster, error) {
 	}
 
 	// Get cluster IDs
-	log.Debugf("Getting cluster list for region")
+	e.logger.With("operation", "ListClusters").Debugf("Getting cluster list for region")
 	for {
 		resp, err := e.client.ListClusters(params)
 		if err != nil {
@@ -81,7 +163,7 @@ func (e *ECSClient) GetClusters() ([]*types.ECSCluster, error) {
 	}
 
 	cs := []*types.ECSCluster{}
-	log.Debugf("Getting cluster descriptions")
+	e.logger.With("operation", "DescribeClusters").Debugf("Getting cluster descriptions")
 	for _, c := range resp2.Clusters {
 		ec := &types.ECSCluster{
 			ID:   aws.StringValue(c.ClusterArn),
@@ -90,7 +172,7 @@ func (e *ECSClient) GetClusters() ([]*types.ECSCluster, error) {
 		cs = append(cs, ec)
 	}
 
-	log.Debugf("Got %d clusters", len(cs))
+	e.logger.Debugf("Got %d clusters", len(cs))
 	return cs, nil
 }
 
@@ -102,6 +184,7 @@ type srvRes struct {
 
 // GetClusterServices will return all the services from a cluster
 func (e *ECSClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSService, error) {
+	logger := e.logger.With("cluster", cluster.Name)
 
 	sArns := []*string{}
 
@@ -111,7 +194,7 @@ func (e *ECSClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSS
 		MaxResults: aws.Int64(e.apiMaxResults),
 	}
 
-	log.Debugf("Getting service list for cluster: %s", cluster.Name)
+	logger.With("operation", "ListServices").Debugf("Getting service list")
 	for {
 		resp, err := e.client.ListServices(params)
 		if err != nil {
@@ -128,16 +211,28 @@ func (e *ECSClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSS
 		params.NextToken = resp.NextToken
 	}
 
+	// Filter the services before describing them to save API calls
+	if e.serviceFilter != nil {
+		filtered := []*string{}
+		for _, a := range sArns {
+			if e.serviceFilter.match(serviceNameFromARN(aws.StringValue(a))) {
+				filtered = append(filtered, a)
+			}
+		}
+		logger.Debugf("Filtered %d of %d services", len(sArns)-len(filtered), len(sArns))
+		sArns = filtered
+	}
+
 	res := []*types.ECSService{}
 	// If no services then nothing to fetch
 	if len(sArns) == 0 {
-		log.Debugf("Ignoring services fetching, no services in cluster: %s", cluster.Name)
+		logger.Debugf("Ignoring services fetching, no services in cluster")
 		return res, nil
 	}
 
-	servC := make(chan srvRes)
-
-	// Only can grab 10 services at a time, create calls in blocks of 10 services
+	// Only can grab 10 services at a time, create calls in blocks of 10 services. The channel has room
+	// for every block so the goroutines don't block when the results stop being read on error
+	servC := make(chan srvRes, (len(sArns)+maxServicesAPI-1)/maxServicesAPI)
 	totalGr := 0 // counter for goroutines
 	for i := 0; i <= len(sArns)/maxServicesAPI; i++ {
 		st := i * maxServicesAPI
@@ -156,7 +251,7 @@ func (e *ECSClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSS
 		totalGr++
 		// Make a call on goroutine for each service blocks
 		go func(services []*string) {
-			log.Debugf("Getting service descriptions for cluster: %s", cluster.Name)
+			logger.With("operation", "DescribeServices").Debugf("Getting service descriptions")
 			params := &ecs.DescribeServicesInput{
 				Services: services,
 				Cluster:  aws.String(cluster.ID),
@@ -164,17 +259,38 @@ func (e *ECSClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSS
 			resp, err := e.client.DescribeServices(params)
 			if err != nil {
 				servC <- srvRes{nil, err}
+				return
 			}
 
 			ss := []*types.ECSService{}
 
 			for _, s := range resp.Services {
 				es := &types.ECSService{
-					ID:       aws.StringValue(s.ServiceArn),
-					Name:     aws.StringValue(s.ServiceName),
-					DesiredT: aws.Int64Value(s.DesiredCount),
-					RunningT: aws.Int64Value(s.RunningCount),
-					PendingT: aws.Int64Value(s.PendingCount),
+					ID:             aws.StringValue(s.ServiceArn),
+					Name:           aws.StringValue(s.ServiceName),
+					DesiredT:       aws.Int64Value(s.DesiredCount),
+					RunningT:       aws.Int64Value(s.RunningCount),
+					PendingT:       aws.Int64Value(s.PendingCount),
+					TaskDefinition: aws.StringValue(s.TaskDefinition),
+					Status:         aws.StringValue(s.Status),
+					CreatedAt:      aws.TimeValue(s.CreatedAt),
+				}
+				for _, d := range s.Deployments {
+					es.Deployments = append(es.Deployments, &types.ECSDeployment{
+						ID:             aws.StringValue(d.Id),
+						Status:         aws.StringValue(d.Status),
+						TaskDefinition: aws.StringValue(d.TaskDefinition),
+						DesiredT:       aws.Int64Value(d.DesiredCount),
+						PendingT:       aws.Int64Value(d.PendingCount),
+						RunningT:       aws.Int64Value(d.RunningCount),
+						CreatedAt:      aws.TimeValue(d.CreatedAt),
+					})
+				}
+				for _, lb := range s.LoadBalancers {
+					// Classic load balancers don't have target groups
+					if tg := aws.StringValue(lb.TargetGroupArn); tg != "" {
+						es.TargetGroups = append(es.TargetGroups, tg)
+					}
 				}
 				ss = append(ss, es)
 			}
@@ -194,12 +310,13 @@ func (e *ECSClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSS
 		res = append(res, gRes.result...)
 	}
 
-	log.Debugf("Got %d services on cluster %s", len(res), cluster.Name)
+	logger.Debugf("Got %d services", len(res))
 	return res, nil
 }
 
 // GetClusterContainerInstances will return all the container instances from a cluster
 func (e *ECSClient) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*types.ECSContainerInstance, error) {
+	logger := e.logger.With("cluster", cluster.Name)
 
 	// Get list of container instances
 	ciArns := []*string{}
@@ -208,7 +325,7 @@ func (e *ECSClient) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*
 		MaxResults: aws.Int64(e.apiMaxResults),
 	}
 
-	log.Debugf("Getting container instance list for cluster: %s", cluster.Name)
+	logger.With("operation", "ListContainerInstances").Debugf("Getting container instance list")
 	for {
 		resp, err := e.client.ListContainerInstances(params)
 		if err != nil {
@@ -228,7 +345,7 @@ func (e *ECSClient) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*
 	ciDescs := []*types.ECSContainerInstance{}
 	// If no container instances then nothing to fetch
 	if len(ciArns) == 0 {
-		log.Debugf("Ignoring container instance fetching, no services in cluster: %s", cluster.Name)
+		logger.Debugf("Ignoring container instance fetching, no container instances in cluster")
 		return ciDescs, nil
 	}
 
@@ -238,7 +355,7 @@ func (e *ECSClient) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*
 		ContainerInstances: ciArns,
 	}
 
-	log.Debugf("Getting container instance descriptions for cluster: %s", cluster.Name)
+	logger.With("operation", "DescribeContainerInstances").Debugf("Getting container instance descriptions")
 	resp, err := e.client.DescribeContainerInstances(params2)
 	if err != nil {
 		return nil, err
@@ -254,12 +371,655 @@ func (e *ECSClient) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*
 			InstanceID: aws.StringValue(c.Ec2InstanceId),
 			AgentConn:  aws.BoolValue(c.AgentConnected),
 			Active:     act,
+			Status:     aws.StringValue(c.Status),
 			PendingT:   aws.Int64Value(c.PendingTasksCount),
 		}
 		ciDescs = append(ciDescs, cd)
 	}
 
-	log.Debugf("Got %d container instance on cluster %s", len(ciDescs), cluster.Name)
+	logger.Debugf("Got %d container instances", len(ciDescs))
 
 	return ciDescs, nil
 }
+
+// GetInstances will return the EC2 instances of the IDs, the instances are cached by ID so only
+// the new ones are described. The instances that don't exist anymore are ignored
+func (e *ECSClient) GetInstances(instanceIDs []string) ([]*types.EC2Instance, error) {
+	now := time.Now()
+	res, missing := e.instances.get(instanceIDs, now)
+	if len(missing) == 0 {
+		return res, nil
+	}
+
+	// Filtering by ID instead of asking for the IDs doesn't fail with the terminated instances
+	described := []*types.EC2Instance{}
+	for st := 0; st < len(missing); st += maxInstancesAPI {
+		end := st + maxInstancesAPI
+		if end > len(missing) {
+			end = len(missing)
+		}
+		params := &ec2.DescribeInstancesInput{
+			Filters: []*ec2.Filter{
+				&ec2.Filter{Name: aws.String("instance-id"), Values: aws.StringSlice(missing[st:end])},
+			},
+		}
+
+		e.logger.With("operation", "DescribeInstances").Debugf("Getting %d instance descriptions", end-st)
+		for {
+			resp, err := e.ec2.DescribeInstances(params)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, r := range resp.Reservations {
+				for _, i := range r.Instances {
+					lifecycle := aws.StringValue(i.InstanceLifecycle)
+					if lifecycle == "" {
+						lifecycle = types.InstanceLifecycleOnDemand
+					}
+					var az string
+					if i.Placement != nil {
+						az = aws.StringValue(i.Placement.AvailabilityZone)
+					}
+					described = append(described, &types.EC2Instance{
+						ID:               aws.StringValue(i.InstanceId),
+						Type:             aws.StringValue(i.InstanceType),
+						AvailabilityZone: az,
+						Lifecycle:        lifecycle,
+						LaunchTime:       aws.TimeValue(i.LaunchTime),
+						PrivateIP:        aws.StringValue(i.PrivateIpAddress),
+					})
+				}
+			}
+
+			if resp.NextToken == nil || aws.StringValue(resp.NextToken) == "" {
+				break
+			}
+			params.NextToken = resp.NextToken
+		}
+	}
+	e.instances.set(described, now)
+
+	// Terminated instances are returned for a while, the ones not returned don't exist anymore
+	got := map[string]bool{}
+	for _, i := range described {
+		got[i.ID] = true
+	}
+	notFound := []string{}
+	for _, id := range missing {
+		if !got[id] {
+			notFound = append(notFound, id)
+		}
+	}
+	e.instances.setNotFound(notFound, now)
+
+	e.logger.Debugf("Got %d instances, %d from cache", len(res)+len(described), len(res))
+	return append(res, described...), nil
+}
+
+// GetAutoScalingGroups will return the Auto Scaling groups of the EC2 instances, the instances
+// that are not on an Auto Scaling group are ignored
+func (e *ECSClient) GetAutoScalingGroups(instanceIDs []string) ([]*types.AutoScalingGroup, error) {
+	// Get the Auto Scaling group names of the instances
+	names := []string{}
+	seen := map[string]bool{}
+	for st := 0; st < len(instanceIDs); st += maxAutoScalingAPI {
+		end := st + maxAutoScalingAPI
+		if end > len(instanceIDs) {
+			end = len(instanceIDs)
+		}
+		params := &autoscaling.DescribeAutoScalingInstancesInput{
+			InstanceIds: aws.StringSlice(instanceIDs[st:end]),
+		}
+
+		e.logger.With("operation", "DescribeAutoScalingInstances").Debugf("Getting the Auto Scaling groups of %d instances", end-st)
+		for {
+			resp, err := e.autoscaling.DescribeAutoScalingInstances(params)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, i := range resp.AutoScalingInstances {
+				name := aws.StringValue(i.AutoScalingGroupName)
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+
+			if resp.NextToken == nil || aws.StringValue(resp.NextToken) == "" {
+				break
+			}
+			params.NextToken = resp.NextToken
+		}
+	}
+
+	return e.describeAutoScalingGroups(names)
+}
+
+// GetTaggedAutoScalingGroups will return the Auto Scaling groups that have the tag key with the value
+func (e *ECSClient) GetTaggedAutoScalingGroups(key, value string) ([]*types.AutoScalingGroup, error) {
+	// Get the Auto Scaling group names of the tag
+	names := []string{}
+	seen := map[string]bool{}
+	params := &autoscaling.DescribeTagsInput{
+		Filters: []*autoscaling.Filter{
+			&autoscaling.Filter{Name: aws.String("key"), Values: aws.StringSlice([]string{key})},
+			&autoscaling.Filter{Name: aws.String("value"), Values: aws.StringSlice([]string{value})},
+		},
+	}
+
+	e.logger.With("operation", "DescribeTags").Debugf("Getting the Auto Scaling groups tagged with %s=%s", key, value)
+	for {
+		resp, err := e.autoscaling.DescribeTags(params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range resp.Tags {
+			if aws.StringValue(t.Key) != key || aws.StringValue(t.Value) != value {
+				continue
+			}
+			name := aws.StringValue(t.ResourceId)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+
+		if resp.NextToken == nil || aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+
+	return e.describeAutoScalingGroups(names)
+}
+
+// describeAutoScalingGroups returns the descriptions of the Auto Scaling groups
+func (e *ECSClient) describeAutoScalingGroups(names []string) ([]*types.AutoScalingGroup, error) {
+	res := []*types.AutoScalingGroup{}
+	for st := 0; st < len(names); st += maxAutoScalingAPI {
+		end := st + maxAutoScalingAPI
+		if end > len(names) {
+			end = len(names)
+		}
+		params := &autoscaling.DescribeAutoScalingGroupsInput{
+			AutoScalingGroupNames: aws.StringSlice(names[st:end]),
+		}
+
+		e.logger.With("operation", "DescribeAutoScalingGroups").Debugf("Getting %d Auto Scaling group descriptions", end-st)
+		for {
+			resp, err := e.autoscaling.DescribeAutoScalingGroups(params)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, g := range resp.AutoScalingGroups {
+				asg := &types.AutoScalingGroup{
+					ID:              aws.StringValue(g.AutoScalingGroupARN),
+					Name:            aws.StringValue(g.AutoScalingGroupName),
+					DesiredCapacity: aws.Int64Value(g.DesiredCapacity),
+					MinSize:         aws.Int64Value(g.MinSize),
+					MaxSize:         aws.Int64Value(g.MaxSize),
+					Instances:       []*types.AutoScalingInstance{},
+				}
+				for _, i := range g.Instances {
+					asg.Instances = append(asg.Instances, &types.AutoScalingInstance{
+						InstanceID:     aws.StringValue(i.InstanceId),
+						LifecycleState: aws.StringValue(i.LifecycleState),
+					})
+				}
+				res = append(res, asg)
+			}
+
+			if resp.NextToken == nil || aws.StringValue(resp.NextToken) == "" {
+				break
+			}
+			params.NextToken = resp.NextToken
+		}
+	}
+
+	e.logger.Debugf("Got %d Auto Scaling groups", len(res))
+	return res, nil
+}
+
+// GetServiceScalableTargets will return the Application Auto Scaling targets of the desired count of the
+// cluster services, the services without a scalable target are ignored
+func (e *ECSClient) GetServiceScalableTargets(cluster *types.ECSCluster, services []*types.ECSService) ([]*types.ScalableTarget, error) {
+	logger := e.logger.With("cluster", cluster.Name)
+
+	// The scalable targets are identified by the cluster and service names
+	ids := make([]string, 0, len(services))
+	names := map[string]string{}
+	for _, s := range services {
+		id := fmt.Sprintf("service/%s/%s", cluster.Name, s.Name)
+		ids = append(ids, id)
+		names[id] = s.Name
+	}
+
+	res := []*types.ScalableTarget{}
+	for st := 0; st < len(ids); st += maxScalableAPI {
+		end := st + maxScalableAPI
+		if end > len(ids) {
+			end = len(ids)
+		}
+		params := &applicationautoscaling.DescribeScalableTargetsInput{
+			ServiceNamespace:  aws.String(applicationautoscaling.ServiceNamespaceEcs),
+			ScalableDimension: aws.String(applicationautoscaling.ScalableDimensionEcsServiceDesiredCount),
+			ResourceIds:       aws.StringSlice(ids[st:end]),
+		}
+
+		logger.With("operation", "DescribeScalableTargets").Debugf("Getting the scalable targets of %d services", end-st)
+		for {
+			resp, err := e.appScaling.DescribeScalableTargets(params)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, t := range resp.ScalableTargets {
+				id := aws.StringValue(t.ResourceId)
+				res = append(res, &types.ScalableTarget{
+					ResourceID:  id,
+					ServiceName: names[id],
+					MinCapacity: aws.Int64Value(t.MinCapacity),
+					MaxCapacity: aws.Int64Value(t.MaxCapacity),
+				})
+			}
+
+			if resp.NextToken == nil || aws.StringValue(resp.NextToken) == "" {
+				break
+			}
+			params.NextToken = resp.NextToken
+		}
+	}
+
+	logger.Debugf("Got %d service scalable targets", len(res))
+	return res, nil
+}
+
+// GetTargetHealth will return the health of the targets of the load balancer target groups
+func (e *ECSClient) GetTargetHealth(targetGroupARNs []string) ([]*types.TargetHealth, error) {
+	res := []*types.TargetHealth{}
+
+	// The target health can only be described by target group
+	for _, tg := range targetGroupARNs {
+		params := &elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: aws.String(tg),
+		}
+
+		e.logger.With("operation", "DescribeTargetHealth").Debugf("Getting target group health")
+		resp, err := e.elbv2.DescribeTargetHealth(params)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range resp.TargetHealthDescriptions {
+			th := &types.TargetHealth{TargetGroupARN: tg}
+			if d.Target != nil {
+				th.TargetID = aws.StringValue(d.Target.Id)
+				th.Port = aws.Int64Value(d.Target.Port)
+			}
+			if d.TargetHealth != nil {
+				th.State = aws.StringValue(d.TargetHealth.State)
+				th.Reason = aws.StringValue(d.TargetHealth.Reason)
+			}
+			res = append(res, th)
+		}
+	}
+
+	e.logger.Debugf("Got %d targets of %d target groups", len(res), len(targetGroupARNs))
+	return res, nil
+}
+
+// cwQuery is a CloudWatch metric of a cluster or service
+type cwQuery struct {
+	name    string
+	service string
+}
+
+// GetCloudWatchMetrics will return the average on the last complete period of the CloudWatch utilization and
+// reservation metrics of a cluster and the utilization metrics of its services. The period ends delay ago so
+// CloudWatch has the data, the datapoints are cached until the period changes so scraping more often than the
+// period doesn't make API calls. The metrics without datapoints are ignored
+func (e *ECSClient) GetCloudWatchMetrics(cluster *types.ECSCluster, services []*types.ECSService, period, delay time.Duration) ([]*types.CloudWatchMetric, error) {
+	logger := e.logger.With("cluster", cluster.Name)
+
+	queries := []cwQuery{}
+	for _, m := range cloudWatchClusterMetrics {
+		queries = append(queries, cwQuery{name: m})
+	}
+	for _, s := range services {
+		for _, m := range cloudWatchServiceMetrics {
+			queries = append(queries, cwQuery{name: m, service: s.Name})
+		}
+	}
+
+	now := time.Now()
+	e.statistics.purge(period, now)
+	endTime := now.Add(-delay).Truncate(period)
+	startTime := endTime.Add(-period)
+
+	// Get the datapoints in blocks of parallel calls
+	res := []*types.CloudWatchMetric{}
+	var calls int
+	for st := 0; st < len(queries); st += maxCloudWatchAPI {
+		end := st + maxCloudWatchAPI
+		if end > len(queries) {
+			end = len(queries)
+		}
+
+		type cwRes struct {
+			metric *types.CloudWatchMetric
+			err    error
+		}
+		resC := make(chan cwRes)
+		totalGr := 0
+		for _, q := range queries[st:end] {
+			key := fmt.Sprintf("%s/%s/%s/%d", cluster.ID, q.service, q.name, endTime.Unix())
+			if d, ok := e.statistics.get(key, period, now); ok {
+				if m, _ := d.value.(*types.CloudWatchMetric); m != nil {
+					res = append(res, m)
+				}
+				continue
+			}
+
+			totalGr++
+			calls++
+			go func(q cwQuery, key string) {
+				dims := []*cloudwatch.Dimension{
+					&cloudwatch.Dimension{Name: aws.String("ClusterName"), Value: aws.String(cluster.Name)},
+				}
+				if q.service != "" {
+					dims = append(dims, &cloudwatch.Dimension{Name: aws.String("ServiceName"), Value: aws.String(q.service)})
+				}
+				params := &cloudwatch.GetMetricStatisticsInput{
+					Namespace:  aws.String(cloudWatchNS),
+					MetricName: aws.String(q.name),
+					Dimensions: dims,
+					StartTime:  aws.Time(startTime),
+					EndTime:    aws.Time(endTime),
+					Period:     aws.Int64(int64(period / time.Second)),
+					Statistics: aws.StringSlice([]string{cloudwatch.StatisticAverage}),
+				}
+				resp, err := e.cloudwatch.GetMetricStatistics(params)
+				if err != nil {
+					resC <- cwRes{nil, err}
+					return
+				}
+
+				// Use the latest datapoint, nil if there isn't any
+				var m *types.CloudWatchMetric
+				for _, d := range resp.Datapoints {
+					ts := aws.TimeValue(d.Timestamp)
+					if m == nil || ts.After(m.Timestamp) {
+						m = &types.CloudWatchMetric{
+							Name:        q.name,
+							ServiceName: q.service,
+							Value:       aws.Float64Value(d.Average),
+							Timestamp:   ts,
+						}
+					}
+				}
+				e.statistics.set(key, m, now)
+				resC <- cwRes{m, nil}
+			}(q, key)
+		}
+
+		// Get all results
+		var err error
+		for i := 0; i < totalGr; i++ {
+			r := <-resC
+			if r.err != nil {
+				err = r.err
+				continue
+			}
+			if r.metric != nil {
+				res = append(res, r.metric)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logger.With("operation", "GetMetricStatistics").Debugf("Got %d CloudWatch metrics of %d, %d from cache", len(res), len(queries), len(queries)-calls)
+	return res, nil
+}
+
+// GetTaskDefinitionImages will return the container images of the task definitions. The task definitions don't
+// change so they are cached, the images of the ECR repositories of the region get the digest and push date
+// from ECR, the images that can't be found on ECR are returned without them
+func (e *ECSClient) GetTaskDefinitionImages(taskDefinitionARNs []string) ([]*types.ContainerImage, error) {
+	now := time.Now()
+	e.taskDefs.purge(taskDefCacheTTL, now)
+	res := []*types.ContainerImage{}
+	for _, arn := range taskDefinitionARNs {
+		if d, ok := e.taskDefs.get(arn, taskDefCacheTTL, now); ok {
+			res = append(res, copyImages(d.value.([]*types.ContainerImage))...)
+			continue
+		}
+
+		params := &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: aws.String(arn),
+		}
+		e.logger.With("operation", "DescribeTaskDefinition").Debugf("Getting task definition description")
+		resp, err := e.client.DescribeTaskDefinition(params)
+		if err != nil {
+			return nil, err
+		}
+
+		cis := []*types.ContainerImage{}
+		if resp.TaskDefinition != nil {
+			for _, c := range resp.TaskDefinition.ContainerDefinitions {
+				image := aws.StringValue(c.Image)
+				repo, tag, digest := parseImage(image)
+				cis = append(cis, &types.ContainerImage{
+					TaskDefinition: arn,
+					Container:      aws.StringValue(c.Name),
+					Image:          image,
+					Repository:     repo,
+					Tag:            tag,
+					Digest:         digest,
+				})
+			}
+		}
+		e.taskDefs.set(arn, cis, now)
+		res = append(res, copyImages(cis)...)
+	}
+
+	if err := e.describeECRImages(res); err != nil {
+		return nil, err
+	}
+
+	e.logger.Debugf("Got %d container images of %d task definitions", len(res), len(taskDefinitionARNs))
+	return res, nil
+}
+
+// ecrImage is the cached data of an ECR image
+type ecrImage struct {
+	digest   string
+	pushedAt time.Time
+}
+
+// describeECRImages sets the digest and push date of the images of the ECR repositories of the region, the
+// images are described by repository. The images are cached by digest and the digests of the tags for a
+// short time, so only the new images and tags are described on each scrape
+func (e *ECSClient) describeECRImages(images []*types.ContainerImage) error {
+	type ecrRepo struct {
+		registry, name string
+	}
+	now := time.Now()
+	e.ecrImages.purge(ecrDigestCacheTTL, now)
+	repos := []ecrRepo{}
+	byRepo := map[ecrRepo][]*types.ContainerImage{}
+	for _, i := range images {
+		parts := strings.SplitN(i.Repository, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		m := ecrRegistryRE.FindStringSubmatch(parts[0])
+		if m == nil || m[2] != e.region {
+			continue
+		}
+		if e.cachedECRImage(i, now) {
+			continue
+		}
+		r := ecrRepo{registry: m[1], name: parts[1]}
+		if _, ok := byRepo[r]; !ok {
+			repos = append(repos, r)
+		}
+		byRepo[r] = append(byRepo[r], i)
+	}
+
+	for _, r := range repos {
+		ids := []*ecr.ImageIdentifier{}
+		seen := map[string]bool{}
+		for _, i := range byRepo[r] {
+			id := &ecr.ImageIdentifier{}
+			key := i.Digest
+			if i.Digest != "" {
+				id.ImageDigest = aws.String(i.Digest)
+			} else {
+				id.ImageTag = aws.String(i.Tag)
+				key = "tag:" + i.Tag
+			}
+			if !seen[key] {
+				seen[key] = true
+				ids = append(ids, id)
+			}
+		}
+
+		details := []*ecr.ImageDetail{}
+		for st := 0; st < len(ids); st += maxImagesAPI {
+			end := st + maxImagesAPI
+			if end > len(ids) {
+				end = len(ids)
+			}
+			ds, err := e.describeRepositoryImages(r.registry, r.name, ids[st:end])
+			if err != nil {
+				return err
+			}
+			details = append(details, ds...)
+		}
+
+		for _, d := range details {
+			digest := aws.StringValue(d.ImageDigest)
+			img := &ecrImage{digest: digest, pushedAt: aws.TimeValue(d.ImagePushedAt)}
+			repository := byRepo[r][0].Repository
+			e.ecrImages.set(repository+"@"+digest, img, now)
+			tags := map[string]bool{}
+			for _, t := range d.ImageTags {
+				tags[aws.StringValue(t)] = true
+				e.ecrImages.set(repository+":"+aws.StringValue(t), img, now)
+			}
+			for _, i := range byRepo[r] {
+				if i.Digest == digest || (i.Digest == "" && tags[i.Tag]) {
+					i.Digest = digest
+					i.PushedAt = aws.TimeValue(d.ImagePushedAt)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cachedECRImage sets the digest and push date of the image if it's cached, the digests
+// are refreshed when used so the images of the running services are not described again
+func (e *ECSClient) cachedECRImage(i *types.ContainerImage, now time.Time) bool {
+	if i.Digest != "" {
+		key := i.Repository + "@" + i.Digest
+		d, ok := e.ecrImages.get(key, ecrDigestCacheTTL, now)
+		if !ok {
+			return false
+		}
+		e.ecrImages.set(key, d.value, now)
+		i.PushedAt = d.value.(*ecrImage).pushedAt
+		return true
+	}
+
+	d, ok := e.ecrImages.get(i.Repository+":"+i.Tag, ecrTagCacheTTL, now)
+	if !ok {
+		return false
+	}
+	img := d.value.(*ecrImage)
+	i.Digest = img.digest
+	i.PushedAt = img.pushedAt
+	return true
+}
+
+// describeRepositoryImages returns the details of the images of an ECR repository, the images that don't exist
+// anymore are ignored
+func (e *ECSClient) describeRepositoryImages(registry, repository string, ids []*ecr.ImageIdentifier) ([]*ecr.ImageDetail, error) {
+	params := &ecr.DescribeImagesInput{
+		RegistryId:     aws.String(registry),
+		RepositoryName: aws.String(repository),
+		ImageIds:       ids,
+	}
+
+	e.logger.With("operation", "DescribeImages").Debugf("Getting %d image descriptions of %s", len(ids), repository)
+	res := []*ecr.ImageDetail{}
+	for {
+		resp, err := e.ecr.DescribeImages(params)
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if !ok {
+				return nil, err
+			}
+			switch {
+			case aerr.Code() == "RepositoryNotFoundException" || (aerr.Code() == "ImageNotFoundException" && len(ids) == 1):
+				e.logger.Debugf("Ignoring the missing images of %s: %v", repository, err)
+				return res, nil
+			case aerr.Code() == "AccessDeniedException":
+				// The repositories of other accounts can't be described without a repository policy
+				e.logger.Warnf("Ignoring the images of %s of registry %s: %v", repository, registry, err)
+				return res, nil
+			case aerr.Code() == "ImageNotFoundException":
+				// A missing image fails the whole call, describe the images one by one
+				for _, id := range ids {
+					ds, err := e.describeRepositoryImages(registry, repository, []*ecr.ImageIdentifier{id})
+					if err != nil {
+						return nil, err
+					}
+					res = append(res, ds...)
+				}
+				return res, nil
+			}
+			return nil, err
+		}
+		res = append(res, resp.ImageDetails...)
+
+		if resp.NextToken == nil || aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+	return res, nil
+}
+
+// copyImages returns a copy of the container images so the cached ones are not modified
+func copyImages(images []*types.ContainerImage) []*types.ContainerImage {
+	res := make([]*types.ContainerImage, 0, len(images))
+	for _, i := range images {
+		c := *i
+		res = append(res, &c)
+	}
+	return res
+}
+
+// parseImage returns the repository (with the registry), tag and digest of an image reference, the images
+// without tag or digest use the latest tag
+func parseImage(image string) (repository, tag, digest string) {
+	repository = image
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository, digest = repository[:i], repository[i+1:]
+	}
+	// The tag is after the last colon if it's not part of the registry port
+	if i := strings.LastIndex(repository, ":"); i >= 0 && !strings.Contains(repository[i:], "/") {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	if tag == "" && digest == "" {
+		tag = "latest"
+	}
+	return repository, tag, digest
+}
@@ -1,10 +1,31 @@
 package collector
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling/applicationautoscalingiface"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
 	"github.com/golang/mock/gomock"
+	"github.com/slok/ecs-exporter/log"
 	awsMock "github.com/slok/ecs-exporter/mock/aws"
 	"github.com/slok/ecs-exporter/mock/aws/sdk"
 	"github.com/slok/ecs-exporter/types"
@@ -62,6 +83,7 @@ func TestGetClusters(t *testing.T) {
 
 		e := &ECSClient{
 			client: mockECS,
+			logger: log.Base(),
 		}
 
 		cs, err := e.GetClusters()
@@ -117,6 +139,24 @@ func TestGetClusterServices(t *testing.T) {
 			},
 			true, true, true,
 		},
+		{
+			[]*types.ECSService{
+				&types.ECSService{ID: "s1", Name: "service1", PendingT: 1, RunningT: 9, DesiredT: 10, TargetGroups: []string{"tg1", "tg2"}},
+				&types.ECSService{ID: "s2", Name: "service2", PendingT: 5, RunningT: 5, DesiredT: 10},
+			},
+			false, false, false,
+		},
+		{
+			[]*types.ECSService{
+				&types.ECSService{ID: "s1", Name: "service1", PendingT: 1, RunningT: 9, DesiredT: 10, Status: types.ServiceStatusActive, CreatedAt: time.Unix(1500000000, 0).UTC(),
+					Deployments: []*types.ECSDeployment{
+						&types.ECSDeployment{ID: "d2", Status: types.DeploymentStatusPrimary, TaskDefinition: "td:2", DesiredT: 10, PendingT: 1, RunningT: 4, CreatedAt: time.Unix(1500000200, 0).UTC()},
+						&types.ECSDeployment{ID: "d1", Status: types.DeploymentStatusActive, TaskDefinition: "td:1", DesiredT: 0, RunningT: 5, CreatedAt: time.Unix(1500000100, 0).UTC()},
+					},
+				},
+			},
+			false, false, false,
+		},
 		{
 			[]*types.ECSService{},
 			false, false, false,
@@ -139,6 +179,7 @@ func TestGetClusterServices(t *testing.T) {
 
 		e := &ECSClient{
 			client: mockECS,
+			logger: log.Base(),
 		}
 
 		services, err := e.GetClusterServices(&types.ECSCluster{ID: "t1", Name: "test1"})
@@ -181,21 +222,21 @@ func TestGetClusterContainerInstances(t *testing.T) {
 		},
 		{
 			[]*types.ECSContainerInstance{
-				&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, PendingT: 0},
-				&types.ECSContainerInstance{ID: "ci1", InstanceID: "i-00000000000000001", AgentConn: true, Active: false, PendingT: 5},
-				&types.ECSContainerInstance{ID: "ci2", InstanceID: "i-00000000000000002", AgentConn: false, Active: true, PendingT: 0},
+				&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, Status: types.ContainerInstanceStatusActive, PendingT: 0},
+				&types.ECSContainerInstance{ID: "ci1", InstanceID: "i-00000000000000001", AgentConn: true, Active: false, Status: types.ContainerInstanceStatusDraining, PendingT: 5},
+				&types.ECSContainerInstance{ID: "ci2", InstanceID: "i-00000000000000002", AgentConn: false, Active: true, Status: types.ContainerInstanceStatusActive, PendingT: 0},
 			},
 			false, false, false,
 		},
 		{
 			[]*types.ECSContainerInstance{
-				&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, PendingT: 0},
+				&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, Status: types.ContainerInstanceStatusActive, PendingT: 0},
 			},
 			true, false, true,
 		},
 		{
 			[]*types.ECSContainerInstance{
-				&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, PendingT: 0},
+				&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, Status: types.ContainerInstanceStatusActive, PendingT: 0},
 			},
 			false, true, true,
 		},
@@ -217,6 +258,7 @@ func TestGetClusterContainerInstances(t *testing.T) {
 
 		e := &ECSClient{
 			client: mockECS,
+			logger: log.Base(),
 		}
 
 		cis, err := e.GetClusterContainerInstances(&types.ECSCluster{ID: "t1", Name: "test1"})
@@ -245,3 +287,808 @@ func TestGetClusterContainerInstances(t *testing.T) {
 
 	}
 }
+
+func TestGetClusterServicesFiltered(t *testing.T) {
+	arns := []string{
+		"arn:aws:ecs:eu-west-1:111111111111:service/api-prod",
+		"arn:aws:ecs:eu-west-1:111111111111:service/cluster1/api-staging",
+		"arn:aws:ecs:eu-west-1:111111111111:service/cluster1/worker-prod",
+	}
+	tests := []struct {
+		filter        ServiceFilter
+		expectedNames []string
+	}{
+		{ServiceFilter{}, []string{"api-prod", "api-staging", "worker-prod"}},
+		{ServiceFilter{Include: []string{"-prod$"}}, []string{"api-prod", "worker-prod"}},
+		{ServiceFilter{Exclude: []string{"^api-"}}, []string{"worker-prod"}},
+		{ServiceFilter{Include: []string{"^nothing$"}}, []string{}},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockECS := sdk.NewMockECSAPI(ctrl)
+		awsMock.MockECSListServices(t, mockECS, false, arns...)
+
+		// Only the filtered services should be described
+		described := []string{}
+		mockECS.EXPECT().DescribeServices(gomock.Any()).Do(func(input interface{}) {
+			for _, s := range input.(*ecs.DescribeServicesInput).Services {
+				described = append(described, serviceNameFromARN(aws.StringValue(s)))
+			}
+		}).AnyTimes().Return(&ecs.DescribeServicesOutput{}, nil)
+
+		m, err := newServiceMatcher(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := &ECSClient{
+			client:        mockECS,
+			logger:        log.Base(),
+			serviceFilter: m,
+		}
+
+		if _, err := e.GetClusterServices(&types.ECSCluster{ID: "c1", Name: "cluster1"}); err != nil {
+			t.Errorf("\n- %v\n-  Shouldn't return an error, it did: %v", test, err)
+		}
+		if !reflect.DeepEqual(described, test.expectedNames) {
+			t.Errorf("\n- %v\n-  Described services are wrong, want: %v; got: %v", test, test.expectedNames, described)
+		}
+	}
+}
+
+func TestGetClusterServicesStaleOnError(t *testing.T) {
+	// More services than a single DescribeServices call can describe so there are several calls
+	arns := []string{}
+	for i := 0; i < maxServicesAPI*3; i++ {
+		arns = append(arns, fmt.Sprintf("arn:aws:ecs:eu-west-1:111111111111:service/service%d", i))
+	}
+	cached := []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1"}}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockECS := sdk.NewMockECSAPI(ctrl)
+	awsMock.MockECSListServices(t, mockECS, false, arns...)
+	// The SDK doesn't guarantee an output on errors
+	mockECS.EXPECT().DescribeServices(gomock.Any()).AnyTimes().Return(nil, errors.New("DescribeServices wrong!"))
+
+	e := &ECSClient{client: mockECS, logger: log.Base()}
+	c := newDataCache()
+	c.set("services/c1", cached, time.Now().Add(-10*time.Second))
+	s := newScrape("eu-west-1", e, c, time.Minute, log.Base())
+
+	done := make(chan struct{})
+	var ss []*types.ECSService
+	var err error
+	go func() {
+		ss, err = s.services(&types.ECSCluster{ID: "c1", Name: "cluster1"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Getting the services shouldn't block")
+	}
+	if err == nil {
+		t.Errorf("Getting the services should return an error, it didn't")
+	}
+	if !reflect.DeepEqual(ss, cached) {
+		t.Errorf("Services should be the stale ones, want: %v; got: %v", cached, ss)
+	}
+	if _, ok := s.staleness("c1"); !ok {
+		t.Errorf("Services should be stale, they weren't")
+	}
+}
+
+// ec2TestClient is an EC2 API that returns the instances of the filter, the other methods are not implemented
+type ec2TestClient struct {
+	ec2iface.EC2API
+	instances map[string]*ec2.Instance
+	calls     int
+	err       error
+}
+
+func (c *ec2TestClient) DescribeInstances(params *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	is := []*ec2.Instance{}
+	for _, id := range params.Filters[0].Values {
+		if i, ok := c.instances[aws.StringValue(id)]; ok {
+			is = append(is, i)
+		}
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{&ec2.Reservation{Instances: is}}}, nil
+}
+
+func TestGetInstances(t *testing.T) {
+	launch := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := &ec2TestClient{
+		instances: map[string]*ec2.Instance{
+			"i-1": &ec2.Instance{
+				InstanceId:       aws.String("i-1"),
+				InstanceType:     aws.String("m4.large"),
+				Placement:        &ec2.Placement{AvailabilityZone: aws.String("eu-west-1a")},
+				LaunchTime:       aws.Time(launch),
+				PrivateIpAddress: aws.String("10.0.0.1"),
+			},
+			"i-2": &ec2.Instance{
+				InstanceId:        aws.String("i-2"),
+				InstanceType:      aws.String("c4.xlarge"),
+				InstanceLifecycle: aws.String("spot"),
+				Placement:         &ec2.Placement{AvailabilityZone: aws.String("eu-west-1b")},
+				LaunchTime:        aws.Time(launch),
+				PrivateIpAddress:  aws.String("10.0.0.2"),
+			},
+		},
+	}
+	e := &ECSClient{
+		ec2:       c,
+		logger:    log.Base(),
+		instances: newInstanceCache(time.Hour, 5*time.Minute),
+	}
+
+	tests := []struct {
+		ids           []string
+		expected      map[string]types.EC2Instance
+		expectedCalls int
+	}{
+		{
+			[]string{"i-1", "i-2", "i-3"},
+			map[string]types.EC2Instance{
+				"i-1": types.EC2Instance{ID: "i-1", Type: "m4.large", AvailabilityZone: "eu-west-1a", Lifecycle: "on-demand", LaunchTime: launch, PrivateIP: "10.0.0.1"},
+				"i-2": types.EC2Instance{ID: "i-2", Type: "c4.xlarge", AvailabilityZone: "eu-west-1b", Lifecycle: "spot", LaunchTime: launch, PrivateIP: "10.0.0.2"},
+			},
+			1,
+		},
+		// Cached instances are not described again
+		{
+			[]string{"i-1", "i-2"},
+			map[string]types.EC2Instance{
+				"i-1": types.EC2Instance{ID: "i-1", Type: "m4.large", AvailabilityZone: "eu-west-1a", Lifecycle: "on-demand", LaunchTime: launch, PrivateIP: "10.0.0.1"},
+				"i-2": types.EC2Instance{ID: "i-2", Type: "c4.xlarge", AvailabilityZone: "eu-west-1b", Lifecycle: "spot", LaunchTime: launch, PrivateIP: "10.0.0.2"},
+			},
+			1,
+		},
+		// Instances that weren't found are not described again
+		{
+			[]string{"i-2", "i-3"},
+			map[string]types.EC2Instance{
+				"i-2": types.EC2Instance{ID: "i-2", Type: "c4.xlarge", AvailabilityZone: "eu-west-1b", Lifecycle: "spot", LaunchTime: launch, PrivateIP: "10.0.0.2"},
+			},
+			1,
+		},
+		{
+			[]string{"i-3", "i-4"},
+			map[string]types.EC2Instance{},
+			2,
+		},
+	}
+
+	for _, test := range tests {
+		is, err := e.GetInstances(test.ids)
+		if err != nil {
+			t.Errorf("\n- %v\n- Getting instances shouldn't error: %v", test, err)
+			continue
+		}
+		got := map[string]types.EC2Instance{}
+		for _, i := range is {
+			got[i.ID] = *i
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("\n- %v\n- Instances are wrong, want: %v; got: %v", test, test.expected, got)
+		}
+		if c.calls != test.expectedCalls {
+			t.Errorf("\n- %v\n- API calls are wrong, want: %d; got: %d", test, test.expectedCalls, c.calls)
+		}
+	}
+
+	// Errors are returned
+	c.err = errors.New("wanted")
+	if _, err := e.GetInstances([]string{"i-5"}); err == nil {
+		t.Errorf("Getting instances should error, it didn't")
+	}
+}
+
+// autoScalingTestClient is an Auto Scaling API with groups, the other methods are not implemented
+type autoScalingTestClient struct {
+	autoscalingiface.AutoScalingAPI
+	groups []*autoscaling.Group
+	tags   []*autoscaling.TagDescription
+}
+
+func (c *autoScalingTestClient) DescribeTags(params *autoscaling.DescribeTagsInput) (*autoscaling.DescribeTagsOutput, error) {
+	res := []*autoscaling.TagDescription{}
+	for _, t := range c.tags {
+		matches := true
+		for _, f := range params.Filters {
+			v := aws.StringValue(t.Value)
+			if aws.StringValue(f.Name) == "key" {
+				v = aws.StringValue(t.Key)
+			}
+			if aws.StringValue(f.Values[0]) != v {
+				matches = false
+			}
+		}
+		if matches {
+			res = append(res, t)
+		}
+	}
+	return &autoscaling.DescribeTagsOutput{Tags: res}, nil
+}
+
+func (c *autoScalingTestClient) DescribeAutoScalingInstances(params *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	res := []*autoscaling.InstanceDetails{}
+	for _, id := range params.InstanceIds {
+		for _, g := range c.groups {
+			for _, i := range g.Instances {
+				if aws.StringValue(i.InstanceId) == aws.StringValue(id) {
+					res = append(res, &autoscaling.InstanceDetails{InstanceId: id, AutoScalingGroupName: g.AutoScalingGroupName})
+				}
+			}
+		}
+	}
+	return &autoscaling.DescribeAutoScalingInstancesOutput{AutoScalingInstances: res}, nil
+}
+
+func (c *autoScalingTestClient) DescribeAutoScalingGroups(params *autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	res := []*autoscaling.Group{}
+	for _, name := range params.AutoScalingGroupNames {
+		for _, g := range c.groups {
+			if aws.StringValue(g.AutoScalingGroupName) == aws.StringValue(name) {
+				res = append(res, g)
+			}
+		}
+	}
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: res}, nil
+}
+
+func TestGetAutoScalingGroups(t *testing.T) {
+	c := &autoScalingTestClient{
+		groups: []*autoscaling.Group{
+			&autoscaling.Group{
+				AutoScalingGroupARN:  aws.String("arn:asg1"),
+				AutoScalingGroupName: aws.String("asg1"),
+				DesiredCapacity:      aws.Int64(3),
+				MinSize:              aws.Int64(1),
+				MaxSize:              aws.Int64(5),
+				Instances: []*autoscaling.Instance{
+					&autoscaling.Instance{InstanceId: aws.String("i-1"), LifecycleState: aws.String("InService")},
+					&autoscaling.Instance{InstanceId: aws.String("i-2"), LifecycleState: aws.String("Pending")},
+				},
+			},
+			&autoscaling.Group{
+				AutoScalingGroupARN:  aws.String("arn:asg2"),
+				AutoScalingGroupName: aws.String("asg2"),
+				Instances: []*autoscaling.Instance{
+					&autoscaling.Instance{InstanceId: aws.String("i-3"), LifecycleState: aws.String("InService")},
+				},
+			},
+		},
+	}
+	e := &ECSClient{
+		autoscaling: c,
+		logger:      log.Base(),
+	}
+
+	tests := []struct {
+		ids      []string
+		expected []*types.AutoScalingGroup
+	}{
+		{[]string{}, []*types.AutoScalingGroup{}},
+		{[]string{"i-4"}, []*types.AutoScalingGroup{}},
+		{
+			[]string{"i-1", "i-2", "i-4"},
+			[]*types.AutoScalingGroup{
+				&types.AutoScalingGroup{ID: "arn:asg1", Name: "asg1", DesiredCapacity: 3, MinSize: 1, MaxSize: 5, Instances: []*types.AutoScalingInstance{
+					&types.AutoScalingInstance{InstanceID: "i-1", LifecycleState: "InService"},
+					&types.AutoScalingInstance{InstanceID: "i-2", LifecycleState: "Pending"},
+				}},
+			},
+		},
+		{
+			[]string{"i-3", "i-1"},
+			[]*types.AutoScalingGroup{
+				&types.AutoScalingGroup{ID: "arn:asg2", Name: "asg2", Instances: []*types.AutoScalingInstance{
+					&types.AutoScalingInstance{InstanceID: "i-3", LifecycleState: "InService"},
+				}},
+				&types.AutoScalingGroup{ID: "arn:asg1", Name: "asg1", DesiredCapacity: 3, MinSize: 1, MaxSize: 5, Instances: []*types.AutoScalingInstance{
+					&types.AutoScalingInstance{InstanceID: "i-1", LifecycleState: "InService"},
+					&types.AutoScalingInstance{InstanceID: "i-2", LifecycleState: "Pending"},
+				}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		gs, err := e.GetAutoScalingGroups(test.ids)
+		if err != nil {
+			t.Errorf("\n- %v\n- Getting Auto Scaling groups shouldn't error: %v", test, err)
+			continue
+		}
+		if !reflect.DeepEqual(gs, test.expected) {
+			t.Errorf("\n- %v\n- Auto Scaling groups are wrong, want: %v; got: %v", test, test.expected, gs)
+		}
+	}
+}
+
+func TestGetTaggedAutoScalingGroups(t *testing.T) {
+	c := &autoScalingTestClient{
+		groups: []*autoscaling.Group{
+			&autoscaling.Group{
+				AutoScalingGroupARN:  aws.String("arn:asg1"),
+				AutoScalingGroupName: aws.String("asg1"),
+				DesiredCapacity:      aws.Int64(3),
+				Instances: []*autoscaling.Instance{
+					&autoscaling.Instance{InstanceId: aws.String("i-1"), LifecycleState: aws.String("InService")},
+				},
+			},
+			&autoscaling.Group{AutoScalingGroupARN: aws.String("arn:asg2"), AutoScalingGroupName: aws.String("asg2"), DesiredCapacity: aws.Int64(0)},
+			&autoscaling.Group{AutoScalingGroupARN: aws.String("arn:asg3"), AutoScalingGroupName: aws.String("asg3")},
+		},
+		tags: []*autoscaling.TagDescription{
+			&autoscaling.TagDescription{ResourceId: aws.String("asg1"), ResourceType: aws.String("auto-scaling-group"), Key: aws.String("ecs-cluster"), Value: aws.String("cluster1")},
+			&autoscaling.TagDescription{ResourceId: aws.String("asg2"), ResourceType: aws.String("auto-scaling-group"), Key: aws.String("ecs-cluster"), Value: aws.String("cluster1")},
+			&autoscaling.TagDescription{ResourceId: aws.String("asg3"), ResourceType: aws.String("auto-scaling-group"), Key: aws.String("ecs-cluster"), Value: aws.String("cluster2")},
+			&autoscaling.TagDescription{ResourceId: aws.String("asg3"), ResourceType: aws.String("auto-scaling-group"), Key: aws.String("team"), Value: aws.String("cluster1")},
+		},
+	}
+	e := &ECSClient{
+		autoscaling: c,
+		logger:      log.Base(),
+	}
+
+	tests := []struct {
+		key      string
+		value    string
+		expected []*types.AutoScalingGroup
+	}{
+		{"ecs-cluster", "cluster3", []*types.AutoScalingGroup{}},
+		{"other", "cluster1", []*types.AutoScalingGroup{}},
+		{
+			"ecs-cluster", "cluster1",
+			[]*types.AutoScalingGroup{
+				&types.AutoScalingGroup{ID: "arn:asg1", Name: "asg1", DesiredCapacity: 3, Instances: []*types.AutoScalingInstance{
+					&types.AutoScalingInstance{InstanceID: "i-1", LifecycleState: "InService"},
+				}},
+				&types.AutoScalingGroup{ID: "arn:asg2", Name: "asg2", Instances: []*types.AutoScalingInstance{}},
+			},
+		},
+		{
+			"ecs-cluster", "cluster2",
+			[]*types.AutoScalingGroup{
+				&types.AutoScalingGroup{ID: "arn:asg3", Name: "asg3", Instances: []*types.AutoScalingInstance{}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		gs, err := e.GetTaggedAutoScalingGroups(test.key, test.value)
+		if err != nil {
+			t.Errorf("\n- %v\n- Getting Auto Scaling groups shouldn't error: %v", test, err)
+			continue
+		}
+		if !reflect.DeepEqual(gs, test.expected) {
+			t.Errorf("\n- %v\n- Auto Scaling groups are wrong, want: %v; got: %v", test, test.expected, gs)
+		}
+	}
+}
+
+// appScalingTestClient is an Application Auto Scaling API with scalable targets, the other methods are not implemented
+type appScalingTestClient struct {
+	applicationautoscalingiface.ApplicationAutoScalingAPI
+	targets []*applicationautoscaling.ScalableTarget
+	calls   int
+}
+
+func (c *appScalingTestClient) DescribeScalableTargets(params *applicationautoscaling.DescribeScalableTargetsInput) (*applicationautoscaling.DescribeScalableTargetsOutput, error) {
+	c.calls++
+	if len(params.ResourceIds) > maxScalableAPI {
+		return nil, errors.New("too many resource IDs")
+	}
+	res := []*applicationautoscaling.ScalableTarget{}
+	for _, id := range params.ResourceIds {
+		for _, t := range c.targets {
+			if aws.StringValue(t.ResourceId) == aws.StringValue(id) {
+				res = append(res, t)
+			}
+		}
+	}
+	return &applicationautoscaling.DescribeScalableTargetsOutput{ScalableTargets: res}, nil
+}
+
+func TestGetServiceScalableTargets(t *testing.T) {
+	cluster := &types.ECSCluster{ID: "arn:c1", Name: "cluster1"}
+	tests := []struct {
+		services      int
+		targets       []string
+		expectedCalls int
+	}{
+		{0, []string{}, 0},
+		{3, []string{}, 1},
+		{3, []string{"service0", "service2"}, 1},
+		{120, []string{"service0", "service60", "service119"}, 3},
+	}
+
+	for _, test := range tests {
+		ss := []*types.ECSService{}
+		for i := 0; i < test.services; i++ {
+			ss = append(ss, &types.ECSService{ID: fmt.Sprintf("arn:service%d", i), Name: fmt.Sprintf("service%d", i)})
+		}
+		c := &appScalingTestClient{}
+		expected := []*types.ScalableTarget{}
+		for _, name := range test.targets {
+			id := "service/cluster1/" + name
+			c.targets = append(c.targets, &applicationautoscaling.ScalableTarget{
+				ResourceId:  aws.String(id),
+				MinCapacity: aws.Int64(1),
+				MaxCapacity: aws.Int64(5),
+			})
+			expected = append(expected, &types.ScalableTarget{ResourceID: id, ServiceName: name, MinCapacity: 1, MaxCapacity: 5})
+		}
+		e := &ECSClient{
+			appScaling: c,
+			logger:     log.Base(),
+		}
+
+		ts, err := e.GetServiceScalableTargets(cluster, ss)
+		if err != nil {
+			t.Errorf("\n- %v\n- Getting scalable targets shouldn't error: %v", test, err)
+			continue
+		}
+		if !reflect.DeepEqual(ts, expected) {
+			t.Errorf("\n- %v\n- Scalable targets are wrong, want: %v; got: %v", test, expected, ts)
+		}
+		if c.calls != test.expectedCalls {
+			t.Errorf("\n- %v\n- API calls are wrong, want: %d; got: %d", test, test.expectedCalls, c.calls)
+		}
+	}
+}
+
+// elbv2TestClient is an ELBv2 API with target health by target group, the other methods are not implemented
+type elbv2TestClient struct {
+	elbv2iface.ELBV2API
+	targets map[string][]*elbv2.TargetHealthDescription
+	err     bool
+}
+
+func (c *elbv2TestClient) DescribeTargetHealth(params *elbv2.DescribeTargetHealthInput) (*elbv2.DescribeTargetHealthOutput, error) {
+	if c.err {
+		return nil, errors.New("DescribeTargetHealth wrong!")
+	}
+	return &elbv2.DescribeTargetHealthOutput{TargetHealthDescriptions: c.targets[aws.StringValue(params.TargetGroupArn)]}, nil
+}
+
+func TestGetTargetHealth(t *testing.T) {
+	c := &elbv2TestClient{
+		targets: map[string][]*elbv2.TargetHealthDescription{
+			"tg1": []*elbv2.TargetHealthDescription{
+				&elbv2.TargetHealthDescription{
+					Target:       &elbv2.TargetDescription{Id: aws.String("i-1"), Port: aws.Int64(32768)},
+					TargetHealth: &elbv2.TargetHealth{State: aws.String("healthy")},
+				},
+				&elbv2.TargetHealthDescription{
+					Target:       &elbv2.TargetDescription{Id: aws.String("i-2"), Port: aws.Int64(32768)},
+					TargetHealth: &elbv2.TargetHealth{State: aws.String("unhealthy"), Reason: aws.String("Target.Timeout")},
+				},
+			},
+			"tg2": []*elbv2.TargetHealthDescription{
+				&elbv2.TargetHealthDescription{
+					Target:       &elbv2.TargetDescription{Id: aws.String("i-3"), Port: aws.Int64(80)},
+					TargetHealth: &elbv2.TargetHealth{State: aws.String("draining"), Reason: aws.String("Target.DeregistrationInProgress")},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		targetGroups []string
+		wantError    bool
+		expected     []*types.TargetHealth
+	}{
+		{[]string{}, false, []*types.TargetHealth{}},
+		{[]string{"tg3"}, false, []*types.TargetHealth{}},
+		{
+			[]string{"tg1", "tg2"}, false,
+			[]*types.TargetHealth{
+				&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-1", Port: 32768, State: "healthy"},
+				&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-2", Port: 32768, State: "unhealthy", Reason: "Target.Timeout"},
+				&types.TargetHealth{TargetGroupARN: "tg2", TargetID: "i-3", Port: 80, State: "draining", Reason: "Target.DeregistrationInProgress"},
+			},
+		},
+		{[]string{"tg1"}, true, nil},
+	}
+
+	for _, test := range tests {
+		c.err = test.wantError
+		e := &ECSClient{
+			elbv2:  c,
+			logger: log.Base(),
+		}
+
+		ths, err := e.GetTargetHealth(test.targetGroups)
+		if test.wantError {
+			if err == nil {
+				t.Errorf("\n- %v\n- Getting target health should error, it didn't", test)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("\n- %v\n- Getting target health shouldn't error: %v", test, err)
+			continue
+		}
+		if !reflect.DeepEqual(ths, test.expected) {
+			t.Errorf("\n- %v\n- Target health is wrong, want: %v; got: %v", test, test.expected, ths)
+		}
+	}
+}
+
+// cloudWatchTestClient is a CloudWatch API with a datapoint per metric, the other methods are not implemented
+type cloudWatchTestClient struct {
+	cloudwatchiface.CloudWatchAPI
+	sync.Mutex
+	calls  int
+	params []*cloudwatch.GetMetricStatisticsInput
+}
+
+func (c *cloudWatchTestClient) GetMetricStatistics(params *cloudwatch.GetMetricStatisticsInput) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.calls++
+	c.params = append(c.params, params)
+
+	// The services with name "missing" don't have datapoints
+	dims := []string{}
+	for _, d := range params.Dimensions {
+		if aws.StringValue(d.Value) == "missing" {
+			return &cloudwatch.GetMetricStatisticsOutput{}, nil
+		}
+		dims = append(dims, aws.StringValue(d.Value))
+	}
+	return &cloudwatch.GetMetricStatisticsOutput{
+		Datapoints: []*cloudwatch.Datapoint{
+			&cloudwatch.Datapoint{Timestamp: params.StartTime, Average: aws.Float64(float64(len(dims)))},
+		},
+	}, nil
+}
+
+func TestGetCloudWatchMetrics(t *testing.T) {
+	cluster := &types.ECSCluster{ID: "arn:c1", Name: "cluster1"}
+	ss := []*types.ECSService{
+		&types.ECSService{ID: "arn:s1", Name: "service1"},
+		&types.ECSService{ID: "arn:s2", Name: "missing"},
+	}
+	for i := 0; i < 10; i++ {
+		ss = append(ss, &types.ECSService{ID: fmt.Sprintf("arn:s%d", i+3), Name: fmt.Sprintf("service%d", i+3)})
+	}
+	c := &cloudWatchTestClient{}
+	e := &ECSClient{
+		cloudwatch: c,
+		statistics: newDataCache(),
+		logger:     log.Base(),
+	}
+
+	ms, err := e.GetCloudWatchMetrics(cluster, ss, time.Minute, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("Getting CloudWatch metrics shouldn't error: %v", err)
+	}
+
+	// 4 cluster metrics and 2 of each service
+	if c.calls != 4+2*len(ss) {
+		t.Errorf("API calls are wrong, want: %d; got: %d", 4+2*len(ss), c.calls)
+	}
+	got := map[string]float64{}
+	for _, m := range ms {
+		got[m.Name+"/"+m.ServiceName] = m.Value
+	}
+	if len(got) != 4+2*(len(ss)-1) || got["CPUReservation/"] != 1 || got["MemoryUtilization/service1"] != 2 {
+		t.Errorf("Metrics are wrong: %v", got)
+	}
+	if _, ok := got["CPUUtilization/missing"]; ok {
+		t.Errorf("Metrics without datapoints shouldn't be returned")
+	}
+
+	// The period of the datapoints is complete and ends delay ago
+	for _, p := range c.params {
+		start, end := aws.TimeValue(p.StartTime), aws.TimeValue(p.EndTime)
+		if end.Sub(start) != time.Minute || time.Since(end) < 2*time.Minute || time.Since(end) > 3*time.Minute || aws.Int64Value(p.Period) != 60 {
+			t.Errorf("Period is wrong: %s - %s (%d)", start, end, aws.Int64Value(p.Period))
+		}
+	}
+
+	// The datapoints of the same period are cached (all of them are gathered again if the period changed between the calls)
+	calls := c.calls
+	ms2, err := e.GetCloudWatchMetrics(cluster, ss, time.Minute, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("Getting CloudWatch metrics shouldn't error: %v", err)
+	}
+	if c.calls != calls && c.calls != 2*calls {
+		t.Errorf("Cached API calls are wrong, want: %d; got: %d", calls, c.calls)
+	}
+	if len(ms2) != len(ms) {
+		t.Errorf("Cached metrics are wrong, want: %d; got: %d", len(ms), len(ms2))
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		image                   string
+		repository, tag, digest string
+	}{
+		{"nginx", "nginx", "latest", ""},
+		{"nginx:1.13", "nginx", "1.13", ""},
+		{"library/nginx:1.13-alpine", "library/nginx", "1.13-alpine", ""},
+		{"registry.example.com:5000/team/app", "registry.example.com:5000/team/app", "latest", ""},
+		{"registry.example.com:5000/team/app:v2", "registry.example.com:5000/team/app", "v2", ""},
+		{"111111111111.dkr.ecr.eu-west-1.amazonaws.com/app@sha256:aaa", "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", "", "sha256:aaa"},
+		{"111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:v1@sha256:aaa", "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", "v1", "sha256:aaa"},
+	}
+
+	for _, test := range tests {
+		repo, tag, digest := parseImage(test.image)
+		if repo != test.repository || tag != test.tag || digest != test.digest {
+			t.Errorf("\n- %v\n- Parsed image is wrong, want: %s, %s, %s; got: %s, %s, %s", test, test.repository, test.tag, test.digest, repo, tag, digest)
+		}
+	}
+}
+
+// taskDefTestClient is an ECS API with task definitions, the other methods are not implemented
+type taskDefTestClient struct {
+	ecsiface.ECSAPI
+	taskDefs map[string][]string // The images of the containers by task definition
+	calls    int
+}
+
+func (c *taskDefTestClient) DescribeTaskDefinition(params *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
+	c.calls++
+	images, ok := c.taskDefs[aws.StringValue(params.TaskDefinition)]
+	if !ok {
+		return nil, errors.New("DescribeTaskDefinition wrong!")
+	}
+	td := &ecs.TaskDefinition{TaskDefinitionArn: params.TaskDefinition}
+	for i, image := range images {
+		td.ContainerDefinitions = append(td.ContainerDefinitions, &ecs.ContainerDefinition{Name: aws.String(fmt.Sprintf("c%d", i)), Image: aws.String(image)})
+	}
+	return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: td}, nil
+}
+
+// ecrTestClient is an ECR API with images, the other methods are not implemented
+type ecrTestClient struct {
+	ecriface.ECRAPI
+	images []*ecr.ImageDetail
+	calls  int
+}
+
+func (c *ecrTestClient) DescribeImages(params *ecr.DescribeImagesInput) (*ecr.DescribeImagesOutput, error) {
+	c.calls++
+	if aws.StringValue(params.RegistryId) != "111111111111" {
+		return nil, awserr.New("AccessDeniedException", "wanted", nil)
+	}
+	res := []*ecr.ImageDetail{}
+	for _, id := range params.ImageIds {
+		found := false
+		for _, i := range c.images {
+			if aws.StringValue(i.RegistryId) != aws.StringValue(params.RegistryId) || aws.StringValue(i.RepositoryName) != aws.StringValue(params.RepositoryName) {
+				continue
+			}
+			match := aws.StringValue(i.ImageDigest) == aws.StringValue(id.ImageDigest)
+			for _, t := range i.ImageTags {
+				match = match || aws.StringValue(t) == aws.StringValue(id.ImageTag)
+			}
+			if match {
+				found = true
+				res = append(res, i)
+			}
+		}
+		if !found {
+			return nil, awserr.New("ImageNotFoundException", "wanted", nil)
+		}
+	}
+	return &ecr.DescribeImagesOutput{ImageDetails: res}, nil
+}
+
+func TestGetTaskDefinitionImages(t *testing.T) {
+	pushed := time.Now().Add(-time.Hour).Truncate(time.Second)
+	ecsC := &taskDefTestClient{
+		taskDefs: map[string][]string{
+			"td1": []string{"111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:v1", "nginx:1.13"},
+			"td2": []string{"111111111111.dkr.ecr.eu-west-1.amazonaws.com/app@sha256:bbb"},
+			"td3": []string{"111111111111.dkr.ecr.us-east-1.amazonaws.com/app:v1"},
+			"td4": []string{"111111111111.dkr.ecr.eu-west-1.amazonaws.com/deleted:v1"},
+			"td5": []string{"111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:v1", "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:deleted"},
+			"td7": []string{"222222222222.dkr.ecr.eu-west-1.amazonaws.com/app:v1"},
+		},
+	}
+	ecrC := &ecrTestClient{
+		images: []*ecr.ImageDetail{
+			&ecr.ImageDetail{RegistryId: aws.String("111111111111"), RepositoryName: aws.String("app"), ImageDigest: aws.String("sha256:aaa"), ImageTags: aws.StringSlice([]string{"v1"}), ImagePushedAt: aws.Time(pushed)},
+			&ecr.ImageDetail{RegistryId: aws.String("111111111111"), RepositoryName: aws.String("app"), ImageDigest: aws.String("sha256:bbb"), ImagePushedAt: aws.Time(pushed.Add(-time.Hour))},
+		},
+	}
+	e := &ECSClient{
+		client:    ecsC,
+		ecr:       ecrC,
+		region:    "eu-west-1",
+		taskDefs:  newDataCache(),
+		ecrImages: newDataCache(),
+		logger:    log.Base(),
+	}
+
+	tests := []struct {
+		taskDefs  []string
+		wantError bool
+		expected  []*types.ContainerImage
+	}{
+		{[]string{}, false, []*types.ContainerImage{}},
+		{
+			[]string{"td1", "td2"}, false,
+			[]*types.ContainerImage{
+				&types.ContainerImage{TaskDefinition: "td1", Container: "c0", Image: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:v1", Repository: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", Tag: "v1", Digest: "sha256:aaa", PushedAt: pushed},
+				&types.ContainerImage{TaskDefinition: "td1", Container: "c1", Image: "nginx:1.13", Repository: "nginx", Tag: "1.13"},
+				&types.ContainerImage{TaskDefinition: "td2", Container: "c0", Image: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app@sha256:bbb", Repository: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", Digest: "sha256:bbb", PushedAt: pushed.Add(-time.Hour)},
+			},
+		},
+		// The images of other regions, the deleted ones and the ones of other accounts without access don't have ECR data
+		{
+			[]string{"td3", "td4", "td7"}, false,
+			[]*types.ContainerImage{
+				&types.ContainerImage{TaskDefinition: "td3", Container: "c0", Image: "111111111111.dkr.ecr.us-east-1.amazonaws.com/app:v1", Repository: "111111111111.dkr.ecr.us-east-1.amazonaws.com/app", Tag: "v1"},
+				&types.ContainerImage{TaskDefinition: "td4", Container: "c0", Image: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/deleted:v1", Repository: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/deleted", Tag: "v1"},
+				&types.ContainerImage{TaskDefinition: "td7", Container: "c0", Image: "222222222222.dkr.ecr.eu-west-1.amazonaws.com/app:v1", Repository: "222222222222.dkr.ecr.eu-west-1.amazonaws.com/app", Tag: "v1"},
+			},
+		},
+		// A missing image doesn't hide the other images of the repository
+		{
+			[]string{"td5"}, false,
+			[]*types.ContainerImage{
+				&types.ContainerImage{TaskDefinition: "td5", Container: "c0", Image: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:v1", Repository: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", Tag: "v1", Digest: "sha256:aaa", PushedAt: pushed},
+				&types.ContainerImage{TaskDefinition: "td5", Container: "c1", Image: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:deleted", Repository: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", Tag: "deleted"},
+			},
+		},
+		{[]string{"td6"}, true, nil},
+	}
+
+	for _, test := range tests {
+		is, err := e.GetTaskDefinitionImages(test.taskDefs)
+		if test.wantError {
+			if err == nil {
+				t.Errorf("\n- %v\n- Getting images should error, it didn't", test)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("\n- %v\n- Getting images shouldn't error: %v", test, err)
+			continue
+		}
+		if !reflect.DeepEqual(is, test.expected) {
+			t.Errorf("\n- %v\n- Images are wrong, want: %v; got: %v", test, test.expected, is)
+		}
+	}
+
+	// The task definitions and the ECR images are cached
+	calls, ecrCalls := ecsC.calls, ecrC.calls
+	is, err := e.GetTaskDefinitionImages([]string{"td1", "td2"})
+	if err != nil {
+		t.Errorf("Getting cached images shouldn't error: %v", err)
+	}
+	if ecsC.calls != calls {
+		t.Errorf("Cached task definitions shouldn't be described, calls want: %d; got: %d", calls, ecsC.calls)
+	}
+	if ecrC.calls != ecrCalls {
+		t.Errorf("Cached ECR images shouldn't be described, calls want: %d; got: %d", ecrCalls, ecrC.calls)
+	}
+	if len(is) != 3 || is[0].Digest != "sha256:aaa" || !is[0].PushedAt.Equal(pushed) || !is[2].PushedAt.Equal(pushed.Add(-time.Hour)) {
+		t.Errorf("Cached ECR images are wrong, got: %v", is)
+	}
+
+	// The digests of the tags expire before the images
+	e.ecrImages.set("111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:v1", &ecrImage{digest: "sha256:aaa", pushedAt: pushed}, time.Now().Add(-10*time.Minute))
+	if _, err := e.GetTaskDefinitionImages([]string{"td1", "td2"}); err != nil {
+		t.Errorf("Getting cached images shouldn't error: %v", err)
+	}
+	if ecrC.calls != ecrCalls+1 {
+		t.Errorf("Expired ECR image tags should be described, calls want: %d; got: %d", ecrCalls+1, ecrC.calls)
+	}
+}
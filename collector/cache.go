@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+// cacheEntry is a piece of data stored on the cache
+type cacheEntry struct {
+	value      interface{} // The data
+	gatheredAt time.Time   // When was the data gathered
+}
+
+// dataCache stores the last good data gathered from ECS so it can be served again
+// when the AWS API fails for a period of time
+type dataCache struct {
+	sync.Mutex
+	data map[string]*cacheEntry // The data by key
+}
+
+// newDataCache returns an initialized data cache
+func newDataCache() *dataCache {
+	return &dataCache{
+		data: map[string]*cacheEntry{},
+	}
+}
+
+// set stores the data of a key replacing the previous one
+func (c *dataCache) set(key string, value interface{}, gatheredAt time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.data[key] = &cacheEntry{
+		value:      value,
+		gatheredAt: gatheredAt,
+	}
+}
+
+// get returns the last good data of a key if its not older than maxAge
+func (c *dataCache) get(key string, maxAge time.Duration, now time.Time) (*cacheEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	d, ok := c.data[key]
+	if !ok || now.Sub(d.gatheredAt) > maxAge {
+		return nil, false
+	}
+	return d, true
+}
+
+// purge removes the data older than maxAge, this way deleted clusters don't stay forever. It's called
+// once per scrape instead of on every get so the lookups don't scan the whole cache
+func (c *dataCache) purge(maxAge time.Duration, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	for key, d := range c.data {
+		if now.Sub(d.gatheredAt) > maxAge {
+			delete(c.data, key)
+		}
+	}
+}
+
+// instanceCache stores the EC2 instances by ID, the instances don't change so they are
+// only described again when they expire. The IDs that weren't found are cached too with a
+// shorter TTL, so the container instances of missing instances don't describe them on every scrape
+type instanceCache struct {
+	sync.Mutex
+	ttl        time.Duration
+	missingTTL time.Duration
+	data       map[string]*cacheEntry // The instances by ID, nil if the instance wasn't found
+}
+
+// newInstanceCache returns an initialized instance cache
+func newInstanceCache(ttl, missingTTL time.Duration) *instanceCache {
+	return &instanceCache{
+		ttl:        ttl,
+		missingTTL: missingTTL,
+		data:       map[string]*cacheEntry{},
+	}
+}
+
+// get returns the cached instances of the IDs and the IDs that are missing or have expired,
+// the IDs cached as not found are neither returned nor missing
+func (c *instanceCache) get(ids []string, now time.Time) ([]*types.EC2Instance, []string) {
+	c.Lock()
+	defer c.Unlock()
+	for id, d := range c.data {
+		ttl := c.ttl
+		if d.value == nil {
+			ttl = c.missingTTL
+		}
+		if now.Sub(d.gatheredAt) > ttl {
+			delete(c.data, id)
+		}
+	}
+
+	found := []*types.EC2Instance{}
+	missing := []string{}
+	for _, id := range ids {
+		d, ok := c.data[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		if d.value != nil {
+			found = append(found, d.value.(*types.EC2Instance))
+		}
+	}
+	return found, missing
+}
+
+// set stores the instances
+func (c *instanceCache) set(instances []*types.EC2Instance, gatheredAt time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	for _, i := range instances {
+		c.data[i.ID] = &cacheEntry{
+			value:      i,
+			gatheredAt: gatheredAt,
+		}
+	}
+}
+
+// setNotFound stores the IDs of the instances that weren't found
+func (c *instanceCache) setNotFound(ids []string, gatheredAt time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	for _, id := range ids {
+		c.data[id] = &cacheEntry{
+			value:      nil,
+			gatheredAt: gatheredAt,
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestDataCacheGet(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		gatheredAt time.Time
+		maxAge     time.Duration
+		expectData bool
+	}{
+		{now, time.Minute, true},
+		{now.Add(-30 * time.Second), time.Minute, true},
+		{now.Add(-time.Minute), time.Minute, true},
+		{now.Add(-61 * time.Second), time.Minute, false},
+		{now.Add(-time.Hour), time.Minute, false},
+	}
+
+	for _, test := range tests {
+		c := newDataCache()
+		c.set("services/c1", "cluster1", test.gatheredAt)
+
+		d, ok := c.get("services/c1", test.maxAge, now)
+		if ok != test.expectData {
+			t.Errorf("\n- %v\n- Data presence is wrong, want: %t; got: %t", test, test.expectData, ok)
+		}
+
+		if ok && d.value != "cluster1" {
+			t.Errorf("\n- %v\n- Data is wrong, want: %s; got: %s", test, "cluster1", d.value)
+		}
+
+		// Expired data is only removed when purging
+		if len(c.data) != 1 {
+			t.Errorf("\n- %v\n- Data shouldn't be purged on get, it was", test)
+		}
+		c.purge(test.maxAge, now)
+		if !test.expectData && len(c.data) != 0 {
+			t.Errorf("\n- %v\n- Expired data should be purged, it wasn't", test)
+		}
+		if test.expectData && len(c.data) != 1 {
+			t.Errorf("\n- %v\n- Valid data shouldn't be purged, it was", test)
+		}
+
+		// Missing keys shouldn't be returned
+		if _, ok := c.get("services/c2", test.maxAge, now); ok {
+			t.Errorf("\n- %v\n- Missing data shouldn't be returned, it was", test)
+		}
+	}
+}
+
+func TestDataCacheSet(t *testing.T) {
+	now := time.Now()
+	c := newDataCache()
+	c.set("services/c1", 1, now.Add(-10*time.Second))
+	c.set("services/c1", 2, now.Add(-20*time.Second))
+
+	d, ok := c.get("services/c1", time.Minute, now)
+	if !ok {
+		t.Fatalf("Data should be present, it wasn't")
+	}
+
+	if d.value != 2 || !d.gatheredAt.Equal(now.Add(-20*time.Second)) {
+		t.Errorf("Data should be replaced, it wasn't")
+	}
+}
+
+func TestInstanceCache(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		gatheredAt      time.Time
+		ids             []string
+		expectedFound   int
+		expectedMissing []string
+	}{
+		{now, []string{"i-1", "i-2"}, 2, []string{}},
+		{now, []string{"i-1", "i-3"}, 1, []string{"i-3"}},
+		{now.Add(-30 * time.Minute), []string{"i-1"}, 1, []string{}},
+		{now.Add(-2 * time.Hour), []string{"i-1", "i-2"}, 0, []string{"i-1", "i-2"}},
+		{now, []string{}, 0, []string{}},
+	}
+
+	for _, test := range tests {
+		c := newInstanceCache(time.Hour, 5*time.Minute)
+		c.set([]*types.EC2Instance{&types.EC2Instance{ID: "i-1"}, &types.EC2Instance{ID: "i-2"}}, test.gatheredAt)
+
+		found, missing := c.get(test.ids, now)
+		if len(found) != test.expectedFound {
+			t.Errorf("\n- %v\n- Found instances are wrong, want: %d; got: %d", test, test.expectedFound, len(found))
+		}
+		if !reflect.DeepEqual(missing, test.expectedMissing) {
+			t.Errorf("\n- %v\n- Missing instances are wrong, want: %v; got: %v", test, test.expectedMissing, missing)
+		}
+	}
+}
+
+func TestInstanceCacheNotFound(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		gatheredAt      time.Time
+		expectedMissing []string
+	}{
+		{now, []string{}},
+		{now.Add(-4 * time.Minute), []string{}},
+		{now.Add(-6 * time.Minute), []string{"i-3"}},
+	}
+
+	for _, test := range tests {
+		c := newInstanceCache(time.Hour, 5*time.Minute)
+		c.set([]*types.EC2Instance{&types.EC2Instance{ID: "i-1"}}, test.gatheredAt)
+		c.setNotFound([]string{"i-3"}, test.gatheredAt)
+
+		found, missing := c.get([]string{"i-1", "i-3"}, now)
+		if len(found) != 1 || found[0].ID != "i-1" {
+			t.Errorf("\n- %v\n- Found instances are wrong, want: [i-1]; got: %v", test, found)
+		}
+		if !reflect.DeepEqual(missing, test.expectedMissing) {
+			t.Errorf("\n- %v\n- Missing instances are wrong, want: %v; got: %v", test, test.expectedMissing, missing)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+const (
+	// DefaultCloudWatchPeriod is the period of the CloudWatch metrics when the configuration doesn't set one
+	DefaultCloudWatchPeriod = time.Minute
+	// DefaultCloudWatchDelay is how old is the end of the CloudWatch metrics period when the configuration doesn't set it
+	DefaultCloudWatchDelay = 2 * time.Minute
+)
+
+func init() {
+	registerCollector("cloudwatch", false, newCloudWatchCollector)
+}
+
+// cloudWatchCollector collects the CloudWatch utilization and reservation metrics of the clusters and services
+type cloudWatchCollector struct {
+	region      string
+	maxServices int // The maximum number of services exported per cluster (0 means no limit)
+	period      time.Duration
+	delay       time.Duration
+	d           descBuilder
+
+	// Metrics descriptions by CloudWatch metric name
+	clusterDescs map[string]*prometheus.Desc
+	serviceDescs map[string]*prometheus.Desc
+}
+
+// newCloudWatchCollector returns an initialized CloudWatch collector
+func newCloudWatchCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	c := &cloudWatchCollector{
+		region:      cfg.Region,
+		maxServices: cfg.MaxServices,
+		period:      cfg.CloudWatchPeriod,
+		delay:       cfg.CloudWatchDelay,
+		d:           d,
+
+		clusterDescs: map[string]*prometheus.Desc{
+			types.CloudWatchCPUUtilization: d.desc("cluster", "cpu_utilization_percent",
+				"The average CPU utilization of the cluster on the last CloudWatch period",
+				"region", "cluster"),
+			types.CloudWatchMemoryUtilization: d.desc("cluster", "memory_utilization_percent",
+				"The average memory utilization of the cluster on the last CloudWatch period",
+				"region", "cluster"),
+			types.CloudWatchCPUReservation: d.desc("cluster", "cpu_reservation_percent",
+				"The average CPU reserved by the tasks of the cluster on the last CloudWatch period",
+				"region", "cluster"),
+			types.CloudWatchMemoryReservation: d.desc("cluster", "memory_reservation_percent",
+				"The average memory reserved by the tasks of the cluster on the last CloudWatch period",
+				"region", "cluster"),
+		},
+		serviceDescs: map[string]*prometheus.Desc{
+			types.CloudWatchCPUUtilization: d.desc("service", "cpu_utilization_percent",
+				"The average CPU utilization of the service on the last CloudWatch period",
+				"region", "cluster", "service"),
+			types.CloudWatchMemoryUtilization: d.desc("service", "memory_utilization_percent",
+				"The average memory utilization of the service on the last CloudWatch period",
+				"region", "cluster", "service"),
+		},
+	}
+	if c.period <= 0 {
+		c.period = DefaultCloudWatchPeriod
+	}
+	if c.delay <= 0 {
+		c.delay = DefaultCloudWatchDelay
+	}
+	return c
+}
+
+// Describe implements subCollector
+func (c *cloudWatchCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.clusterDescs {
+		ch <- d
+	}
+	for _, d := range c.serviceDescs {
+		ch <- d
+	}
+}
+
+// Update implements subCollector
+func (c *cloudWatchCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	return s.forEachCluster(func(cluster *types.ECSCluster) error {
+		// The same services as the services collector, the cluster metrics are gathered even if the
+		// services fail
+		ss, err := s.services(cluster)
+		ss = limitServices(ss, c.maxServices)
+
+		ms, cwErr := s.cloudWatchMetrics(cluster, ss, c.period, c.delay)
+		if cwErr == nil || ms != nil {
+			c.collectClusterCloudWatchMetrics(ctx, ch, cluster, ss, ms)
+		}
+		if err == nil {
+			err = cwErr
+		}
+		return err
+	})
+}
+
+func (c *cloudWatchCollector) collectClusterCloudWatchMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, services []*types.ECSService, metrics []*types.CloudWatchMetric) {
+	byName := map[string]*types.ECSService{}
+	for _, s := range services {
+		byName[s.Name] = s
+	}
+
+	for _, m := range metrics {
+		if m.ServiceName == "" {
+			desc, ok := c.clusterDescs[m.Name]
+			if !ok {
+				continue
+			}
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, m.Value, c.d.values([]string{c.region, cluster.Name}, cluster.ID)...))
+			continue
+		}
+
+		desc, ok := c.serviceDescs[m.Name]
+		s, sok := byName[m.ServiceName]
+		if !ok || !sok {
+			continue
+		}
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, m.Value, c.d.values([]string{c.region, cluster.Name, s.Name}, cluster.ID, s.ID)...))
+	}
+}
@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestNewCloudWatchCollectorDefaults(t *testing.T) {
+	tests := []struct {
+		period, delay                 time.Duration
+		expectedPeriod, expectedDelay time.Duration
+	}{
+		{0, 0, DefaultCloudWatchPeriod, DefaultCloudWatchDelay},
+		{5 * time.Minute, time.Minute, 5 * time.Minute, time.Minute},
+	}
+
+	for _, test := range tests {
+		c := newCloudWatchCollector(Config{Region: "eu-west-1", CloudWatchPeriod: test.period, CloudWatchDelay: test.delay}).(*cloudWatchCollector)
+		if c.period != test.expectedPeriod || c.delay != test.expectedDelay {
+			t.Errorf("\n- %v\n- Period and delay are wrong, want: %s, %s; got: %s, %s", test, test.expectedPeriod, test.expectedDelay, c.period, c.delay)
+		}
+	}
+}
+
+func TestCollectClusterCloudWatchMetrics(t *testing.T) {
+	exp := newCloudWatchCollector(Config{Region: "eu-west-1"}).(*cloudWatchCollector)
+	ch := make(chan prometheus.Metric)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{
+		&types.ECSService{ID: "s1", Name: "service1"},
+		&types.ECSService{ID: "s2", Name: "service2"},
+	}
+	testMs := []*types.CloudWatchMetric{
+		&types.CloudWatchMetric{Name: "CPUUtilization", Value: 10},
+		&types.CloudWatchMetric{Name: "MemoryUtilization", Value: 20},
+		&types.CloudWatchMetric{Name: "CPUReservation", Value: 30},
+		&types.CloudWatchMetric{Name: "MemoryReservation", Value: 40},
+		&types.CloudWatchMetric{Name: "CPUUtilization", ServiceName: "service1", Value: 50},
+		&types.CloudWatchMetric{Name: "MemoryUtilization", ServiceName: "service1", Value: 60},
+		&types.CloudWatchMetric{Name: "CPUUtilization", ServiceName: "service2", Value: 70},
+		&types.CloudWatchMetric{Name: "CPUReservation", ServiceName: "service2", Value: 80},
+		&types.CloudWatchMetric{Name: "CPUUtilization", ServiceName: "service3", Value: 90},
+	}
+	go func() {
+		exp.collectClusterCloudWatchMetrics(context.TODO(), ch, testC, testSs, testMs)
+		close(ch)
+	}()
+
+	got := map[string]float64{}
+	for m := range ch {
+		g := readGauge(m)
+		desc := m.Desc().String()
+		name := desc[strings.Index(desc, `"`)+1 : strings.Index(desc, `",`)]
+		got[name+"/"+g.labels["service"]] = g.value
+		if g.labels["cluster"] != "cluster1" || g.labels["region"] != "eu-west-1" {
+			t.Errorf("Labels are wrong: %v", g.labels)
+		}
+	}
+
+	// The unknown metrics and services are ignored
+	expected := map[string]float64{
+		"ecs_cluster_cpu_utilization_percent/":            10,
+		"ecs_cluster_memory_utilization_percent/":         20,
+		"ecs_cluster_cpu_reservation_percent/":            30,
+		"ecs_cluster_memory_reservation_percent/":         40,
+		"ecs_service_cpu_utilization_percent/service1":    50,
+		"ecs_service_memory_utilization_percent/service1": 60,
+		"ecs_service_cpu_utilization_percent/service2":    70,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Metrics are wrong, want: %v; got: %v", expected, got)
+	}
+}
+
+func TestCollectClusterCloudWatchMetricsTimeout(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Test shouldn't panic, it did: %v", r)
+		}
+	}()
+
+	exp := newCloudWatchCollector(Config{Region: "eu-west-1"}).(*cloudWatchCollector)
+	ch := make(chan prometheus.Metric)
+	close(ch)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testMs := []*types.CloudWatchMetric{&types.CloudWatchMetric{Name: "CPUUtilization", Value: 10}}
+
+	// Cancel the context to mock as a finished main function
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exp.collectClusterCloudWatchMetrics(ctx, ch, testC, nil, testMs)
+}
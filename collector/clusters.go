@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func init() {
+	registerCollector("clusters", true, newClustersCollector)
+}
+
+// clustersCollector collects the metrics of the region clusters
+type clustersCollector struct {
+	region  string
+	arnInfo bool // Export the info metrics with the ARNs
+
+	// Metrics descriptions
+	clusterCount *prometheus.Desc
+	clusterInfo  *prometheus.Desc
+}
+
+// newClustersCollector returns an initialized clusters collector
+func newClustersCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	return &clustersCollector{
+		region:  cfg.Region,
+		arnInfo: cfg.ARNInfo,
+
+		clusterCount: d.desc("", "clusters",
+			"The total number of clusters",
+			"region"),
+		clusterInfo: d.infoDesc("cluster",
+			"Information of the cluster, always 1",
+			"region", "cluster"),
+	}
+}
+
+// Describe implements subCollector
+func (c *clustersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.clusterCount
+	if c.arnInfo {
+		ch <- c.clusterInfo
+	}
+}
+
+// Update implements subCollector
+func (c *clustersCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	c.collectClusterMetrics(ctx, ch, s.clusters)
+	if c.arnInfo {
+		c.collectClusterInfoMetrics(ctx, ch, s.validClusters)
+	}
+	return nil
+}
+
+func (c *clustersCollector) collectClusterMetrics(ctx context.Context, ch chan<- prometheus.Metric, clusters []*types.ECSCluster) {
+	// Total cluster count
+	sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.clusterCount, prometheus.GaugeValue, float64(len(clusters)), c.region))
+}
+
+func (c *clustersCollector) collectClusterInfoMetrics(ctx context.Context, ch chan<- prometheus.Metric, clusters []*types.ECSCluster) {
+	for _, cluster := range clusters {
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.clusterInfo, prometheus.GaugeValue, 1, c.region, cluster.Name, cluster.ID))
+	}
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestCollectClusterMetrics(t *testing.T) {
+	region := "eu-west-1"
+	exp := newClustersCollector(Config{Region: region}).(*clustersCollector)
+
+	ch := make(chan prometheus.Metric)
+	testCs := []*types.ECSCluster{}
+	for i := 0; i < 10; i++ {
+		c := &types.ECSCluster{
+			Name: fmt.Sprintf("cluster%d", i),
+			ID:   fmt.Sprintf("c%d", i),
+		}
+		testCs = append(testCs, c)
+	}
+
+	// Collect mocked metrics
+	go exp.collectClusterMetrics(context.TODO(), ch, testCs)
+
+	m := (<-ch).(prometheus.Metric)
+	m2 := readGauge(m)
+
+	expectedV := 10.0
+	// Check colected metrics are ok
+	if m2.value != expectedV {
+		t.Errorf("expected %f ecs_clusters, got %f", expectedV, m2.value)
+	}
+
+	if m2.labels["region"] != region {
+		t.Errorf("expected %s region, got %s", region, m2.labels["region"])
+	}
+
+	expected := `Desc{fqName: "ecs_clusters", help: "The total number of clusters", constLabels: {}, variableLabels: [region]}`
+	if expected != m.Desc().String() {
+		t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+	}
+}
+
+func TestCollectClusterMetricsTimeout(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Test shouldn't panic, it did: %v", r)
+		}
+	}()
+
+	exp := newClustersCollector(Config{Region: "eu-west-1"}).(*clustersCollector)
+	ch := make(chan prometheus.Metric)
+	close(ch)
+
+	testCs := []*types.ECSCluster{&types.ECSCluster{ID: "c1", Name: "cluster1"}}
+
+	// Cancel the context to mock as a finished main function
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exp.collectClusterMetrics(ctx, ch, testCs)
+}
+
+func TestCollectClusterInfoMetrics(t *testing.T) {
+	exp := newClustersCollector(Config{Region: "eu-west-1", ARNInfo: true}).(*clustersCollector)
+	ch := make(chan prometheus.Metric)
+	testCs := []*types.ECSCluster{
+		&types.ECSCluster{ID: "arn:c1", Name: "cluster1"},
+		&types.ECSCluster{ID: "arn:c2", Name: "cluster2"},
+	}
+	go func() {
+		exp.collectClusterInfoMetrics(context.TODO(), ch, testCs)
+		close(ch)
+	}()
+
+	i := 0
+	for m := range ch {
+		got := readGauge(m)
+		want := map[string]string{"region": "eu-west-1", "cluster": testCs[i].Name, "cluster_arn": testCs[i].ID}
+		if got.value != 1 || !reflect.DeepEqual(got.labels, want) {
+			t.Errorf("Info metric is wrong, want: %v; got: %v", want, got)
+		}
+		i++
+	}
+	if i != len(testCs) {
+		t.Errorf("Number of info metrics is wrong, want: %d; got: %d", len(testCs), i)
+	}
+}
@@ -2,120 +2,222 @@ package collector
 
 import (
 	"context"
-	"regexp"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/common/version"
 
 	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/openmetrics"
 	"github.com/slok/ecs-exporter/types"
 )
 
 const (
-	namespace = "ecs"
-	timeout   = 10 * time.Second
+	timeout = 10 * time.Second
 )
 
-// Metrics descriptions
-var (
-	// exporter metrics
-	up = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "up"),
-		"Was the last query of ecs successful.",
-		[]string{"region"}, nil,
-	)
-
-	// Clusters metrics
-	clusterCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "clusters"),
-		"The total number of clusters",
-		[]string{"region"}, nil,
-	)
-
-	//  Services metrics
-	serviceCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "services"),
-		"The total number of services",
-		[]string{"region", "cluster"}, nil,
-	)
-
-	serviceDesired = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "service_desired_tasks"),
-		"The desired number of instantiations of the task definition to keep running regarding a service",
-		[]string{"region", "cluster", "service"}, nil,
-	)
-
-	servicePending = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "service_pending_tasks"),
-		"The number of tasks in the cluster that are in the PENDING state regarding a service",
-		[]string{"region", "cluster", "service"}, nil,
-	)
+// subCollector is a metric collection module of the exporter, it gets the data
+// from the scrape and sends the metrics of a group
+type subCollector interface {
+	// Describe sends the descriptors of the metrics of the collector
+	Describe(ch chan<- *prometheus.Desc)
+	// Update sends the metrics of the collector using the data of the scrape
+	Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error
+}
 
-	serviceRunning = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "service_running_tasks"),
-		"The number of tasks in the cluster that are in the RUNNING state regarding a service",
-		[]string{"region", "cluster", "service"}, nil,
-	)
+// registered collectors
+var (
+	factories      = map[string]func(cfg Config) subCollector{}
+	defaultEnabled = map[string]bool{}
+)
 
-	//  Container instances metrics
-	cInstanceCount = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "container_instances"),
-		"The total number of container instances",
-		[]string{"region", "cluster"}, nil,
-	)
+// registerCollector registers a collector factory, needs to be called on the collector init
+func registerCollector(name string, isDefaultEnabled bool, factory func(cfg Config) subCollector) {
+	factories[name] = factory
+	defaultEnabled[name] = isDefaultEnabled
+}
 
-	cInstanceAgentC = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "container_instance_agent_connected"),
-		"The connected state of the container instance agent",
-		[]string{"region", "cluster", "instance"}, nil,
-	)
+// Collectors returns the registered collectors and if they are enabled by default
+func Collectors() map[string]bool {
+	res := map[string]bool{}
+	for name, enabled := range defaultEnabled {
+		res[name] = enabled
+	}
+	return res
+}
 
-	cInstanceStatusAct = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "container_instance_active"),
-		"The status of the container instance in ACTIVE state, indicates that the container instance can accept tasks.",
-		[]string{"region", "cluster", "instance"}, nil,
-	)
+// Config is the configuration of the exporter
+type Config struct {
+	Region           string                // The region where the exporter will scrape
+	ClusterFilter    string                // Regular expresion to filter clusters, another inclusion pattern of the clusters filter
+	Clusters         ClusterFilter         // The inclusions and exclusions of the clusters
+	Services         ServiceFilter         // The inclusions and exclusions of the services
+	MaxServices      int                   // The maximum number of services exported per cluster (0 means no limit)
+	Namespace        string                // The namespace of the metrics (default "ecs")
+	ConstLabels      map[string]string     // The labels added to every metric of the exporter
+	ARNLabels        bool                  // Add the cluster_arn, service_arn and container_instance_arn labels to the metrics
+	ARNInfo          bool                  // Export the cluster, service and container instance info metrics with the ARNs
+	EC2Info          bool                  // Describe the EC2 instances of the container instances and add their data to the container instance info metric
+	Collectors       map[string]bool       // The collectors enabled state, the missing ones will use the default state
+	StaleGracePeriod time.Duration         // The time the last good data of a cluster will be exported when gathering fails (0 disables it)
+	CloudWatchPeriod time.Duration         // The period of the CloudWatch metrics (default DefaultCloudWatchPeriod)
+	CloudWatchDelay  time.Duration         // How old is the end of the CloudWatch metrics period (default DefaultCloudWatchDelay)
+	AutoScalingTag   string                // The tag of the Auto Scaling groups whose value is the cluster name, if missing the groups are found by the container instances
+	Session          *session.Session      // The AWS session used to gather the data, if missing a new one will be created for the region
+	Gatherer         ECSGatherer           // Custom gatherer used instead of the ECS client of the session, the service filter is not applied to it
+	Registerer       prometheus.Registerer // The registry where the exporter will be registered, if missing it will not be registered
+	Context          context.Context       // The context of the exporter, when done the running collections are cancelled (default background)
+	Logger           log.Logger            // The logger of the exporter (default the standard logger)
+
+	familyTypes openmetrics.FamilyTypes // The OpenMetrics types of the families set by the collectors descriptors
+}
 
-	cInstancePending = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "container_instance_pending_tasks"),
-		"The number of tasks on the container instance that are in the PENDING status.",
-		[]string{"region", "cluster", "instance"}, nil,
-	)
-)
+// collectorEnabled returns true if the collector is enabled on the configuration or by default
+func (cfg Config) collectorEnabled(name string) bool {
+	enabled, ok := cfg.Collectors[name]
+	if !ok {
+		enabled = defaultEnabled[name]
+	}
+	return enabled
+}
 
 // Exporter collects ECS clusters metrics
 type Exporter struct {
-	sync.Mutex                   // Our exporter object will be locakble to protect from concurrent scrapes
-	client        ECSGatherer    // Custom ECS client to get information from the clusters
-	region        string         // The region where the exporter will scrape
-	clusterFilter *regexp.Regexp // Compiled regular expresion to filter clusters
-	noCIMetrics   bool           // Don't gather container instance metrics
-	timeout       time.Duration  // The timeout for the whole gathering process
+	sync.Mutex                            // Our exporter object will be locakble to protect from concurrent scrapes
+	client        ECSGatherer             // Custom ECS client to get information from the clusters
+	region        string                  // The region where the exporter will scrape
+	clusterFilter *clusterMatcher         // Compiled filter of the clusters
+	collectors    map[string]subCollector // The enabled collectors by name
+	timeout       time.Duration           // The timeout for the whole gathering process
+	staleGrace    time.Duration           // The time the last good data of a cluster will be exported when gathering fails (0 disables it)
+	cache         *dataCache              // The last good data gathered
+	ready         *readiness              // The state of the AWS calls used to know if the exporter is ready
+	ctx           context.Context         // The context of the exporter, when done the running collections are cancelled
+	logger        log.Logger              // The logger of the exporter
+	familyTypes   openmetrics.FamilyTypes // The OpenMetrics types of the info and state set families
+
+	// Metrics descriptions
+	up               *prometheus.Desc
+	scrapeDuration   *prometheus.Desc
+	scrapeSuccess    *prometheus.Desc
+	clusterDataStale *prometheus.Desc
+	descs            descBuilder
+
+	stateMu   sync.Mutex
+	lastState *State // The data gathered on the last scrape
 }
 
 // New returns an initialized exporter
-func New(awsRegion string, clusterFilterRegexp string, disableCIMetrics bool) (*Exporter, error) {
-	c, err := NewECSClient(awsRegion)
-	if err != nil {
-		return nil, err
+func New(cfg Config) (*Exporter, error) {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.Base()
 	}
+	logger = logger.With("region", cfg.Region)
 
-	cRegexp, err := regexp.Compile(clusterFilterRegexp)
+	c, cFilter, err := newFilteredClient(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Exporter{
+	// Create the enabled collectors
+	for name := range cfg.Collectors {
+		if _, ok := factories[name]; !ok {
+			return nil, fmt.Errorf("missing collector: %s", name)
+		}
+	}
+	cfg.familyTypes = openmetrics.FamilyTypes{}
+	cs := map[string]subCollector{}
+	for name, factory := range factories {
+		if !cfg.collectorEnabled(name) {
+			logger.With("collector", name).Debugf("Collector disabled")
+			continue
+		}
+		cs[name] = factory(cfg)
+	}
+
+	ctx := cfg.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	e := &Exporter{
 		Mutex:         sync.Mutex{},
 		client:        c,
-		region:        awsRegion,
-		clusterFilter: cRegexp,
-		noCIMetrics:   disableCIMetrics,
+		region:        cfg.Region,
+		clusterFilter: cFilter,
+		collectors:    cs,
 		timeout:       timeout,
-	}, nil
+		staleGrace:    cfg.StaleGracePeriod,
+		cache:         newDataCache(),
+		ready:         &readiness{},
+		ctx:           ctx,
+		logger:        logger,
+	}
+
+	d := newDescBuilder(cfg)
+	e.descs = d
+	e.familyTypes = cfg.familyTypes
+	e.up = d.desc("", "up",
+		"Was the last query of ecs successful.",
+		"region")
+	e.scrapeDuration = d.desc("scrape", "collector_duration_seconds",
+		"The duration of a collector scrape.",
+		"region", "collector")
+	e.scrapeSuccess = d.desc("scrape", "collector_success",
+		"Whether a collector succeeded.",
+		"region", "collector")
+	e.clusterDataStale = d.desc("", "cluster_data_stale_seconds",
+		"The age in seconds of the cluster data being exported, 0 means the data has been gathered on this scrape",
+		"region", "cluster")
+
+	// The namespace and the constant labels can make the descriptors invalid
+	if err := prometheus.NewRegistry().Register(e); err != nil {
+		return nil, fmt.Errorf("invalid metrics configuration: %v", err)
+	}
 
+	if cfg.Registerer != nil {
+		if err := cfg.Registerer.Register(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// newFilteredClient returns the ECS client of the configuration with the service filter and the compiled cluster filter
+func newFilteredClient(cfg Config, logger log.Logger) (ECSGatherer, *clusterMatcher, error) {
+	cFilter, err := newClusterMatcher(cfg.ClusterFilter, cfg.Clusters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sFilter, err := newServiceMatcher(cfg.Services)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.Gatherer != nil {
+		return cfg.Gatherer, cFilter, nil
+	}
+
+	var c *ECSClient
+	if cfg.Session != nil {
+		c = NewECSClientFromSession(cfg.Session)
+	} else {
+		var err error
+		c, err = NewECSClient(cfg.Region)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	c.logger = logger
+	c.serviceFilter = sFilter
+	return c, cFilter, nil
 }
 
 // sendSafeMetric uses context to cancel the send over a closed channel.
@@ -138,158 +240,133 @@ func sendSafeMetric(ctx context.Context, ch chan<- prometheus.Metric, metric pro
 // Describe describes all the metrics ever exported by the ECS exporter. It
 // implements prometheus.Collector.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- up
-	ch <- clusterCount
-	ch <- serviceCount
-	ch <- serviceCount
-	ch <- serviceDesired
-	ch <- servicePending
-	ch <- serviceRunning
-
-	if e.noCIMetrics {
-		return
+	ch <- e.up
+	ch <- e.scrapeDuration
+	ch <- e.scrapeSuccess
+
+	if e.staleGrace > 0 {
+		ch <- e.clusterDataStale
 	}
 
-	ch <- cInstanceCount
-	ch <- cInstanceAgentC
-	ch <- cInstanceStatusAct
-	ch <- cInstancePending
+	for _, name := range e.collectorNames() {
+		e.collectors[name].Describe(ch)
+	}
 }
 
 // Collect fetches the stats from configured ECS and delivers them
 // as Prometheus metrics. It implements prometheus.Collector
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	log.Debugf("Start collecting...")
-	ctx, cancel := context.WithCancel(context.Background())
+	e.logger.Debugf("Start collecting...")
+	ctx, cancel := context.WithCancel(e.ctx)
 	defer cancel()
 
 	e.Lock()
 	defer e.Unlock()
 
+	result := float64(1)
+	start := time.Now()
+	// The data of the deleted clusters and resources is removed before the scrape
+	e.cache.purge(e.staleGrace, start)
+	s := newScrape(e.region, e.client, e.cache, e.staleGrace, e.logger)
+	defer func() {
+		st := s.state(start)
+		e.stateMu.Lock()
+		e.lastState = st
+		e.stateMu.Unlock()
+	}()
+
 	// Get clusters
-	cs, err := e.client.GetClusters()
+	err := s.loadClusters(e.validCluster)
+	e.ready.record(err, time.Now())
 	if err != nil {
-		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(up, prometheus.GaugeValue, 0, e.region))
-		log.Errorf("Error collecting metrics: %v", err)
-		return
-	}
-
-	e.collectClusterMetrics(ctx, ch, cs)
-
-	// Start getting metrics per cluster on its own goroutine
-	errC := make(chan bool)
-	totalCs := 0 // total cluster metrics gorotine ran
-
-	for _, c := range cs {
-		// Filter not desired clusters
-		if !e.validCluster(c) {
-			log.Debugf("Cluster '%s' filtered", c.Name)
-			continue
+		e.logger.With("operation", "GetClusters").Errorf("Error collecting metrics: %v", err)
+		result = 0
+		// Without clusters there is nothing to collect
+		if len(s.clusters) == 0 {
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, result, e.region))
+			return
 		}
-		totalCs++
-		go func(c types.ECSCluster) {
-			// Get services
-			ss, err := e.client.GetClusterServices(&c)
-			if err != nil {
-				errC <- true
-				log.Errorf("Error collecting cluster service metrics: %v", err)
-				return
-			}
-			e.collectClusterServicesMetrics(ctx, ch, &c, ss)
+		e.logger.Warnf("Using stale cluster list gathered at %s", s.clustersGatheredAt)
+	}
 
-			// Get container instance metrics (if enabled)
-			if e.noCIMetrics {
-				log.Debug("Container instance metrics disabled, no gathering these metrics...")
-				errC <- false
-				return
-			}
+	// Start every collector on its own goroutine
+	errC := make(chan bool, len(e.collectors))
+	for name, c := range e.collectors {
+		go func(name string, c subCollector) {
+			start := time.Now()
+			err := c.Update(ctx, s, ch)
+			duration := time.Since(start).Seconds()
 
-			cs, err := e.client.GetClusterContainerInstances(&c)
+			success := float64(1)
 			if err != nil {
-				errC <- true
-				log.Errorf("Error collecting cluster container instance metrics: %v", err)
-				return
+				e.logger.With("collector", name).Errorf("Error collecting metrics: %v", err)
+				success = 0
 			}
-			e.collectClusterContainerInstancesMetrics(ctx, ch, &c, cs)
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(e.scrapeDuration, prometheus.GaugeValue, duration, e.region, name))
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(e.scrapeSuccess, prometheus.GaugeValue, success, e.region, name))
 
-			errC <- false
-		}(*c)
+			errC <- err != nil
+		}(name, c)
 	}
 
-	// Grab result or not result error for each goroutine, on first error exit
-	result := float64(1)
+	// Grab result or not result error for each goroutine, wait all of them so
+	// the clusters that failed have time to export their stale data
+	timeoutC := time.After(e.timeout)
 
-ServiceCollector:
-	for i := 0; i < totalCs; i++ {
+Collectors:
+	for i := 0; i < len(e.collectors); i++ {
 		select {
 		case err := <-errC:
 			if err {
 				result = 0
-				break ServiceCollector
 			}
-		case <-time.After(e.timeout):
-			log.Errorf("Error collecting metrics: Timeout making calls, waited for %v  without response", e.timeout)
+		case <-timeoutC:
+			e.logger.Errorf("Error collecting metrics: Timeout making calls, waited for %v  without response", e.timeout)
 			result = 0
-			break ServiceCollector
+			break Collectors
+		case <-ctx.Done():
+			e.logger.Errorf("Error collecting metrics: Collection cancelled: %v", ctx.Err())
+			result = 0
+			break Collectors
 		}
 
 	}
-	ch <- prometheus.MustNewConstMetric(
-		up, prometheus.GaugeValue, result, e.region,
-	)
-}
 
-// validCluster will return true if the cluster is valid for the exporter cluster filtering regexp, otherwise false
-func (e *Exporter) validCluster(cluster *types.ECSCluster) bool {
-	return e.clusterFilter.MatchString(cluster.Name)
-}
+	// Data age
+	if e.staleGrace > 0 {
+		for _, c := range s.validClusters {
+			if age, ok := s.staleness(c.ID); ok {
+				sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(e.clusterDataStale, prometheus.GaugeValue, age.Seconds(), e.descs.values([]string{e.region, c.Name}, c.ID)...))
+			}
+		}
+	}
 
-func (e *Exporter) collectClusterMetrics(ctx context.Context, ch chan<- prometheus.Metric, clusters []*types.ECSCluster) {
-	// Total cluster count
-	sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(clusterCount, prometheus.GaugeValue, float64(len(clusters)), e.region))
+	ch <- prometheus.MustNewConstMetric(
+		e.up, prometheus.GaugeValue, result, e.region,
+	)
 }
 
-func (e *Exporter) collectClusterServicesMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, services []*types.ECSService) {
-
-	// Total services
-	sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(serviceCount, prometheus.GaugeValue, float64(len(services)), e.region, cluster.Name))
-
-	for _, s := range services {
-		// Desired task count
-		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(serviceDesired, prometheus.GaugeValue, float64(s.DesiredT), e.region, cluster.Name, s.Name))
-
-		// Pending task count
-		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(servicePending, prometheus.GaugeValue, float64(s.PendingT), e.region, cluster.Name, s.Name))
-
-		// Running task count
-		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(serviceRunning, prometheus.GaugeValue, float64(s.RunningT), e.region, cluster.Name, s.Name))
+// collectorNames returns the sorted names of the enabled collectors
+func (e *Exporter) collectorNames() []string {
+	names := []string{}
+	for name := range e.collectors {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
 
-func (e *Exporter) collectClusterContainerInstancesMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, cInstances []*types.ECSContainerInstance) {
-	// Total container instances
-	sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(cInstanceCount, prometheus.GaugeValue, float64(len(cInstances)), e.region, cluster.Name))
-
-	for _, c := range cInstances {
-		// Agent connected
-		var conn float64
-		if c.AgentConn {
-			conn = 1
-		}
-		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(cInstanceAgentC, prometheus.GaugeValue, conn, e.region, cluster.Name, c.InstanceID))
-
-		// Instance status
-		var active float64
-		if c.Active {
-			active = 1
-		}
-		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(cInstanceStatusAct, prometheus.GaugeValue, active, e.region, cluster.Name, c.InstanceID))
-
-		// Pending tasks
-		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(cInstancePending, prometheus.GaugeValue, float64(c.PendingT), e.region, cluster.Name, c.InstanceID))
-	}
+// validCluster will return true if the cluster is valid for the exporter cluster filter, otherwise false
+func (e *Exporter) validCluster(cluster *types.ECSCluster) bool {
+	return e.clusterFilter.match(cluster)
 }
 
-func init() {
-	prometheus.MustRegister(version.NewCollector("ecs_exporter"))
+// FamilyTypes returns the OpenMetrics types of the info and state set families of the exporter,
+// they are passed to the OpenMetrics writer so the families are not encoded as gauges
+func (e *Exporter) FamilyTypes() openmetrics.FamilyTypes {
+	res := openmetrics.FamilyTypes{}
+	for name, typ := range e.familyTypes {
+		res[name] = typ
+	}
+	return res
 }
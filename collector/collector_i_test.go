@@ -78,6 +78,93 @@ func (e *ECSMockClient) GetClusterContainerInstances(cluster *types.ECSCluster)
 	return cis, nil
 }
 
+func (e *ECSMockClient) GetInstances(instanceIDs []string) ([]*types.EC2Instance, error) {
+	if e.sleepFor > 0 {
+		time.Sleep(e.sleepFor)
+	}
+
+	// return the instances with only the ID
+	is := []*types.EC2Instance{}
+	for _, id := range instanceIDs {
+		is = append(is, &types.EC2Instance{ID: id})
+	}
+	return is, nil
+}
+
+func (e *ECSMockClient) GetAutoScalingGroups(instanceIDs []string) ([]*types.AutoScalingGroup, error) {
+	if e.sleepFor > 0 {
+		time.Sleep(e.sleepFor)
+	}
+
+	// return all the instances on the same group
+	g := &types.AutoScalingGroup{ID: "asg1", Name: "asg1"}
+	for _, id := range instanceIDs {
+		g.Instances = append(g.Instances, &types.AutoScalingInstance{InstanceID: id, LifecycleState: types.AutoScalingLifecycleInService})
+	}
+	return []*types.AutoScalingGroup{g}, nil
+}
+
+func (e *ECSMockClient) GetTaggedAutoScalingGroups(key, value string) ([]*types.AutoScalingGroup, error) {
+	if e.sleepFor > 0 {
+		time.Sleep(e.sleepFor)
+	}
+
+	// return an empty group
+	return []*types.AutoScalingGroup{&types.AutoScalingGroup{ID: "asg1", Name: "asg1"}}, nil
+}
+
+func (e *ECSMockClient) GetServiceScalableTargets(cluster *types.ECSCluster, services []*types.ECSService) ([]*types.ScalableTarget, error) {
+	if e.sleepFor > 0 {
+		time.Sleep(e.sleepFor)
+	}
+
+	// return a target with the desired count bounds of each service
+	ts := []*types.ScalableTarget{}
+	for _, s := range services {
+		ts = append(ts, &types.ScalableTarget{ResourceID: "service/" + cluster.Name + "/" + s.Name, ServiceName: s.Name, MinCapacity: 1, MaxCapacity: s.DesiredT})
+	}
+	return ts, nil
+}
+
+func (e *ECSMockClient) GetTargetHealth(targetGroupARNs []string) ([]*types.TargetHealth, error) {
+	if e.sleepFor > 0 {
+		time.Sleep(e.sleepFor)
+	}
+
+	// return a healthy target on each target group
+	ths := []*types.TargetHealth{}
+	for _, tg := range targetGroupARNs {
+		ths = append(ths, &types.TargetHealth{TargetGroupARN: tg, TargetID: "i-1", Port: 80, State: types.TargetHealthStateHealthy})
+	}
+	return ths, nil
+}
+
+func (e *ECSMockClient) GetCloudWatchMetrics(cluster *types.ECSCluster, services []*types.ECSService, period, delay time.Duration) ([]*types.CloudWatchMetric, error) {
+	if e.sleepFor > 0 {
+		time.Sleep(e.sleepFor)
+	}
+
+	// return the CPU utilization of the cluster and its services
+	ms := []*types.CloudWatchMetric{&types.CloudWatchMetric{Name: types.CloudWatchCPUUtilization, Value: 50}}
+	for _, s := range services {
+		ms = append(ms, &types.CloudWatchMetric{Name: types.CloudWatchCPUUtilization, ServiceName: s.Name, Value: 50})
+	}
+	return ms, nil
+}
+
+func (e *ECSMockClient) GetTaskDefinitionImages(taskDefinitionARNs []string) ([]*types.ContainerImage, error) {
+	if e.sleepFor > 0 {
+		time.Sleep(e.sleepFor)
+	}
+
+	// return a container with a Docker Hub image on each task definition
+	is := []*types.ContainerImage{}
+	for _, td := range taskDefinitionARNs {
+		is = append(is, &types.ContainerImage{TaskDefinition: td, Container: "app", Image: "nginx:1.13", Repository: "nginx", Tag: "1.13"})
+	}
+	return is, nil
+}
+
 func TestCollectError(t *testing.T) {
 
 	tests := []struct {
@@ -108,7 +195,7 @@ func TestCollectError(t *testing.T) {
 			},
 		}
 
-		exp, err := New("eu-west-1", "", false)
+		exp, err := New(Config{Region: "eu-west-1"})
 		if err != nil {
 			t.Errorf("Creation of exporter shouldn't error: %v", err)
 		}
@@ -604,7 +691,11 @@ func TestCollectOk(t *testing.T) {
 			cid: test.cCInstances,
 		}
 
-		exp, err := New("eu-west-1", test.cFilter, test.disableCIM)
+		exp, err := New(Config{
+			Region:        "eu-west-1",
+			ClusterFilter: test.cFilter,
+			Collectors:    map[string]bool{"containerinstances": !test.disableCIM},
+		})
 		if err != nil {
 			t.Errorf("Creation of exporter shouldn't error: %v", err)
 		}
@@ -640,6 +731,117 @@ func TestCollectOk(t *testing.T) {
 	}
 }
 
+func TestCollectStaleData(t *testing.T) {
+	tests := []struct {
+		errorDescribeClusters bool
+		errorDescribeServices bool
+		dataAge               time.Duration
+		want                  []string
+		dontWant              []string
+	}{
+		{
+			errorDescribeClusters: false,
+			errorDescribeServices: true,
+			dataAge:               10 * time.Second,
+			want: []string{
+				`ecs_up{region="eu-west-1"} 0`,
+				`ecs_service_desired_tasks{cluster="cluster1",region="eu-west-1",service="service1"} 10`,
+				`ecs_container_instances{cluster="cluster1",region="eu-west-1"} 1`,
+				`ecs_cluster_data_stale_seconds{cluster="cluster1",region="eu-west-1"} 10.`,
+			},
+		},
+		{
+			errorDescribeClusters: true,
+			errorDescribeServices: true,
+			dataAge:               10 * time.Second,
+			want: []string{
+				`ecs_up{region="eu-west-1"} 0`,
+				`ecs_service_desired_tasks{cluster="cluster1",region="eu-west-1",service="service1"} 10`,
+				`ecs_container_instances{cluster="cluster1",region="eu-west-1"} 1`,
+				`ecs_cluster_data_stale_seconds{cluster="cluster1",region="eu-west-1"} 10.`,
+			},
+		},
+		{
+			errorDescribeClusters: false,
+			errorDescribeServices: true,
+			dataAge:               2 * time.Minute,
+			want: []string{
+				`ecs_up{region="eu-west-1"} 0`,
+				`ecs_container_instances{cluster="cluster1",region="eu-west-1"} 1`,
+				`ecs_cluster_data_stale_seconds{cluster="cluster1",region="eu-west-1"} 0`,
+			},
+			dontWant: []string{
+				`ecs_service_desired_tasks{cluster="cluster1",region="eu-west-1",service="service1"} 10`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		e := &ECSMockClient{
+			sd: map[string][]*types.ECSService{
+				"cluster1": []*types.ECSService{
+					&types.ECSService{ID: "s1", Name: "service1", DesiredT: 10, RunningT: 4, PendingT: 6},
+				},
+			},
+			cid: map[string][]*types.ECSContainerInstance{
+				"cluster1": []*types.ECSContainerInstance{
+					&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, PendingT: 0},
+				},
+			},
+		}
+
+		exp, err := New(Config{Region: "eu-west-1", ClusterFilter: ".*", StaleGracePeriod: time.Minute})
+		if err != nil {
+			t.Errorf("Creation of exporter shouldn't error: %v", err)
+		}
+		exp.client = e
+
+		// Register the exporter
+		prometheus.MustRegister(exp)
+
+		// Make a first good request
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+		prometheus.Handler().ServeHTTP(w, req)
+
+		freshM := `ecs_cluster_data_stale_seconds{cluster="cluster1",region="eu-west-1"} 0`
+		if !strings.Contains(w.Body.String(), freshM) {
+			t.Errorf("%+v\n -Expected metric data but missing: %s", test, freshM)
+		}
+
+		// Age the gathered data and make the AWS API fail
+		for _, d := range exp.cache.data {
+			d.gatheredAt = d.gatheredAt.Add(-test.dataAge)
+		}
+		e.cdError = test.errorDescribeClusters
+		e.sdError = test.errorDescribeServices
+
+		req, _ = http.NewRequest("GET", "/metrics", nil)
+		w = httptest.NewRecorder()
+		prometheus.Handler().ServeHTTP(w, req)
+
+		// Check the result
+		if w.Code != http.StatusOK {
+			t.Errorf("%+v\n -Metrics endpoing status code is wrong, got: %d; want: %d", test, w.Code, http.StatusOK)
+		}
+		got := w.Body.String()
+		for _, m := range test.want {
+			if !strings.Contains(got, m) {
+				t.Errorf("%+v\n -Expected metric data but missing: %s", test, m)
+			}
+		}
+
+		for _, m := range test.dontWant {
+			if strings.Contains(got, m) {
+				t.Errorf("%+v\n -Didn't expected metric data but found: %s", test, m)
+			}
+		}
+
+		// Unregister the exporter
+		prometheus.Unregister(exp)
+	}
+}
+
 func TestCollectTimeoutNoPanic(t *testing.T) {
 	// If fails should panic!
 	cServices := map[string][]*types.ECSService{
@@ -661,7 +863,7 @@ func TestCollectTimeoutNoPanic(t *testing.T) {
 		sleepFor: 10 * time.Millisecond,
 	}
 
-	exp, err := New("eu-west-1", ".*", false)
+	exp, err := New(Config{Region: "eu-west-1", ClusterFilter: ".*"})
 	if err != nil {
 		t.Errorf("Creation of exporter shouldn't error: %v", err)
 	}
@@ -3,7 +3,10 @@ package collector
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
@@ -33,199 +36,6 @@ func readGauge(g prometheus.Metric) metricResult {
 	}
 }
 
-func TestCollectClusterMetrics(t *testing.T) {
-	region := "eu-west-1"
-	exp, err := New(region, "", false)
-	if err != nil {
-		t.Errorf("Creation of exporter shoudnt error: %v", err)
-	}
-
-	ch := make(chan prometheus.Metric)
-	testCs := []*types.ECSCluster{}
-	for i := 0; i < 10; i++ {
-		c := &types.ECSCluster{
-			Name: fmt.Sprintf("cluster%d", i),
-			ID:   fmt.Sprintf("c%d", i),
-		}
-		testCs = append(testCs, c)
-	}
-
-	// Collect mocked metrics
-	go exp.collectClusterMetrics(context.TODO(), ch, testCs)
-
-	m := (<-ch).(prometheus.Metric)
-	m2 := readGauge(m)
-
-	expectedV := 10.0
-	// Check colected metrics are ok
-	if m2.value != expectedV {
-		t.Errorf("expected %f ecs_clusters, got %f", expectedV, m2.value)
-	}
-
-	if m2.labels["region"] != region {
-		t.Errorf("expected %s region, got %s", region, m2.labels["region"])
-	}
-
-	expected := `Desc{fqName: "ecs_clusters", help: "The total number of clusters", constLabels: {}, variableLabels: [region]}`
-	if expected != m.Desc().String() {
-		t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-	}
-}
-
-func TestCollectClusterServiceMetrics(t *testing.T) {
-	region := "eu-west-1"
-	exp, err := New(region, "", false)
-	if err != nil {
-		t.Errorf("Creation of exporter shouldnt error: %v", err)
-	}
-
-	ch := make(chan prometheus.Metric)
-
-	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
-	testSs := []*types.ECSService{
-		&types.ECSService{ID: "s1", Name: "service1", DesiredT: 10, PendingT: 5, RunningT: 5},
-		&types.ECSService{ID: "s2", Name: "service2", DesiredT: 15, PendingT: 5, RunningT: 10},
-		&types.ECSService{ID: "s3", Name: "service3", DesiredT: 30, PendingT: 27, RunningT: 0},
-		&types.ECSService{ID: "s4", Name: "service4", DesiredT: 51, PendingT: 50, RunningT: 1},
-		&types.ECSService{ID: "s5", Name: "service5", DesiredT: 109, PendingT: 99, RunningT: 2},
-		&types.ECSService{ID: "s6", Name: "service6", DesiredT: 6431, PendingT: 5000, RunningT: 107},
-	}
-	// Collect mocked metrics
-	go func() {
-		exp.collectClusterServicesMetrics(context.TODO(), ch, testC, testSs)
-		close(ch)
-	}()
-
-	// Check 1st received metric of services as group
-	m := (<-ch).(prometheus.Metric)
-	m2 := readGauge(m)
-	want := float64(len(testSs))
-	if m2.value != want {
-		t.Errorf("expected %f ecs_services, got %f", want, m2.value)
-	}
-	expected := `Desc{fqName: "ecs_services", help: "The total number of services", constLabels: {}, variableLabels: [region cluster]}`
-	if expected != m.Desc().String() {
-		t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-	}
-
-	for _, wantS := range testSs {
-		// Check 1st received metric  per service (desired)
-		m := (<-ch).(prometheus.Metric)
-		m2 := readGauge(m)
-		want := float64(wantS.DesiredT)
-		if m2.value != want {
-			t.Errorf("expected %f service_desired_tasks, got %f", want, m2.value)
-		}
-		expected := `Desc{fqName: "ecs_service_desired_tasks", help: "The desired number of instantiations of the task definition to keep running regarding a service", constLabels: {}, variableLabels: [region cluster service]}`
-		if expected != m.Desc().String() {
-			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-		}
-
-		// Check 1st received metric  per service (pending)
-		m = (<-ch).(prometheus.Metric)
-		m2 = readGauge(m)
-		want = float64(wantS.PendingT)
-		if m2.value != want {
-			t.Errorf("expected %f service_pending_tasks, got %f", want, m2.value)
-		}
-		expected = `Desc{fqName: "ecs_service_pending_tasks", help: "The number of tasks in the cluster that are in the PENDING state regarding a service", constLabels: {}, variableLabels: [region cluster service]}`
-		if expected != m.Desc().String() {
-			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-		}
-
-		// Check 1st received metric  per service (running)
-		m = (<-ch).(prometheus.Metric)
-		m2 = readGauge(m)
-		want = float64(wantS.RunningT)
-		if m2.value != want {
-			t.Errorf("expected %f service_running_tasks, got %f", want, m2.value)
-		}
-		expected = `Desc{fqName: "ecs_service_running_tasks", help: "The number of tasks in the cluster that are in the RUNNING state regarding a service", constLabels: {}, variableLabels: [region cluster service]}`
-		if expected != m.Desc().String() {
-			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-		}
-	}
-}
-
-func TestCollectClusterContainerInstanceMetrics(t *testing.T) {
-	region := "eu-west-1"
-	exp, err := New(region, "", false)
-	if err != nil {
-		t.Errorf("Creation of exporter shouldnt error: %v", err)
-	}
-
-	ch := make(chan prometheus.Metric)
-
-	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
-	testCIs := []*types.ECSContainerInstance{
-		&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, PendingT: 12},
-		&types.ECSContainerInstance{ID: "ci1", InstanceID: "i-00000000000000001", AgentConn: false, Active: true, PendingT: 7},
-		&types.ECSContainerInstance{ID: "ci2", InstanceID: "i-00000000000000002", AgentConn: true, Active: false, PendingT: 24},
-		&types.ECSContainerInstance{ID: "ci3", InstanceID: "i-00000000000000003", AgentConn: false, Active: false, PendingT: 197},
-	}
-	// Collect mocked metrics
-	go func() {
-		exp.collectClusterContainerInstancesMetrics(context.TODO(), ch, testC, testCIs)
-		close(ch)
-	}()
-
-	// Check 1st received metric of container instances as group
-	m := (<-ch).(prometheus.Metric)
-	m2 := readGauge(m)
-	want := float64(len(testCIs))
-	if m2.value != want {
-		t.Errorf("expected %f container_instances, got %f", want, m2.value)
-	}
-	expected := `Desc{fqName: "ecs_container_instances", help: "The total number of container instances", constLabels: {}, variableLabels: [region cluster]}`
-	if expected != m.Desc().String() {
-		t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-	}
-
-	for _, wantCi := range testCIs {
-		// Check 1st received metric per container instance (agent connected)
-		m := (<-ch).(prometheus.Metric)
-		m2 := readGauge(m)
-		var want float64
-		if wantCi.AgentConn {
-			want = 1
-		}
-		if m2.value != want {
-			t.Errorf("expected %f container_instance_agent_connected, got %f", want, m2.value)
-		}
-		expected := `Desc{fqName: "ecs_container_instance_agent_connected", help: "The connected state of the container instance agent", constLabels: {}, variableLabels: [region cluster instance]}`
-		if expected != m.Desc().String() {
-			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-		}
-
-		// Check 1st received metric per container instance (status active)
-		m = (<-ch).(prometheus.Metric)
-		m2 = readGauge(m)
-		want = 0
-		if wantCi.Active {
-			want = 1
-		}
-		if m2.value != want {
-			t.Errorf("expected %f container_instance_active, got %f", want, m2.value)
-		}
-		expected = `Desc{fqName: "ecs_container_instance_active", help: "The status of the container instance in ACTIVE state, indicates that the container instance can accept tasks.", constLabels: {}, variableLabels: [region cluster instance]}`
-		if expected != m.Desc().String() {
-			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-		}
-
-		// Check 1st received metric  per service (running)
-		m = (<-ch).(prometheus.Metric)
-		m2 = readGauge(m)
-		want = float64(wantCi.PendingT)
-		if m2.value != want {
-			t.Errorf("expected %f container_instance_pending_tasks, got %f", want, m2.value)
-		}
-		expected = `Desc{fqName: "ecs_container_instance_pending_tasks", help: "The number of tasks on the container instance that are in the PENDING status.", constLabels: {}, variableLabels: [region cluster instance]}`
-		if expected != m.Desc().String() {
-			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
-		}
-	}
-}
-
 func TestValidClusters(t *testing.T) {
 	tests := []struct {
 		filter    string
@@ -280,7 +90,7 @@ func TestValidClusters(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		e, err := New("eu-west-1", test.filter, false)
+		e, err := New(Config{Region: "eu-west-1", ClusterFilter: test.filter})
 		if err != nil {
 			t.Errorf("Creation of exporter shoudn't error: %v", err)
 		}
@@ -302,61 +112,168 @@ func TestValidClusters(t *testing.T) {
 	}
 }
 
-func TestCollectClusterMetricsTimeout(t *testing.T) {
-	defer func() {
-		if r := recover(); r != nil {
-			t.Errorf("Test shouldn't panic, it did: %v", r)
+func TestNewCollectors(t *testing.T) {
+	tests := []struct {
+		collectors  map[string]bool
+		want        []string
+		expectError bool
+	}{
+		{
+			collectors: nil,
+			want:       []string{"clusters", "containerinstances", "services"},
+		},
+		{
+			collectors: map[string]bool{"containerinstances": false},
+			want:       []string{"clusters", "services"},
+		},
+		{
+			collectors: map[string]bool{"clusters": false, "containerinstances": false, "services": true},
+			want:       []string{"services"},
+		},
+		{
+			collectors:  map[string]bool{"wrong": true},
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		e, err := New(Config{Region: "eu-west-1", Collectors: test.collectors})
+		if test.expectError {
+			if err == nil {
+				t.Errorf("\n- %v\n- Creation of exporter should error, it didn't", test)
+			}
+			continue
 		}
-	}()
 
-	exp, _ := New("eu-west-1", "", false)
-	ch := make(chan prometheus.Metric)
-	close(ch)
+		if err != nil {
+			t.Errorf("\n- %v\n- Creation of exporter shouldn't error, it did: %v", test, err)
+			continue
+		}
 
-	testCs := []*types.ECSCluster{&types.ECSCluster{ID: "c1", Name: "cluster1"}}
+		got := e.collectorNames()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("\n- %v\n- Enabled collectors are wrong, want: %v; got: %v", test, test.want, got)
+		}
+	}
+}
 
-	// Cancel the context to mock as a finished main function
-	ctx, cancel := context.WithCancel(context.Background())
-	cancel()
-	exp.collectClusterMetrics(ctx, ch, testCs)
+func TestNewRegister(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	e, err := New(Config{Region: "eu-west-1", Registerer: reg})
+	if err != nil {
+		t.Fatalf("Creation of exporter shouldn't error: %v", err)
+	}
+
+	if err := reg.Register(e); err == nil {
+		t.Errorf("Exporter should be already registered, it wasn't")
+	}
+
+	// Can't register twice on the same registry
+	if _, err := New(Config{Region: "eu-west-1", Registerer: reg}); err == nil {
+		t.Errorf("Creation of a second exporter on the same registry should error, it didn't")
+	}
 }
 
-func TestCollectClusterServiceMetricsTimeout(t *testing.T) {
-	defer func() {
-		if r := recover(); r != nil {
-			t.Errorf("Test shouldn't panic, it did: %v", r)
-		}
-	}()
+func TestNewMetricsConfig(t *testing.T) {
+	tests := []struct {
+		namespace   string
+		constLabels map[string]string
+		expectError bool
+		expectedUp  string
+	}{
+		{"", nil, false, `Desc{fqName: "ecs_up", help: "Was the last query of ecs successful.", constLabels: {}, variableLabels: [region]}`},
+		{"aws_ecs", nil, false, `Desc{fqName: "aws_ecs_up", help: "Was the last query of ecs successful.", constLabels: {}, variableLabels: [region]}`},
+		{"", map[string]string{"environment": "prod"}, false, `Desc{fqName: "ecs_up", help: "Was the last query of ecs successful.", constLabels: {environment="prod"}, variableLabels: [region]}`},
+		{"wrong-namespace", nil, true, ""},
+		{"", map[string]string{"wrong-label": "prod"}, true, ""},
+		{"", map[string]string{"region": "eu-west-1"}, true, ""},
+		{"", map[string]string{"cluster": "cluster1"}, true, ""},
+	}
 
-	exp, _ := New("eu-west-1", "", false)
-	ch := make(chan prometheus.Metric)
-	close(ch)
+	for _, test := range tests {
+		e, err := New(Config{Region: "eu-west-1", Namespace: test.namespace, ConstLabels: test.constLabels})
+		if test.expectError {
+			if err == nil {
+				t.Errorf("\n- %v\n- Creation of exporter should error, it didn't", test)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("\n- %v\n- Creation of exporter shouldn't error, it did: %v", test, err)
+			continue
+		}
 
-	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
-	testSs := []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1", DesiredT: 10, PendingT: 5, RunningT: 5}}
+		if got := e.up.String(); got != test.expectedUp {
+			t.Errorf("\n- %v\n- Up descriptor is wrong, want: %s; got: %s", test, test.expectedUp, got)
+		}
 
-	// Cancel the context to mock as a finished main function
-	ctx, cancel := context.WithCancel(context.Background())
-	cancel()
-	exp.collectClusterServicesMetrics(ctx, ch, testC, testSs)
+		// Every descriptor has the constant labels
+		ch := make(chan *prometheus.Desc)
+		go func() {
+			e.Describe(ch)
+			close(ch)
+		}()
+		for d := range ch {
+			for k, v := range test.constLabels {
+				if !strings.Contains(d.String(), fmt.Sprintf("%s=%q", k, v)) {
+					t.Errorf("\n- %v\n- Descriptor is missing the constant label %s: %s", test, k, d)
+				}
+			}
+		}
+	}
 }
 
-func TestCollectContainerInstanceMetricsTimeout(t *testing.T) {
-	defer func() {
-		if r := recover(); r != nil {
-			t.Errorf("Test shouldn't panic, it did: %v", r)
-		}
-	}()
+// blockingTestClient is an ECSGatherer whose cluster data calls block until released
+type blockingTestClient struct {
+	ECSGatherer
+	release chan struct{}
+}
 
-	exp, _ := New("eu-west-1", "", false)
-	ch := make(chan prometheus.Metric)
-	close(ch)
+func (c *blockingTestClient) GetClusters() ([]*types.ECSCluster, error) {
+	return []*types.ECSCluster{&types.ECSCluster{ID: "c1", Name: "cluster1"}}, nil
+}
 
-	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
-	testCIs := []*types.ECSContainerInstance{&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, PendingT: 12}}
+func (c *blockingTestClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSService, error) {
+	<-c.release
+	return nil, nil
+}
 
-	// Cancel the context to mock as a finished main function
+func TestCollectCancelled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
+	e, err := New(Config{
+		Region:     "eu-west-1",
+		Collectors: map[string]bool{"clusters": false, "containerinstances": false},
+		Context:    ctx,
+	})
+	if err != nil {
+		t.Fatalf("Creation of exporter shouldn't error: %v", err)
+	}
+	c := &blockingTestClient{release: make(chan struct{})}
+	defer close(c.release)
+	e.client = c
+
+	ch := make(chan prometheus.Metric, 100)
+	done := make(chan struct{})
+	go func() {
+		e.Collect(ch)
+		close(done)
+	}()
+
 	cancel()
-	exp.collectClusterContainerInstancesMetrics(ctx, ch, testC, testCIs)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Collection should finish when the exporter context is cancelled, it didn't")
+	}
+
+	// The last metric is up
+	var last prometheus.Metric
+	for len(ch) > 0 {
+		last = <-ch
+	}
+	m := &dto.Metric{}
+	last.Write(m)
+	if m.GetGauge().GetValue() != 0 {
+		t.Errorf("Cancelled collection should set up to 0, got: %v", m.GetGauge().GetValue())
+	}
 }
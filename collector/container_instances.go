@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func init() {
+	registerCollector("containerinstances", true, newContainerInstancesCollector)
+}
+
+// containerInstancesCollector collects the metrics of the cluster container instances
+type containerInstancesCollector struct {
+	region  string
+	d       descBuilder
+	arnInfo bool // Export the info metrics with the ARNs
+	ec2Info bool // Add the EC2 instance data to the info metrics
+
+	// Metrics descriptions
+	cInstanceCount     *prometheus.Desc
+	cInstanceAgentC    *prometheus.Desc
+	cInstanceStatusAct *prometheus.Desc
+	cInstancePending   *prometheus.Desc
+	cInstanceInfo      *prometheus.Desc
+	cInstanceLaunch    *prometheus.Desc
+}
+
+// newContainerInstancesCollector returns an initialized container instances collector
+func newContainerInstancesCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	infoLabels := []string{"region", "cluster", "instance"}
+	if cfg.EC2Info {
+		infoLabels = append(infoLabels, "instance_type", "availability_zone", "lifecycle", "private_ip")
+	}
+	return &containerInstancesCollector{
+		region:  cfg.Region,
+		d:       d,
+		arnInfo: cfg.ARNInfo,
+		ec2Info: cfg.EC2Info,
+
+		cInstanceCount: d.desc("", "container_instances",
+			"The total number of container instances",
+			"region", "cluster"),
+		cInstanceAgentC: d.desc("", "container_instance_agent_connected",
+			"The connected state of the container instance agent",
+			"region", "cluster", "instance"),
+		cInstanceStatusAct: d.desc("", "container_instance_active",
+			"The status of the container instance in ACTIVE state, indicates that the container instance can accept tasks.",
+			"region", "cluster", "instance"),
+		cInstancePending: d.desc("", "container_instance_pending_tasks",
+			"The number of tasks on the container instance that are in the PENDING status.",
+			"region", "cluster", "instance"),
+		cInstanceInfo: d.infoDesc("container_instance",
+			"Information of the container instance, always 1",
+			infoLabels...),
+		cInstanceLaunch: d.desc("", "container_instance_launch_time_seconds",
+			"The launch time of the container instance EC2 instance since unix epoch in seconds.",
+			"region", "cluster", "instance"),
+	}
+}
+
+// Describe implements subCollector
+func (c *containerInstancesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cInstanceCount
+	ch <- c.cInstanceAgentC
+	ch <- c.cInstanceStatusAct
+	ch <- c.cInstancePending
+	if c.arnInfo || c.ec2Info {
+		ch <- c.cInstanceInfo
+	}
+	if c.ec2Info {
+		ch <- c.cInstanceLaunch
+	}
+}
+
+// Update implements subCollector
+func (c *containerInstancesCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	return s.forEachCluster(func(cluster *types.ECSCluster) error {
+		cis, err := s.containerInstances(cluster)
+		if err != nil && cis == nil {
+			return err
+		}
+
+		// The EC2 data is optional, the container instances metrics are exported without it
+		var instances map[string]*types.EC2Instance
+		if c.ec2Info && len(cis) > 0 {
+			is, ec2Err := s.instances(cluster, cis)
+			if ec2Err != nil && err == nil {
+				err = ec2Err
+			}
+			instances = map[string]*types.EC2Instance{}
+			for _, i := range is {
+				instances[i.ID] = i
+			}
+		}
+
+		c.collectClusterContainerInstancesMetrics(ctx, ch, cluster, cis, instances)
+		return err
+	})
+}
+
+// collectClusterContainerInstancesMetrics sends the container instances metrics, instances has the EC2
+// instances by ID when the EC2 data is enabled
+func (c *containerInstancesCollector) collectClusterContainerInstancesMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, cInstances []*types.ECSContainerInstance, instances map[string]*types.EC2Instance) {
+	// Total container instances
+	sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.cInstanceCount, prometheus.GaugeValue, float64(len(cInstances)), c.d.values([]string{c.region, cluster.Name}, cluster.ID)...))
+
+	for _, ci := range cInstances {
+		values := c.d.values([]string{c.region, cluster.Name, ci.InstanceID}, cluster.ID, ci.ID)
+
+		// Agent connected
+		var conn float64
+		if ci.AgentConn {
+			conn = 1
+		}
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.cInstanceAgentC, prometheus.GaugeValue, conn, values...))
+
+		// Instance status
+		var active float64
+		if ci.Active {
+			active = 1
+		}
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.cInstanceStatusAct, prometheus.GaugeValue, active, values...))
+
+		// Pending tasks
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.cInstancePending, prometheus.GaugeValue, float64(ci.PendingT), values...))
+
+		if !c.arnInfo && !c.ec2Info {
+			continue
+		}
+
+		// Info
+		infoValues := []string{c.region, cluster.Name, ci.InstanceID}
+		if c.ec2Info {
+			i, ok := instances[ci.InstanceID]
+			if !ok {
+				i = &types.EC2Instance{}
+			}
+			infoValues = append(infoValues, i.Type, i.AvailabilityZone, i.Lifecycle, i.PrivateIP)
+
+			// Launch time
+			if ok && !i.LaunchTime.IsZero() {
+				sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.cInstanceLaunch, prometheus.GaugeValue, float64(i.LaunchTime.Unix()), values...))
+			}
+		}
+		infoValues = append(infoValues, cluster.ID, ci.ID)
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.cInstanceInfo, prometheus.GaugeValue, 1, infoValues...))
+	}
+}
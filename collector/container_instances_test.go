@@ -0,0 +1,198 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestCollectClusterContainerInstanceMetrics(t *testing.T) {
+	region := "eu-west-1"
+	exp := newContainerInstancesCollector(Config{Region: region}).(*containerInstancesCollector)
+
+	ch := make(chan prometheus.Metric)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testCIs := []*types.ECSContainerInstance{
+		&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, PendingT: 12},
+		&types.ECSContainerInstance{ID: "ci1", InstanceID: "i-00000000000000001", AgentConn: false, Active: true, PendingT: 7},
+		&types.ECSContainerInstance{ID: "ci2", InstanceID: "i-00000000000000002", AgentConn: true, Active: false, PendingT: 24},
+		&types.ECSContainerInstance{ID: "ci3", InstanceID: "i-00000000000000003", AgentConn: false, Active: false, PendingT: 197},
+	}
+	// Collect mocked metrics
+	go func() {
+		exp.collectClusterContainerInstancesMetrics(context.TODO(), ch, testC, testCIs, nil)
+		close(ch)
+	}()
+
+	// Check 1st received metric of container instances as group
+	m := (<-ch).(prometheus.Metric)
+	m2 := readGauge(m)
+	want := float64(len(testCIs))
+	if m2.value != want {
+		t.Errorf("expected %f container_instances, got %f", want, m2.value)
+	}
+	expected := `Desc{fqName: "ecs_container_instances", help: "The total number of container instances", constLabels: {}, variableLabels: [region cluster]}`
+	if expected != m.Desc().String() {
+		t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+	}
+
+	for _, wantCi := range testCIs {
+		// Check 1st received metric per container instance (agent connected)
+		m := (<-ch).(prometheus.Metric)
+		m2 := readGauge(m)
+		var want float64
+		if wantCi.AgentConn {
+			want = 1
+		}
+		if m2.value != want {
+			t.Errorf("expected %f container_instance_agent_connected, got %f", want, m2.value)
+		}
+		expected := `Desc{fqName: "ecs_container_instance_agent_connected", help: "The connected state of the container instance agent", constLabels: {}, variableLabels: [region cluster instance]}`
+		if expected != m.Desc().String() {
+			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+		}
+
+		// Check 1st received metric per container instance (status active)
+		m = (<-ch).(prometheus.Metric)
+		m2 = readGauge(m)
+		want = 0
+		if wantCi.Active {
+			want = 1
+		}
+		if m2.value != want {
+			t.Errorf("expected %f container_instance_active, got %f", want, m2.value)
+		}
+		expected = `Desc{fqName: "ecs_container_instance_active", help: "The status of the container instance in ACTIVE state, indicates that the container instance can accept tasks.", constLabels: {}, variableLabels: [region cluster instance]}`
+		if expected != m.Desc().String() {
+			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+		}
+
+		// Check 1st received metric  per service (running)
+		m = (<-ch).(prometheus.Metric)
+		m2 = readGauge(m)
+		want = float64(wantCi.PendingT)
+		if m2.value != want {
+			t.Errorf("expected %f container_instance_pending_tasks, got %f", want, m2.value)
+		}
+		expected = `Desc{fqName: "ecs_container_instance_pending_tasks", help: "The number of tasks on the container instance that are in the PENDING status.", constLabels: {}, variableLabels: [region cluster instance]}`
+		if expected != m.Desc().String() {
+			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+		}
+	}
+}
+
+func TestCollectContainerInstanceMetricsTimeout(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Test shouldn't panic, it did: %v", r)
+		}
+	}()
+
+	exp := newContainerInstancesCollector(Config{Region: "eu-west-1"}).(*containerInstancesCollector)
+	ch := make(chan prometheus.Metric)
+	close(ch)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testCIs := []*types.ECSContainerInstance{&types.ECSContainerInstance{ID: "ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true, PendingT: 12}}
+
+	// Cancel the context to mock as a finished main function
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exp.collectClusterContainerInstancesMetrics(ctx, ch, testC, testCIs, nil)
+}
+
+func TestCollectClusterContainerInstanceMetricsARNs(t *testing.T) {
+	tests := []struct {
+		arnLabels       bool
+		arnInfo         bool
+		expectedMetrics int
+		expectedLabels  map[string]string // The labels of the container instance metrics
+	}{
+		{false, false, 4, map[string]string{"region": "eu-west-1", "cluster": "cluster1", "instance": "i-00000000000000000"}},
+		{true, false, 4, map[string]string{"region": "eu-west-1", "cluster": "cluster1", "instance": "i-00000000000000000", "cluster_arn": "arn:c1", "container_instance_arn": "arn:ci0"}},
+		{true, true, 5, map[string]string{"region": "eu-west-1", "cluster": "cluster1", "instance": "i-00000000000000000", "cluster_arn": "arn:c1", "container_instance_arn": "arn:ci0"}},
+	}
+
+	for _, test := range tests {
+		exp := newContainerInstancesCollector(Config{Region: "eu-west-1", ARNLabels: test.arnLabels, ARNInfo: test.arnInfo}).(*containerInstancesCollector)
+		ch := make(chan prometheus.Metric)
+		testC := &types.ECSCluster{ID: "arn:c1", Name: "cluster1"}
+		testCIs := []*types.ECSContainerInstance{&types.ECSContainerInstance{ID: "arn:ci0", InstanceID: "i-00000000000000000", AgentConn: true, Active: true}}
+		go func() {
+			exp.collectClusterContainerInstancesMetrics(context.TODO(), ch, testC, testCIs, nil)
+			close(ch)
+		}()
+
+		ms := []prometheus.Metric{}
+		for m := range ch {
+			ms = append(ms, m)
+		}
+		if len(ms) != test.expectedMetrics {
+			t.Errorf("\n- %v\n- Number of metrics is wrong, want: %d; got: %d", test, test.expectedMetrics, len(ms))
+			continue
+		}
+
+		for _, m := range ms[1:4] {
+			got := readGauge(m).labels
+			if !reflect.DeepEqual(got, test.expectedLabels) {
+				t.Errorf("\n- %v\n- Labels are wrong, want: %v; got: %v", test, test.expectedLabels, got)
+			}
+		}
+
+		if test.arnInfo && !strings.Contains(ms[4].Desc().String(), `fqName: "ecs_container_instance_info"`) {
+			t.Errorf("\n- %v\n- Info metric name is wrong: %s", test, ms[4].Desc())
+		}
+	}
+}
+
+func TestCollectClusterContainerInstanceMetricsEC2(t *testing.T) {
+	launch := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	exp := newContainerInstancesCollector(Config{Region: "eu-west-1", EC2Info: true}).(*containerInstancesCollector)
+	ch := make(chan prometheus.Metric)
+	testC := &types.ECSCluster{ID: "arn:c1", Name: "cluster1"}
+	testCIs := []*types.ECSContainerInstance{
+		&types.ECSContainerInstance{ID: "arn:ci0", InstanceID: "i-0"},
+		&types.ECSContainerInstance{ID: "arn:ci1", InstanceID: "i-1"},
+	}
+	instances := map[string]*types.EC2Instance{
+		"i-0": &types.EC2Instance{ID: "i-0", Type: "m4.large", AvailabilityZone: "eu-west-1a", Lifecycle: "spot", LaunchTime: launch, PrivateIP: "10.0.0.1"},
+	}
+	go func() {
+		exp.collectClusterContainerInstancesMetrics(context.TODO(), ch, testC, testCIs, instances)
+		close(ch)
+	}()
+
+	infos := []map[string]string{}
+	launches := map[string]float64{}
+	for m := range ch {
+		desc := m.Desc().String()
+		switch {
+		case strings.Contains(desc, `fqName: "ecs_container_instance_info"`):
+			infos = append(infos, readGauge(m).labels)
+		case strings.Contains(desc, `fqName: "ecs_container_instance_launch_time_seconds"`):
+			g := readGauge(m)
+			launches[g.labels["instance"]] = g.value
+		}
+	}
+
+	expectedInfos := []map[string]string{
+		{"region": "eu-west-1", "cluster": "cluster1", "instance": "i-0", "instance_type": "m4.large", "availability_zone": "eu-west-1a", "lifecycle": "spot", "private_ip": "10.0.0.1", "cluster_arn": "arn:c1", "container_instance_arn": "arn:ci0"},
+		{"region": "eu-west-1", "cluster": "cluster1", "instance": "i-1", "instance_type": "", "availability_zone": "", "lifecycle": "", "private_ip": "", "cluster_arn": "arn:c1", "container_instance_arn": "arn:ci1"},
+	}
+	if !reflect.DeepEqual(infos, expectedInfos) {
+		t.Errorf("Info metrics are wrong, want: %v; got: %v", expectedInfos, infos)
+	}
+
+	// Only the described instances have launch time
+	expectedLaunches := map[string]float64{"i-0": float64(launch.Unix())}
+	if !reflect.DeepEqual(launches, expectedLaunches) {
+		t.Errorf("Launch time metrics are wrong, want: %v; got: %v", expectedLaunches, launches)
+	}
+}
@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+// arnPrefix is the prefix of the filter patterns and names matched against the cluster ARN
+const arnPrefix = "arn:"
+
+// ClusterFilter selects the clusters of the exporter, the patterns and names starting with "arn:"
+// (or "^arn:") are matched against the cluster ARN, the rest against the cluster name. A cluster
+// is exported if it's included and not excluded, the exclusions have priority
+type ClusterFilter struct {
+	Include      []string // Regular expresions of the included clusters, if there are no inclusions all the clusters are included
+	Exclude      []string // Regular expresions of the excluded clusters
+	IncludeNames []string // Exact names of the included clusters
+	ExcludeNames []string // Exact names of the excluded clusters
+}
+
+// clusterPattern is a compiled cluster filter regular expresion
+type clusterPattern struct {
+	re  *regexp.Regexp
+	arn bool // Match against the ARN instead of the name
+}
+
+// match returns true if the cluster matches the pattern
+func (p clusterPattern) match(c *types.ECSCluster) bool {
+	if p.arn {
+		return p.re.MatchString(c.ID)
+	}
+	return p.re.MatchString(c.Name)
+}
+
+// clusterMatcher is a compiled cluster filter
+type clusterMatcher struct {
+	include      []clusterPattern
+	exclude      []clusterPattern
+	includeNames map[string]bool
+	excludeNames map[string]bool
+}
+
+// newClusterMatcher compiles the cluster filter, the legacy filter (if not empty) is another inclusion pattern
+func newClusterMatcher(legacyFilter string, f ClusterFilter) (*clusterMatcher, error) {
+	include := f.Include
+	if legacyFilter != "" {
+		include = append([]string{legacyFilter}, include...)
+	}
+
+	m := &clusterMatcher{
+		includeNames: namesSet(f.IncludeNames),
+		excludeNames: namesSet(f.ExcludeNames),
+	}
+	var err error
+	if m.include, err = compilePatterns(include); err != nil {
+		return nil, err
+	}
+	if m.exclude, err = compilePatterns(f.Exclude); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// compilePatterns compiles the cluster filter regular expresions
+func compilePatterns(patterns []string) ([]clusterPattern, error) {
+	res := []clusterPattern{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cluster filter %s: %v", p, err)
+		}
+		res = append(res, clusterPattern{re: re, arn: strings.HasPrefix(strings.TrimPrefix(p, "^"), arnPrefix)})
+	}
+	return res, nil
+}
+
+// namesSet returns the names as a set
+func namesSet(names []string) map[string]bool {
+	res := map[string]bool{}
+	for _, n := range names {
+		res[n] = true
+	}
+	return res
+}
+
+// matchAny returns true if the cluster matches any of the patterns or names
+func matchAny(c *types.ECSCluster, patterns []clusterPattern, names map[string]bool) bool {
+	if names[c.Name] || names[c.ID] {
+		return true
+	}
+	for _, p := range patterns {
+		if p.match(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns true if the cluster passes the filter
+func (m *clusterMatcher) match(c *types.ECSCluster) bool {
+	if matchAny(c, m.exclude, m.excludeNames) {
+		return false
+	}
+	if len(m.include) == 0 && len(m.includeNames) == 0 {
+		return true
+	}
+	return matchAny(c, m.include, m.includeNames)
+}
+
+// ServiceFilter selects the services of the exporter by name, a service is exported if it's
+// included and not excluded, the exclusions have priority
+type ServiceFilter struct {
+	Include []string // Regular expresions of the included service names, if there are no inclusions all the services are included
+	Exclude []string // Regular expresions of the excluded service names
+}
+
+// serviceMatcher is a compiled service filter
+type serviceMatcher struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newServiceMatcher compiles the service filter, nil if there isn't any filter
+func newServiceMatcher(f ServiceFilter) (*serviceMatcher, error) {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return nil, nil
+	}
+
+	m := &serviceMatcher{}
+	for _, p := range f.Include {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service filter %s: %v", p, err)
+		}
+		m.include = append(m.include, re)
+	}
+	for _, p := range f.Exclude {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service filter %s: %v", p, err)
+		}
+		m.exclude = append(m.exclude, re)
+	}
+	return m, nil
+}
+
+// match returns true if the service name passes the filter
+func (m *serviceMatcher) match(name string) bool {
+	for _, re := range m.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, re := range m.include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceNameFromARN returns the name of a service from its ARN, the ARNs have the
+// arn:aws:ecs:region:account:service/name or arn:aws:ecs:region:account:service/cluster/name formats
+func serviceNameFromARN(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
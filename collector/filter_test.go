@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestClusterFilter(t *testing.T) {
+	clusters := []*types.ECSCluster{
+		&types.ECSCluster{ID: "arn:aws:ecs:eu-west-1:111111111111:cluster/prod-cluster-main", Name: "prod-cluster-main"},
+		&types.ECSCluster{ID: "arn:aws:ecs:eu-west-1:111111111111:cluster/prod-sandbox-main", Name: "prod-sandbox-main"},
+		&types.ECSCluster{ID: "arn:aws:ecs:eu-west-1:222222222222:cluster/staging-cluster-main", Name: "staging-cluster-main"},
+		&types.ECSCluster{ID: "arn:aws:ecs:eu-west-1:222222222222:cluster/legacy", Name: "legacy"},
+	}
+
+	tests := []struct {
+		legacyFilter string
+		filter       ClusterFilter
+		expected     []string
+	}{
+		{"", ClusterFilter{}, []string{"prod-cluster-main", "prod-sandbox-main", "staging-cluster-main", "legacy"}},
+		{".*", ClusterFilter{}, []string{"prod-cluster-main", "prod-sandbox-main", "staging-cluster-main", "legacy"}},
+		{"^prod-", ClusterFilter{}, []string{"prod-cluster-main", "prod-sandbox-main"}},
+		{"", ClusterFilter{Exclude: []string{"-sandbox-"}, ExcludeNames: []string{"legacy"}}, []string{"prod-cluster-main", "staging-cluster-main"}},
+		{"", ClusterFilter{Include: []string{"^prod-", "^staging-"}, Exclude: []string{"-sandbox-"}}, []string{"prod-cluster-main", "staging-cluster-main"}},
+		{"", ClusterFilter{IncludeNames: []string{"legacy", "prod-sandbox-main"}}, []string{"prod-sandbox-main", "legacy"}},
+		{"", ClusterFilter{IncludeNames: []string{"legacy"}, ExcludeNames: []string{"legacy"}}, []string{}},
+		{"", ClusterFilter{Include: []string{"^arn:aws:ecs:eu-west-1:222222222222:"}}, []string{"staging-cluster-main", "legacy"}},
+		{"", ClusterFilter{ExcludeNames: []string{"arn:aws:ecs:eu-west-1:222222222222:cluster/legacy"}}, []string{"prod-cluster-main", "prod-sandbox-main", "staging-cluster-main"}},
+		{"", ClusterFilter{Include: []string{"111111111111"}}, []string{}},
+		{"^staging-", ClusterFilter{IncludeNames: []string{"legacy"}}, []string{"staging-cluster-main", "legacy"}},
+	}
+
+	for _, test := range tests {
+		m, err := newClusterMatcher(test.legacyFilter, test.filter)
+		if err != nil {
+			t.Fatalf("\n- %v\n- Creation of the cluster filter shouldn't error: %v", test, err)
+		}
+
+		got := []string{}
+		for _, c := range clusters {
+			if m.match(c) {
+				got = append(got, c.Name)
+			}
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("\n- %v\n- Filtered clusters are wrong, want: %v; got: %v", test, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("\n- %v\n- Filtered clusters are wrong, want: %v; got: %v", test, test.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestClusterFilterInvalid(t *testing.T) {
+	tests := []struct {
+		legacyFilter string
+		filter       ClusterFilter
+	}{
+		{"[", ClusterFilter{}},
+		{"", ClusterFilter{Include: []string{"["}}},
+		{"", ClusterFilter{Exclude: []string{"(?<!sandbox)"}}},
+	}
+
+	for _, test := range tests {
+		if _, err := newClusterMatcher(test.legacyFilter, test.filter); err == nil {
+			t.Errorf("\n- %v\n- Creation of the cluster filter should error, it didn't", test)
+		}
+	}
+}
+
+func TestServiceFilter(t *testing.T) {
+	names := []string{"api-prod", "api-staging", "worker-prod", "worker-prod-canary"}
+	tests := []struct {
+		filter   ServiceFilter
+		expected []string
+	}{
+		{ServiceFilter{Include: []string{"-prod"}}, []string{"api-prod", "worker-prod", "worker-prod-canary"}},
+		{ServiceFilter{Include: []string{"-prod$"}}, []string{"api-prod", "worker-prod"}},
+		{ServiceFilter{Exclude: []string{"-staging$", "canary"}}, []string{"api-prod", "worker-prod"}},
+		{ServiceFilter{Include: []string{"^api-", "^worker-"}, Exclude: []string{"^api-"}}, []string{"worker-prod", "worker-prod-canary"}},
+	}
+
+	for _, test := range tests {
+		m, err := newServiceMatcher(test.filter)
+		if err != nil {
+			t.Fatalf("\n- %v\n- Creation of the service filter shouldn't error: %v", test, err)
+		}
+
+		got := []string{}
+		for _, n := range names {
+			if m.match(n) {
+				got = append(got, n)
+			}
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("\n- %v\n- Filtered services are wrong, want: %v; got: %v", test, test.expected, got)
+		}
+	}
+
+	// Without filters there is no matcher
+	if m, err := newServiceMatcher(ServiceFilter{}); m != nil || err != nil {
+		t.Errorf("Empty service filter shouldn't have a matcher, got: %v, %v", m, err)
+	}
+	if _, err := newServiceMatcher(ServiceFilter{Exclude: []string{"["}}); err == nil {
+		t.Errorf("Invalid service filter should error, it didn't")
+	}
+}
+
+func TestServiceNameFromARN(t *testing.T) {
+	tests := []struct {
+		arn      string
+		expected string
+	}{
+		{"arn:aws:ecs:eu-west-1:111111111111:service/api-prod", "api-prod"},
+		{"arn:aws:ecs:eu-west-1:111111111111:service/prod-cluster/api-prod", "api-prod"},
+		{"api-prod", "api-prod"},
+	}
+
+	for _, test := range tests {
+		if got := serviceNameFromARN(test.arn); got != test.expected {
+			t.Errorf("\n- %v\n- Service name is wrong, want: %s; got: %s", test, test.expected, got)
+		}
+	}
+}
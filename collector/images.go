@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func init() {
+	registerCollector("images", false, newImagesCollector)
+}
+
+// imagesCollector collects the container images of the task definitions of the cluster services
+type imagesCollector struct {
+	region      string
+	maxServices int // The maximum number of services exported per cluster (0 means no limit)
+	d           descBuilder
+
+	// Metrics descriptions
+	serviceImageInfo *prometheus.Desc
+	serviceImageAge  *prometheus.Desc
+}
+
+// newImagesCollector returns an initialized images collector
+func newImagesCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	return &imagesCollector{
+		region:      cfg.Region,
+		maxServices: cfg.MaxServices,
+		d:           d,
+
+		serviceImageInfo: d.infoDesc("service_image",
+			"The image of a container of the service task definition, always 1",
+			"region", "cluster", "service", "container", "image", "repository", "tag", "digest"),
+		serviceImageAge: d.desc("service", "image_age_seconds",
+			"The time since the image of a container of the service task definition was pushed to ECR",
+			"region", "cluster", "service", "container"),
+	}
+}
+
+// Describe implements subCollector
+func (c *imagesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.serviceImageInfo
+	ch <- c.serviceImageAge
+}
+
+// Update implements subCollector
+func (c *imagesCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	return s.forEachCluster(func(cluster *types.ECSCluster) error {
+		// The same services as the services collector
+		ss, err := s.services(cluster)
+		ss = limitServices(ss, c.maxServices)
+		if len(ss) == 0 {
+			return err
+		}
+
+		is, iErr := s.images(cluster, ss)
+		if iErr == nil || is != nil {
+			c.collectClusterImagesMetrics(ctx, ch, cluster, ss, is, time.Now())
+		}
+		if err == nil {
+			err = iErr
+		}
+		return err
+	})
+}
+
+func (c *imagesCollector) collectClusterImagesMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, services []*types.ECSService, images []*types.ContainerImage, now time.Time) {
+	byTaskDef := map[string][]*types.ContainerImage{}
+	for _, i := range images {
+		byTaskDef[i.TaskDefinition] = append(byTaskDef[i.TaskDefinition], i)
+	}
+
+	for _, s := range services {
+		for _, i := range byTaskDef[s.TaskDefinition] {
+			// The info metrics always have the ARN labels
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceImageInfo, prometheus.GaugeValue, 1, c.region, cluster.Name, s.Name, i.Container, i.Image, i.Repository, i.Tag, i.Digest, cluster.ID, s.ID))
+
+			// Only the ECR images have push date
+			if i.PushedAt.IsZero() {
+				continue
+			}
+			values := c.d.values([]string{c.region, cluster.Name, s.Name, i.Container}, cluster.ID, s.ID)
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceImageAge, prometheus.GaugeValue, now.Sub(i.PushedAt).Seconds(), values...))
+		}
+	}
+}
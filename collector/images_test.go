@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestCollectClusterImagesMetrics(t *testing.T) {
+	exp := newImagesCollector(Config{Region: "eu-west-1"}).(*imagesCollector)
+	ch := make(chan prometheus.Metric)
+
+	now := time.Now()
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{
+		&types.ECSService{ID: "s1", Name: "service1", TaskDefinition: "td1"},
+		&types.ECSService{ID: "s2", Name: "service2", TaskDefinition: "td2"},
+		&types.ECSService{ID: "s3", Name: "service3", TaskDefinition: "td3"},
+	}
+	testIs := []*types.ContainerImage{
+		&types.ContainerImage{TaskDefinition: "td1", Container: "app", Image: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:v1", Repository: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", Tag: "v1", Digest: "sha256:aaa", PushedAt: now.Add(-time.Hour)},
+		&types.ContainerImage{TaskDefinition: "td1", Container: "proxy", Image: "nginx:1.13", Repository: "nginx", Tag: "1.13"},
+		&types.ContainerImage{TaskDefinition: "td2", Container: "app", Image: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app@sha256:bbb", Repository: "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", Digest: "sha256:bbb", PushedAt: now.Add(-24 * time.Hour)},
+	}
+	go func() {
+		exp.collectClusterImagesMetrics(context.TODO(), ch, testC, testSs, testIs, now)
+		close(ch)
+	}()
+
+	got := map[string]metricResult{}
+	for m := range ch {
+		g := readGauge(m)
+		desc := m.Desc().String()
+		name := desc[strings.Index(desc, `"`)+1 : strings.Index(desc, `",`)]
+		got[name+"/"+g.labels["service"]+"/"+g.labels["container"]] = g
+	}
+
+	// The services without images and the images without push date don't have age, the info metrics always have the ARNs
+	expected := map[string]metricResult{
+		"ecs_service_image_info/service1/app": metricResult{1, map[string]string{
+			"region": "eu-west-1", "cluster": "cluster1", "service": "service1", "container": "app", "image": "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app:v1",
+			"repository": "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", "tag": "v1", "digest": "sha256:aaa",
+			"cluster_arn": "c1", "service_arn": "s1",
+		}},
+		"ecs_service_image_info/service1/proxy": metricResult{1, map[string]string{
+			"region": "eu-west-1", "cluster": "cluster1", "service": "service1", "container": "proxy", "image": "nginx:1.13",
+			"repository": "nginx", "tag": "1.13", "digest": "",
+			"cluster_arn": "c1", "service_arn": "s1",
+		}},
+		"ecs_service_image_info/service2/app": metricResult{1, map[string]string{
+			"region": "eu-west-1", "cluster": "cluster1", "service": "service2", "container": "app", "image": "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app@sha256:bbb",
+			"repository": "111111111111.dkr.ecr.eu-west-1.amazonaws.com/app", "tag": "", "digest": "sha256:bbb",
+			"cluster_arn": "c1", "service_arn": "s2",
+		}},
+		"ecs_service_image_age_seconds/service1/app": metricResult{3600, map[string]string{
+			"region": "eu-west-1", "cluster": "cluster1", "service": "service1", "container": "app",
+		}},
+		"ecs_service_image_age_seconds/service2/app": metricResult{86400, map[string]string{
+			"region": "eu-west-1", "cluster": "cluster1", "service": "service2", "container": "app",
+		}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Metrics are wrong, want: %v; got: %v", expected, got)
+	}
+}
+
+func TestCollectClusterImagesMetricsTimeout(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Test shouldn't panic, it did: %v", r)
+		}
+	}()
+
+	exp := newImagesCollector(Config{Region: "eu-west-1"}).(*imagesCollector)
+	ch := make(chan prometheus.Metric)
+	close(ch)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1", TaskDefinition: "td1"}}
+	testIs := []*types.ContainerImage{&types.ContainerImage{TaskDefinition: "td1", Container: "app", Image: "nginx", Repository: "nginx", Tag: "latest"}}
+
+	// Cancel the context to mock as a finished main function
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exp.collectClusterImagesMetrics(ctx, ch, testC, testSs, testIs, time.Now())
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/types"
+)
+
+// Inventory is a snapshot of the clusters of a region with their services and container instances
+type Inventory struct {
+	Region   string              `json:"region"`
+	Clusters []*ClusterInventory `json:"clusters"`
+}
+
+// ClusterInventory is a snapshot of a cluster with its services and container instances
+type ClusterInventory struct {
+	Cluster            *types.ECSCluster             `json:"cluster"`
+	Services           []*types.ECSService           `json:"services"`
+	ContainerInstances []*types.ECSContainerInstance `json:"containerInstances"`
+}
+
+// GetInventory gathers the clusters of the configuration region that pass the cluster filter, with their services
+// that pass the service filter and their container instances. The rest of the configuration is ignored
+func GetInventory(cfg Config) (*Inventory, error) {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.Base()
+	}
+	logger = logger.With("region", cfg.Region)
+
+	c, cFilter, err := newFilteredClient(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return gatherInventory(cfg.Region, c, cFilter.match)
+}
+
+// gatherInventory gathers the inventory of the valid clusters, the clusters, services and container instances are sorted
+func gatherInventory(region string, client ECSGatherer, valid func(cluster *types.ECSCluster) bool) (*Inventory, error) {
+	cs, err := client.GetClusters()
+	if err != nil {
+		return nil, fmt.Errorf("error getting the clusters: %v", err)
+	}
+
+	inv := &Inventory{
+		Region:   region,
+		Clusters: []*ClusterInventory{},
+	}
+	for _, c := range cs {
+		if !valid(c) {
+			continue
+		}
+
+		ss, err := client.GetClusterServices(c)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the services of cluster %s: %v", c.Name, err)
+		}
+		cis, err := client.GetClusterContainerInstances(c)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the container instances of cluster %s: %v", c.Name, err)
+		}
+
+		ci := &ClusterInventory{
+			Cluster:            c,
+			Services:           append([]*types.ECSService{}, ss...),
+			ContainerInstances: append([]*types.ECSContainerInstance{}, cis...),
+		}
+		sort.Slice(ci.Services, func(i, j int) bool { return ci.Services[i].Name < ci.Services[j].Name })
+		sort.Slice(ci.ContainerInstances, func(i, j int) bool { return ci.ContainerInstances[i].ID < ci.ContainerInstances[j].ID })
+		inv.Clusters = append(inv.Clusters, ci)
+	}
+	sort.Slice(inv.Clusters, func(i, j int) bool { return inv.Clusters[i].Cluster.Name < inv.Clusters[j].Cluster.Name })
+
+	return inv, nil
+}
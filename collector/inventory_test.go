@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+// inventoryTestClient is an ECSGatherer with fixed clusters, services and container instances
+type inventoryTestClient struct {
+	ECSGatherer
+	clusters     []*types.ECSCluster
+	services     map[string][]*types.ECSService
+	instances    map[string][]*types.ECSContainerInstance
+	instancesErr error
+}
+
+func (c *inventoryTestClient) GetClusters() ([]*types.ECSCluster, error) {
+	return c.clusters, nil
+}
+
+func (c *inventoryTestClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSService, error) {
+	return c.services[cluster.ID], nil
+}
+
+func (c *inventoryTestClient) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*types.ECSContainerInstance, error) {
+	return c.instances[cluster.ID], c.instancesErr
+}
+
+func TestGatherInventory(t *testing.T) {
+	tests := []struct {
+		instancesErr     error
+		expectedClusters []string
+		expectedServices []string
+		expectedErr      bool
+	}{
+		{nil, []string{"cluster1", "cluster3"}, []string{"service1", "service2"}, false},
+		{errors.New("wanted"), nil, nil, true},
+	}
+
+	for _, test := range tests {
+		c := &inventoryTestClient{
+			clusters: []*types.ECSCluster{
+				&types.ECSCluster{ID: "arn:c3", Name: "cluster3"},
+				&types.ECSCluster{ID: "arn:c2", Name: "cluster2"},
+				&types.ECSCluster{ID: "arn:c1", Name: "cluster1"},
+			},
+			services: map[string][]*types.ECSService{
+				"arn:c1": []*types.ECSService{
+					&types.ECSService{ID: "arn:s2", Name: "service2"},
+					&types.ECSService{ID: "arn:s1", Name: "service1"},
+				},
+			},
+			instances: map[string][]*types.ECSContainerInstance{
+				"arn:c1": []*types.ECSContainerInstance{
+					&types.ECSContainerInstance{ID: "arn:ci1", InstanceID: "i-1", Active: true},
+				},
+			},
+			instancesErr: test.instancesErr,
+		}
+
+		inv, err := gatherInventory("eu-west-1", c, func(cluster *types.ECSCluster) bool { return cluster.Name != "cluster2" })
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("\n- %v\n- Gathering the inventory should fail, it didn't", test)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("\n- %v\n- Gathering the inventory shouldn't fail: %v", test, err)
+		}
+
+		if inv.Region != "eu-west-1" {
+			t.Errorf("\n- %v\n- Region is wrong, want: %s; got: %s", test, "eu-west-1", inv.Region)
+		}
+		if len(inv.Clusters) != len(test.expectedClusters) {
+			t.Fatalf("\n- %v\n- Clusters are wrong, want: %d; got: %d", test, len(test.expectedClusters), len(inv.Clusters))
+		}
+		for i, name := range test.expectedClusters {
+			if got := inv.Clusters[i].Cluster.Name; got != name {
+				t.Errorf("\n- %v\n- Cluster is wrong, want: %s; got: %s", test, name, got)
+			}
+		}
+
+		c1 := inv.Clusters[0]
+		if len(c1.Services) != len(test.expectedServices) {
+			t.Fatalf("\n- %v\n- Services are wrong, want: %d; got: %d", test, len(test.expectedServices), len(c1.Services))
+		}
+		for i, name := range test.expectedServices {
+			if got := c1.Services[i].Name; got != name {
+				t.Errorf("\n- %v\n- Service is wrong, want: %s; got: %s", test, name, got)
+			}
+		}
+		if len(c1.ContainerInstances) != 1 {
+			t.Errorf("\n- %v\n- Container instances are wrong, want: %d; got: %d", test, 1, len(c1.ContainerInstances))
+		}
+		if c3 := inv.Clusters[1]; c3.Services == nil || c3.ContainerInstances == nil {
+			t.Errorf("\n- %v\n- Empty clusters should have empty services and container instances, got: %v, %v", test, c3.Services, c3.ContainerInstances)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/openmetrics"
+)
+
+// DefaultNamespace is the namespace of the exporter metrics when the configuration doesn't set one
+const DefaultNamespace = "ecs"
+
+// arnLabelNames are the ARN labels of the resource labels, added after the variable labels
+// when the ARN labels are enabled
+var arnLabelNames = map[string]string{
+	"cluster":  "cluster_arn",
+	"service":  "service_arn",
+	"instance": "container_instance_arn",
+}
+
+// descBuilder creates the metric descriptors of an exporter with its namespace and constant labels
+type descBuilder struct {
+	namespace   string
+	constLabels prometheus.Labels
+	arnLabels   bool                    // Add the ARN labels of the resource labels
+	types       openmetrics.FamilyTypes // The OpenMetrics types of the exporter info and state set families
+}
+
+// newDescBuilder returns the descriptor builder of the configuration
+func newDescBuilder(cfg Config) descBuilder {
+	ns := cfg.Namespace
+	if ns == "" {
+		ns = DefaultNamespace
+	}
+	types := cfg.familyTypes
+	if types == nil {
+		types = openmetrics.FamilyTypes{}
+	}
+	return descBuilder{
+		namespace:   ns,
+		constLabels: prometheus.Labels(cfg.ConstLabels),
+		arnLabels:   cfg.ARNLabels,
+		types:       types,
+	}
+}
+
+// desc returns a descriptor of a metric of the exporter namespace
+func (b descBuilder) desc(subsystem, name, help string, variableLabels ...string) *prometheus.Desc {
+	if b.arnLabels {
+		labels := make([]string, len(variableLabels))
+		copy(labels, variableLabels)
+		for _, l := range variableLabels {
+			if arn, ok := arnLabelNames[l]; ok {
+				labels = append(labels, arn)
+			}
+		}
+		variableLabels = labels
+	}
+
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(b.namespace, subsystem, name),
+		help,
+		variableLabels, b.constLabels,
+	)
+}
+
+// infoDesc returns the descriptor of an info metric of a resource, it always has the ARN labels and
+// its family is typed as an OpenMetrics info family
+func (b descBuilder) infoDesc(name, help string, variableLabels ...string) *prometheus.Desc {
+	b.arnLabels = true
+	b.types.SetInfo(prometheus.BuildFQName(b.namespace, "", name+"_info"))
+	return b.desc("", name+"_info", help, variableLabels...)
+}
+
+// stateSetDesc returns the descriptor of a state set metric typed as an OpenMetrics state set family, as
+// the OpenMetrics state sets it has a label named as the metric with the state, the state label value goes
+// after the variable labels values
+func (b descBuilder) stateSetDesc(subsystem, name, help string, variableLabels ...string) *prometheus.Desc {
+	fqName := prometheus.BuildFQName(b.namespace, subsystem, name)
+	b.types.SetStateSet(fqName)
+	labels := append(append([]string{}, variableLabels...), fqName)
+	return b.desc(subsystem, name, help, labels...)
+}
+
+// values returns the label values of a metric, the ARNs of the resource labels (in the
+// same order) are added when the ARN labels are enabled
+func (b descBuilder) values(values []string, arns ...string) []string {
+	if b.arnLabels {
+		values = append(values, arns...)
+	}
+	return values
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	// readyCheckInterval is the maximum age of the last AWS call result used to know
+	// if the exporter is ready, older results will check the AWS API again
+	readyCheckInterval = 30 * time.Second
+)
+
+// credentialsErrorCodes are the AWS error codes that mean the exporter credentials are not valid
+var credentialsErrorCodes = map[string]bool{
+	"NoCredentialProviders":       true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"InvalidClientTokenId":        true,
+	"UnrecognizedClientException": true,
+	"AccessDeniedException":       true,
+	"AuthFailure":                 true,
+	"SignatureDoesNotMatch":       true,
+	"InvalidSignatureException":   true,
+}
+
+// readiness tracks if the exporter is able to gather data from AWS
+type readiness struct {
+	sync.Mutex
+	succeeded bool      // There has been a successful AWS call
+	err       error     // The reason the exporter is not ready
+	checkedAt time.Time // The time of the last AWS call result
+}
+
+// isCredentialsError returns true if the error is caused by invalid credentials
+func isCredentialsError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return credentialsErrorCodes[aerr.Code()]
+	}
+	return false
+}
+
+// record updates the readiness state with the result of an AWS call, once there has been a
+// successful call only the credential errors will make the exporter not ready
+func (r *readiness) record(err error, at time.Time) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.checkedAt = at
+	switch {
+	case err == nil:
+		r.succeeded = true
+		r.err = nil
+	case !r.succeeded:
+		r.err = fmt.Errorf("no successful AWS call yet: %v", err)
+	case isCredentialsError(err):
+		r.succeeded = false
+		r.err = fmt.Errorf("invalid AWS credentials: %v", err)
+	}
+}
+
+// Ready returns nil if the exporter has had a successful AWS call and the credentials are still valid.
+// If there hasn't been any AWS call recently the AWS API will be checked
+func (e *Exporter) Ready() error {
+	e.ready.Lock()
+	checkedAt := e.ready.checkedAt
+	e.ready.Unlock()
+
+	if time.Since(checkedAt) > readyCheckInterval {
+		_, err := e.client.GetClusters()
+		e.ready.record(err, time.Now())
+	}
+
+	e.ready.Lock()
+	defer e.ready.Unlock()
+	if !e.ready.succeeded {
+		if e.ready.err == nil {
+			return fmt.Errorf("no successful AWS call yet")
+		}
+		return e.ready.err
+	}
+	return nil
+}
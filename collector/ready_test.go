@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+// readyTestClient is an ECSGatherer that only gets clusters
+type readyTestClient struct {
+	ECSGatherer
+	calls int
+	err   error
+}
+
+func (c *readyTestClient) GetClusters() ([]*types.ECSCluster, error) {
+	c.calls++
+	return nil, c.err
+}
+
+func TestReadinessRecord(t *testing.T) {
+	credsErr := awserr.New("ExpiredTokenException", "wanted", nil)
+	otherErr := awserr.New("ThrottlingException", "wanted", nil)
+	tests := []struct {
+		results       []error
+		expectedReady bool
+	}{
+		{[]error{}, false},
+		{[]error{nil}, true},
+		{[]error{otherErr}, false},
+		{[]error{credsErr}, false},
+		{[]error{otherErr, nil}, true},
+		{[]error{nil, otherErr}, true},
+		{[]error{nil, errors.New("wanted")}, true},
+		{[]error{nil, credsErr}, false},
+		{[]error{nil, credsErr, otherErr}, false},
+		{[]error{nil, credsErr, nil}, true},
+	}
+
+	for _, test := range tests {
+		r := &readiness{}
+		for _, err := range test.results {
+			r.record(err, time.Now())
+		}
+		if r.succeeded != test.expectedReady {
+			t.Errorf("\n- %v\n- Readiness is wrong, want: %t; got: %t", test, test.expectedReady, r.succeeded)
+		}
+		if !r.succeeded && len(test.results) > 0 && r.err == nil {
+			t.Errorf("\n- %v\n- Not ready state should have the reason, it didn't", test)
+		}
+	}
+}
+
+func TestExporterReady(t *testing.T) {
+	tests := []struct {
+		checkedAt     time.Time
+		succeeded     bool
+		clientErr     error
+		expectedCalls int
+		expectedReady bool
+	}{
+		{time.Time{}, false, nil, 1, true},
+		{time.Time{}, false, errors.New("wanted"), 1, false},
+		{time.Now(), true, errors.New("wanted"), 0, true},
+		{time.Now(), false, nil, 0, false},
+		{time.Now().Add(-time.Minute), true, awserr.New("InvalidClientTokenId", "wanted", nil), 1, false},
+	}
+
+	for _, test := range tests {
+		c := &readyTestClient{err: test.clientErr}
+		e := &Exporter{
+			client: c,
+			ready:  &readiness{checkedAt: test.checkedAt, succeeded: test.succeeded},
+		}
+
+		err := e.Ready()
+		if (err == nil) != test.expectedReady {
+			t.Errorf("\n- %v\n- Readiness is wrong, want: %t; got: %v", test, test.expectedReady, err)
+		}
+		if c.calls != test.expectedCalls {
+			t.Errorf("\n- %v\n- AWS calls are wrong, want: %d; got: %d", test, test.expectedCalls, c.calls)
+		}
+	}
+}
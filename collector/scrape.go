@@ -0,0 +1,279 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/types"
+)
+
+// scrapeResult is the result of gathering a piece of data from ECS
+type scrapeResult struct {
+	once       sync.Once
+	resource   string        // The name of the gathered resource
+	clusterID  string        // The cluster of the data, empty if is not cluster data
+	value      interface{}   // The data, if there was an error it has the stale data (if any)
+	gatheredAt time.Time     // When was the data gathered
+	duration   time.Duration // The time spent gathering the data
+	stale      bool          // The data was not gathered on this scrape
+	err        error         // The error gathering the data
+}
+
+// scrape has the data gathered from ECS on a single collection, the data is gathered
+// only once on demand and shared by all the collectors
+type scrape struct {
+	region     string
+	client     ECSGatherer
+	cache      *dataCache
+	staleGrace time.Duration
+	logger     log.Logger
+
+	clusters           []*types.ECSCluster // All the clusters of the region
+	validClusters      []*types.ECSCluster // The clusters that passed the cluster filter
+	clustersGatheredAt time.Time           // When was the cluster list gathered
+
+	mu      sync.Mutex
+	results map[string]*scrapeResult // The gathered data by resource and cluster
+}
+
+// newScrape returns an initialized scrape
+func newScrape(region string, client ECSGatherer, cache *dataCache, staleGrace time.Duration, logger log.Logger) *scrape {
+	return &scrape{
+		region:     region,
+		client:     client,
+		cache:      cache,
+		staleGrace: staleGrace,
+		logger:     logger,
+		results:    map[string]*scrapeResult{},
+	}
+}
+
+// get returns the result of gathering a resource, the data will be gathered only the first time. On error if
+// the stale data is enabled, the result will have the last good data (if any) along with the error
+func (s *scrape) get(resource string, clusterID string, gather func() (interface{}, error)) *scrapeResult {
+	key := fmt.Sprintf("%s/%s", resource, clusterID)
+
+	s.mu.Lock()
+	r, ok := s.results[key]
+	if !ok {
+		r = &scrapeResult{resource: resource, clusterID: clusterID}
+		s.results[key] = r
+	}
+	s.mu.Unlock()
+
+	r.once.Do(func() {
+		now := time.Now()
+		v, err := gather()
+		duration := time.Since(now)
+
+		// Fallback to the last good data on error
+		var stale bool
+		switch {
+		case err == nil && s.staleGrace > 0:
+			s.cache.set(key, v, now)
+		case err != nil:
+			v = nil
+			if c, ok := s.cache.get(key, s.staleGrace, now); ok && s.staleGrace > 0 {
+				v = c.value
+				now = c.gatheredAt
+				stale = true
+			}
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		r.value = v
+		r.gatheredAt = now
+		r.duration = duration
+		r.stale = stale
+		r.err = err
+	})
+
+	return r
+}
+
+// loadClusters gets the clusters of the region and filters them with the valid func
+func (s *scrape) loadClusters(valid func(cluster *types.ECSCluster) bool) error {
+	r := s.get("clusters", "", func() (interface{}, error) {
+		return s.client.GetClusters()
+	})
+	cs, _ := r.value.([]*types.ECSCluster)
+
+	s.clusters = cs
+	s.clustersGatheredAt = r.gatheredAt
+	s.validClusters = []*types.ECSCluster{}
+	for _, c := range cs {
+		// Filter not desired clusters
+		if !valid(c) {
+			s.logger.With("cluster", c.Name).Debugf("Cluster filtered")
+			continue
+		}
+		s.validClusters = append(s.validClusters, c)
+	}
+
+	return r.err
+}
+
+// services returns the services of a cluster, on error the stale services are returned (if any) along with the error
+func (s *scrape) services(cluster *types.ECSCluster) ([]*types.ECSService, error) {
+	r := s.get("services", cluster.ID, func() (interface{}, error) {
+		return s.client.GetClusterServices(cluster)
+	})
+	ss, _ := r.value.([]*types.ECSService)
+	return ss, r.err
+}
+
+// containerInstances returns the container instances of a cluster, on error the stale container instances are
+// returned (if any) along with the error
+func (s *scrape) containerInstances(cluster *types.ECSCluster) ([]*types.ECSContainerInstance, error) {
+	r := s.get("containerinstances", cluster.ID, func() (interface{}, error) {
+		return s.client.GetClusterContainerInstances(cluster)
+	})
+	cis, _ := r.value.([]*types.ECSContainerInstance)
+	return cis, r.err
+}
+
+// instances returns the EC2 instances of the container instances of a cluster, on error the stale
+// instances are returned (if any) along with the error
+func (s *scrape) instances(cluster *types.ECSCluster, cis []*types.ECSContainerInstance) ([]*types.EC2Instance, error) {
+	r := s.get("ec2instances", cluster.ID, func() (interface{}, error) {
+		ids := make([]string, 0, len(cis))
+		for _, ci := range cis {
+			ids = append(ids, ci.InstanceID)
+		}
+		return s.client.GetInstances(ids)
+	})
+	is, _ := r.value.([]*types.EC2Instance)
+	return is, r.err
+}
+
+// autoScalingGroups returns the Auto Scaling groups of the container instances of a cluster, on error the
+// stale groups are returned (if any) along with the error
+func (s *scrape) autoScalingGroups(cluster *types.ECSCluster, cis []*types.ECSContainerInstance) ([]*types.AutoScalingGroup, error) {
+	r := s.get("autoscalinggroups", cluster.ID, func() (interface{}, error) {
+		ids := make([]string, 0, len(cis))
+		for _, ci := range cis {
+			ids = append(ids, ci.InstanceID)
+		}
+		return s.client.GetAutoScalingGroups(ids)
+	})
+	gs, _ := r.value.([]*types.AutoScalingGroup)
+	return gs, r.err
+}
+
+// taggedAutoScalingGroups returns the Auto Scaling groups of a cluster found by the tag whose value is the
+// cluster name, on error the stale groups are returned (if any) along with the error
+func (s *scrape) taggedAutoScalingGroups(cluster *types.ECSCluster, tag string) ([]*types.AutoScalingGroup, error) {
+	r := s.get("autoscalinggroups", cluster.ID, func() (interface{}, error) {
+		return s.client.GetTaggedAutoScalingGroups(tag, cluster.Name)
+	})
+	gs, _ := r.value.([]*types.AutoScalingGroup)
+	return gs, r.err
+}
+
+// scalableTargets returns the scalable targets of the services of a cluster, on error the stale targets
+// are returned (if any) along with the error
+func (s *scrape) scalableTargets(cluster *types.ECSCluster, ss []*types.ECSService) ([]*types.ScalableTarget, error) {
+	r := s.get("scalabletargets", cluster.ID, func() (interface{}, error) {
+		return s.client.GetServiceScalableTargets(cluster, ss)
+	})
+	ts, _ := r.value.([]*types.ScalableTarget)
+	return ts, r.err
+}
+
+// targetHealth returns the health of the targets of the load balancer target groups of the services of
+// a cluster, on error the stale target health is returned (if any) along with the error
+func (s *scrape) targetHealth(cluster *types.ECSCluster, ss []*types.ECSService) ([]*types.TargetHealth, error) {
+	r := s.get("targethealth", cluster.ID, func() (interface{}, error) {
+		tgs := []string{}
+		seen := map[string]bool{}
+		for _, srv := range ss {
+			for _, tg := range srv.TargetGroups {
+				if !seen[tg] {
+					seen[tg] = true
+					tgs = append(tgs, tg)
+				}
+			}
+		}
+		return s.client.GetTargetHealth(tgs)
+	})
+	ths, _ := r.value.([]*types.TargetHealth)
+	return ths, r.err
+}
+
+// cloudWatchMetrics returns the CloudWatch metrics of a cluster and its services, on error the stale metrics
+// are returned (if any) along with the error
+func (s *scrape) cloudWatchMetrics(cluster *types.ECSCluster, ss []*types.ECSService, period, delay time.Duration) ([]*types.CloudWatchMetric, error) {
+	r := s.get("cloudwatch", cluster.ID, func() (interface{}, error) {
+		return s.client.GetCloudWatchMetrics(cluster, ss, period, delay)
+	})
+	ms, _ := r.value.([]*types.CloudWatchMetric)
+	return ms, r.err
+}
+
+// images returns the container images of the task definitions of the services of a cluster, on error the
+// stale images are returned (if any) along with the error
+func (s *scrape) images(cluster *types.ECSCluster, ss []*types.ECSService) ([]*types.ContainerImage, error) {
+	r := s.get("images", cluster.ID, func() (interface{}, error) {
+		tds := []string{}
+		seen := map[string]bool{}
+		for _, srv := range ss {
+			if srv.TaskDefinition != "" && !seen[srv.TaskDefinition] {
+				seen[srv.TaskDefinition] = true
+				tds = append(tds, srv.TaskDefinition)
+			}
+		}
+		return s.client.GetTaskDefinitionImages(tds)
+	})
+	is, _ := r.value.([]*types.ContainerImage)
+	return is, r.err
+}
+
+// staleness returns the age of the oldest data of a cluster exported on this scrape, 0 if all the data
+// was gathered on this scrape, false if there isn't data of the cluster
+func (s *scrape) staleness(clusterID string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var age time.Duration
+	found := false
+	for _, r := range s.results {
+		if r.clusterID != clusterID || r.value == nil {
+			continue
+		}
+		found = true
+		if r.stale && time.Since(r.gatheredAt) > age {
+			age = time.Since(r.gatheredAt)
+		}
+	}
+	return age, found
+}
+
+// forEachCluster calls f for each valid cluster concurrently, the errors of the clusters are logged
+// and an error is returned if any of them fails
+func (s *scrape) forEachCluster(f func(cluster *types.ECSCluster) error) error {
+	errC := make(chan error, len(s.validClusters))
+	for _, c := range s.validClusters {
+		go func(c *types.ECSCluster) {
+			err := f(c)
+			if err != nil {
+				s.logger.With("cluster", c.Name).Errorf("Error collecting cluster metrics: %v", err)
+			}
+			errC <- err
+		}(c)
+	}
+
+	failed := 0
+	for range s.validClusters {
+		if err := <-errC; err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d clusters failed", failed, len(s.validClusters))
+	}
+	return nil
+}
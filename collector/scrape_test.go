@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slok/ecs-exporter/log"
+)
+
+func TestScrapeGetOnlyOnce(t *testing.T) {
+	s := newScrape("eu-west-1", nil, newDataCache(), 0, log.Base())
+
+	calls := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.get("services", "c1", func() (interface{}, error) {
+				calls++
+				return "data", nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Data should be gathered only once, want: %d; got: %d", 1, calls)
+	}
+}
+
+func TestScrapeGetStale(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		staleGrace time.Duration
+		cachedAt   time.Time
+		gatherErr  error
+		wantValue  interface{}
+		wantStale  bool
+	}{
+		{time.Minute, now.Add(-10 * time.Second), nil, "fresh", false},
+		{time.Minute, now.Add(-10 * time.Second), errors.New("wanted"), "cached", true},
+		{time.Minute, now.Add(-2 * time.Minute), errors.New("wanted"), nil, false},
+		{0, now.Add(-10 * time.Second), errors.New("wanted"), nil, false},
+	}
+
+	for _, test := range tests {
+		c := newDataCache()
+		c.set("services/c1", "cached", test.cachedAt)
+		s := newScrape("eu-west-1", nil, c, test.staleGrace, log.Base())
+
+		r := s.get("services", "c1", func() (interface{}, error) {
+			if test.gatherErr != nil {
+				return nil, test.gatherErr
+			}
+			return "fresh", nil
+		})
+
+		if r.err != test.gatherErr {
+			t.Errorf("\n- %v\n- Error is wrong, want: %v; got: %v", test, test.gatherErr, r.err)
+		}
+		if r.value != test.wantValue {
+			t.Errorf("\n- %v\n- Value is wrong, want: %v; got: %v", test, test.wantValue, r.value)
+		}
+		if r.stale != test.wantStale {
+			t.Errorf("\n- %v\n- Stale state is wrong, want: %t; got: %t", test, test.wantStale, r.stale)
+		}
+
+		age, ok := s.staleness("c1")
+		if ok != (test.wantValue != nil) {
+			t.Errorf("\n- %v\n- Staleness presence is wrong, want: %t; got: %t", test, test.wantValue != nil, ok)
+		}
+		if test.wantStale && age < 10*time.Second {
+			t.Errorf("\n- %v\n- Staleness is wrong, want: >=%s; got: %s", test, 10*time.Second, age)
+		}
+		if !test.wantStale && age != 0 {
+			t.Errorf("\n- %v\n- Staleness is wrong, want: %s; got: %s", test, time.Duration(0), age)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func init() {
+	registerCollector("servicescaling", false, newServiceScalingCollector)
+}
+
+// serviceScalingCollector collects the Application Auto Scaling bounds of the cluster services desired count
+type serviceScalingCollector struct {
+	region      string
+	maxServices int // The maximum number of services exported per cluster (0 means no limit)
+	d           descBuilder
+
+	// Metrics descriptions
+	serviceMinCapacity *prometheus.Desc
+	serviceMaxCapacity *prometheus.Desc
+	serviceAtMax       *prometheus.Desc
+}
+
+// newServiceScalingCollector returns an initialized service scaling collector
+func newServiceScalingCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	return &serviceScalingCollector{
+		region:      cfg.Region,
+		maxServices: cfg.MaxServices,
+		d:           d,
+
+		serviceMinCapacity: d.desc("service", "autoscaling_min_capacity",
+			"The minimum desired number of tasks of the service set by Application Auto Scaling",
+			"region", "cluster", "service"),
+		serviceMaxCapacity: d.desc("service", "autoscaling_max_capacity",
+			"The maximum desired number of tasks of the service set by Application Auto Scaling",
+			"region", "cluster", "service"),
+		serviceAtMax: d.desc("service", "autoscaling_at_max_capacity",
+			"Whether the desired number of tasks of the service is at the Application Auto Scaling maximum capacity",
+			"region", "cluster", "service"),
+	}
+}
+
+// Describe implements subCollector
+func (c *serviceScalingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.serviceMinCapacity
+	ch <- c.serviceMaxCapacity
+	ch <- c.serviceAtMax
+}
+
+// Update implements subCollector
+func (c *serviceScalingCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	return s.forEachCluster(func(cluster *types.ECSCluster) error {
+		// The same services as the services collector
+		ss, err := s.services(cluster)
+		ss = limitServices(ss, c.maxServices)
+		if len(ss) == 0 {
+			return err
+		}
+
+		targets, tErr := s.scalableTargets(cluster, ss)
+		if tErr == nil || targets != nil {
+			c.collectClusterServiceScalingMetrics(ctx, ch, cluster, ss, targets)
+		}
+		if err == nil {
+			err = tErr
+		}
+		return err
+	})
+}
+
+func (c *serviceScalingCollector) collectClusterServiceScalingMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, services []*types.ECSService, targets []*types.ScalableTarget) {
+	byName := map[string]*types.ECSService{}
+	for _, s := range services {
+		byName[s.Name] = s
+	}
+
+	for _, t := range targets {
+		s, ok := byName[t.ServiceName]
+		if !ok {
+			continue
+		}
+
+		var atMax float64
+		if s.DesiredT >= t.MaxCapacity {
+			atMax = 1
+		}
+
+		values := c.d.values([]string{c.region, cluster.Name, s.Name}, cluster.ID, s.ID)
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceMinCapacity, prometheus.GaugeValue, float64(t.MinCapacity), values...))
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceMaxCapacity, prometheus.GaugeValue, float64(t.MaxCapacity), values...))
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceAtMax, prometheus.GaugeValue, atMax, values...))
+	}
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestCollectClusterServiceScalingMetrics(t *testing.T) {
+	exp := newServiceScalingCollector(Config{Region: "eu-west-1"}).(*serviceScalingCollector)
+	ch := make(chan prometheus.Metric)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{
+		&types.ECSService{ID: "s1", Name: "service1", DesiredT: 4},
+		&types.ECSService{ID: "s2", Name: "service2", DesiredT: 10},
+		&types.ECSService{ID: "s3", Name: "service3", DesiredT: 2},
+	}
+	testTs := []*types.ScalableTarget{
+		&types.ScalableTarget{ResourceID: "service/cluster1/service1", ServiceName: "service1", MinCapacity: 2, MaxCapacity: 8},
+		&types.ScalableTarget{ResourceID: "service/cluster1/service2", ServiceName: "service2", MinCapacity: 1, MaxCapacity: 10},
+		&types.ScalableTarget{ResourceID: "service/cluster1/service4", ServiceName: "service4", MinCapacity: 1, MaxCapacity: 3},
+	}
+	go func() {
+		exp.collectClusterServiceScalingMetrics(context.TODO(), ch, testC, testSs, testTs)
+		close(ch)
+	}()
+
+	got := map[string]map[string]float64{}
+	for m := range ch {
+		g := readGauge(m)
+		desc := m.Desc().String()
+		name := desc[strings.Index(desc, `"`)+1 : strings.Index(desc, `",`)]
+		if got[g.labels["service"]] == nil {
+			got[g.labels["service"]] = map[string]float64{}
+		}
+		got[g.labels["service"]][name] = g.value
+		if g.labels["cluster"] != "cluster1" || g.labels["region"] != "eu-west-1" {
+			t.Errorf("Labels are wrong: %v", g.labels)
+		}
+	}
+
+	// The services without scalable target don't have metrics
+	expected := map[string]map[string]float64{
+		"service1": {
+			"ecs_service_autoscaling_min_capacity":    2,
+			"ecs_service_autoscaling_max_capacity":    8,
+			"ecs_service_autoscaling_at_max_capacity": 0,
+		},
+		"service2": {
+			"ecs_service_autoscaling_min_capacity":    1,
+			"ecs_service_autoscaling_max_capacity":    10,
+			"ecs_service_autoscaling_at_max_capacity": 1,
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Metrics are wrong, want: %v; got: %v", expected, got)
+	}
+}
+
+func TestCollectClusterServiceScalingMetricsTimeout(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Test shouldn't panic, it did: %v", r)
+		}
+	}()
+
+	exp := newServiceScalingCollector(Config{Region: "eu-west-1"}).(*serviceScalingCollector)
+	ch := make(chan prometheus.Metric)
+	close(ch)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1", DesiredT: 4}}
+	testTs := []*types.ScalableTarget{&types.ScalableTarget{ServiceName: "service1", MinCapacity: 2, MaxCapacity: 8}}
+
+	// Cancel the context to mock as a finished main function
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exp.collectClusterServiceScalingMetrics(ctx, ch, testC, testSs, testTs)
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func init() {
+	registerCollector("services", true, newServicesCollector)
+}
+
+// servicesCollector collects the metrics of the cluster services
+type servicesCollector struct {
+	region      string
+	maxServices int // The maximum number of services exported per cluster (0 means no limit)
+	d           descBuilder
+	arnInfo     bool // Export the info metrics with the ARNs
+
+	// Metrics descriptions
+	serviceCount   *prometheus.Desc
+	serviceDesired *prometheus.Desc
+	servicePending *prometheus.Desc
+	serviceRunning *prometheus.Desc
+	serviceDropped *prometheus.Desc
+	serviceInfo    *prometheus.Desc
+}
+
+// newServicesCollector returns an initialized services collector
+func newServicesCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	return &servicesCollector{
+		region:      cfg.Region,
+		maxServices: cfg.MaxServices,
+		d:           d,
+		arnInfo:     cfg.ARNInfo,
+
+		serviceCount: d.desc("", "services",
+			"The total number of services",
+			"region", "cluster"),
+		serviceDesired: d.desc("", "service_desired_tasks",
+			"The desired number of instantiations of the task definition to keep running regarding a service",
+			"region", "cluster", "service"),
+		servicePending: d.desc("", "service_pending_tasks",
+			"The number of tasks in the cluster that are in the PENDING state regarding a service",
+			"region", "cluster", "service"),
+		serviceRunning: d.desc("", "service_running_tasks",
+			"The number of tasks in the cluster that are in the RUNNING state regarding a service",
+			"region", "cluster", "service"),
+		serviceDropped: d.desc("", "service_dropped",
+			"The number of services not exported on the scrape because of the maximum number of services per cluster, a gauge because the same services are dropped on every scrape",
+			"region", "cluster"),
+		serviceInfo: d.infoDesc("service",
+			"Information of the service, always 1",
+			"region", "cluster", "service"),
+	}
+}
+
+// Describe implements subCollector
+func (c *servicesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.serviceCount
+	ch <- c.serviceDesired
+	ch <- c.servicePending
+	ch <- c.serviceRunning
+	if c.maxServices > 0 {
+		ch <- c.serviceDropped
+	}
+	if c.arnInfo {
+		ch <- c.serviceInfo
+	}
+}
+
+// Update implements subCollector
+func (c *servicesCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	return s.forEachCluster(func(cluster *types.ECSCluster) error {
+		ss, err := s.services(cluster)
+		if err == nil || ss != nil {
+			limited := limitServices(ss, c.maxServices)
+			c.collectClusterServicesMetrics(ctx, ch, cluster, len(ss), limited)
+			if c.maxServices > 0 {
+				sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceDropped, prometheus.GaugeValue, float64(len(ss)-len(limited)), c.d.values([]string{c.region, cluster.Name}, cluster.ID)...))
+			}
+		}
+		return err
+	})
+}
+
+// limitServices returns the first services by name up to the maximum number of services (0 means no limit)
+func limitServices(services []*types.ECSService, max int) []*types.ECSService {
+	if max <= 0 || len(services) <= max {
+		return services
+	}
+
+	sorted := make([]*types.ECSService, len(services))
+	copy(sorted, services)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted[:max]
+}
+
+// collectClusterServicesMetrics collects the metrics of the services, total is the number of services of the
+// cluster before the limit of services
+func (c *servicesCollector) collectClusterServicesMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, total int, services []*types.ECSService) {
+
+	// Total services
+	sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceCount, prometheus.GaugeValue, float64(total), c.d.values([]string{c.region, cluster.Name}, cluster.ID)...))
+
+	for _, s := range services {
+		values := c.d.values([]string{c.region, cluster.Name, s.Name}, cluster.ID, s.ID)
+
+		// Desired task count
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceDesired, prometheus.GaugeValue, float64(s.DesiredT), values...))
+
+		// Pending task count
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.servicePending, prometheus.GaugeValue, float64(s.PendingT), values...))
+
+		// Running task count
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceRunning, prometheus.GaugeValue, float64(s.RunningT), values...))
+
+		if c.arnInfo {
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceInfo, prometheus.GaugeValue, 1, c.region, cluster.Name, s.Name, cluster.ID, s.ID))
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestCollectClusterServiceMetrics(t *testing.T) {
+	region := "eu-west-1"
+	exp := newServicesCollector(Config{Region: region}).(*servicesCollector)
+
+	ch := make(chan prometheus.Metric)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{
+		&types.ECSService{ID: "s1", Name: "service1", DesiredT: 10, PendingT: 5, RunningT: 5},
+		&types.ECSService{ID: "s2", Name: "service2", DesiredT: 15, PendingT: 5, RunningT: 10},
+		&types.ECSService{ID: "s3", Name: "service3", DesiredT: 30, PendingT: 27, RunningT: 0},
+		&types.ECSService{ID: "s4", Name: "service4", DesiredT: 51, PendingT: 50, RunningT: 1},
+		&types.ECSService{ID: "s5", Name: "service5", DesiredT: 109, PendingT: 99, RunningT: 2},
+		&types.ECSService{ID: "s6", Name: "service6", DesiredT: 6431, PendingT: 5000, RunningT: 107},
+	}
+	// Collect mocked metrics
+	go func() {
+		exp.collectClusterServicesMetrics(context.TODO(), ch, testC, len(testSs), testSs)
+		close(ch)
+	}()
+
+	// Check 1st received metric of services as group
+	m := (<-ch).(prometheus.Metric)
+	m2 := readGauge(m)
+	want := float64(len(testSs))
+	if m2.value != want {
+		t.Errorf("expected %f ecs_services, got %f", want, m2.value)
+	}
+	expected := `Desc{fqName: "ecs_services", help: "The total number of services", constLabels: {}, variableLabels: [region cluster]}`
+	if expected != m.Desc().String() {
+		t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+	}
+
+	for _, wantS := range testSs {
+		// Check 1st received metric  per service (desired)
+		m := (<-ch).(prometheus.Metric)
+		m2 := readGauge(m)
+		want := float64(wantS.DesiredT)
+		if m2.value != want {
+			t.Errorf("expected %f service_desired_tasks, got %f", want, m2.value)
+		}
+		expected := `Desc{fqName: "ecs_service_desired_tasks", help: "The desired number of instantiations of the task definition to keep running regarding a service", constLabels: {}, variableLabels: [region cluster service]}`
+		if expected != m.Desc().String() {
+			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+		}
+
+		// Check 1st received metric  per service (pending)
+		m = (<-ch).(prometheus.Metric)
+		m2 = readGauge(m)
+		want = float64(wantS.PendingT)
+		if m2.value != want {
+			t.Errorf("expected %f service_pending_tasks, got %f", want, m2.value)
+		}
+		expected = `Desc{fqName: "ecs_service_pending_tasks", help: "The number of tasks in the cluster that are in the PENDING state regarding a service", constLabels: {}, variableLabels: [region cluster service]}`
+		if expected != m.Desc().String() {
+			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+		}
+
+		// Check 1st received metric  per service (running)
+		m = (<-ch).(prometheus.Metric)
+		m2 = readGauge(m)
+		want = float64(wantS.RunningT)
+		if m2.value != want {
+			t.Errorf("expected %f service_running_tasks, got %f", want, m2.value)
+		}
+		expected = `Desc{fqName: "ecs_service_running_tasks", help: "The number of tasks in the cluster that are in the RUNNING state regarding a service", constLabels: {}, variableLabels: [region cluster service]}`
+		if expected != m.Desc().String() {
+			t.Errorf("expected '%s', \ngot '%s'", expected, m.Desc().String())
+		}
+	}
+}
+
+func TestCollectClusterServiceMetricsTimeout(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Test shouldn't panic, it did: %v", r)
+		}
+	}()
+
+	exp := newServicesCollector(Config{Region: "eu-west-1"}).(*servicesCollector)
+	ch := make(chan prometheus.Metric)
+	close(ch)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1", DesiredT: 10, PendingT: 5, RunningT: 5}}
+
+	// Cancel the context to mock as a finished main function
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exp.collectClusterServicesMetrics(ctx, ch, testC, len(testSs), testSs)
+}
+
+func TestServicesLimit(t *testing.T) {
+	services := []*types.ECSService{
+		&types.ECSService{ID: "s3", Name: "service3"},
+		&types.ECSService{ID: "s1", Name: "service1"},
+		&types.ECSService{ID: "s2", Name: "service2"},
+	}
+	tests := []struct {
+		maxServices   int
+		expectedNames []string
+	}{
+		{0, []string{"service3", "service1", "service2"}},
+		{3, []string{"service3", "service1", "service2"}},
+		{5, []string{"service3", "service1", "service2"}},
+		{2, []string{"service1", "service2"}},
+		{1, []string{"service1"}},
+	}
+
+	for _, test := range tests {
+		got := limitServices(services, test.maxServices)
+		if len(got) != len(test.expectedNames) {
+			t.Fatalf("\n- %v\n- Services are wrong, want: %v; got: %d services", test, test.expectedNames, len(got))
+		}
+		for i, s := range got {
+			if s.Name != test.expectedNames[i] {
+				t.Errorf("\n- %v\n- Service is wrong, want: %s; got: %s", test, test.expectedNames[i], s.Name)
+			}
+		}
+	}
+}
+
+func TestServicesUpdateLimit(t *testing.T) {
+	tests := []struct {
+		maxServices      int
+		expectedServices int
+		expectedTotal    float64
+		expectedDropped  float64 // -1 when the dropped services are not exported
+	}{
+		{0, 3, 3, -1},
+		{3, 3, 3, 0},
+		{2, 2, 3, 1},
+		{1, 1, 3, 2},
+	}
+
+	for _, test := range tests {
+		c := newServicesCollector(Config{Region: "eu-west-1", MaxServices: test.maxServices}).(*servicesCollector)
+		client := &stateTestClient{
+			clusters: []*types.ECSCluster{&types.ECSCluster{ID: "c1", Name: "cluster1"}},
+			services: []*types.ECSService{
+				&types.ECSService{ID: "s3", Name: "service3"},
+				&types.ECSService{ID: "s1", Name: "service1"},
+				&types.ECSService{ID: "s2", Name: "service2"},
+			},
+		}
+
+		// The dropped services are the ones of the current scrape, they don't accumulate across scrapes
+		for i := 0; i < 3; i++ {
+			s := newScrape("eu-west-1", client, newDataCache(), 0, log.Base())
+			s.loadClusters(func(*types.ECSCluster) bool { return true })
+
+			ch := make(chan prometheus.Metric)
+			go func() {
+				if err := c.Update(context.TODO(), s, ch); err != nil {
+					t.Errorf("\n- %v\n- Update shouldn't fail: %v", test, err)
+				}
+				close(ch)
+			}()
+
+			services, total, dropped := 0, -1.0, -1.0
+			for m := range ch {
+				switch m.Desc() {
+				case c.serviceCount:
+					total = readGauge(m).value
+				case c.serviceDropped:
+					dropped = readGauge(m).value
+				case c.serviceDesired:
+					services++
+				}
+			}
+
+			if services != test.expectedServices {
+				t.Errorf("\n- %v\n- Exported services are wrong, want: %d; got: %d", test, test.expectedServices, services)
+			}
+			if total != test.expectedTotal {
+				t.Errorf("\n- %v\n- Total services are wrong, want: %v; got: %v", test, test.expectedTotal, total)
+			}
+			if dropped != test.expectedDropped {
+				t.Errorf("\n- %v\n- Dropped services are wrong, want: %v; got: %v", test, test.expectedDropped, dropped)
+			}
+		}
+	}
+}
+
+func TestCollectClusterServiceMetricsARNs(t *testing.T) {
+	tests := []struct {
+		arnLabels       bool
+		arnInfo         bool
+		expectedMetrics int
+		expectedLabels  map[string]string // The labels of the service metrics
+	}{
+		{false, false, 4, map[string]string{"region": "eu-west-1", "cluster": "cluster1", "service": "service1"}},
+		{true, false, 4, map[string]string{"region": "eu-west-1", "cluster": "cluster1", "service": "service1", "cluster_arn": "arn:c1", "service_arn": "arn:s1"}},
+		{false, true, 5, map[string]string{"region": "eu-west-1", "cluster": "cluster1", "service": "service1"}},
+		{true, true, 5, map[string]string{"region": "eu-west-1", "cluster": "cluster1", "service": "service1", "cluster_arn": "arn:c1", "service_arn": "arn:s1"}},
+	}
+
+	for _, test := range tests {
+		exp := newServicesCollector(Config{Region: "eu-west-1", ARNLabels: test.arnLabels, ARNInfo: test.arnInfo}).(*servicesCollector)
+		ch := make(chan prometheus.Metric)
+		testC := &types.ECSCluster{ID: "arn:c1", Name: "cluster1"}
+		testSs := []*types.ECSService{&types.ECSService{ID: "arn:s1", Name: "service1", DesiredT: 10, PendingT: 5, RunningT: 5}}
+		go func() {
+			exp.collectClusterServicesMetrics(context.TODO(), ch, testC, len(testSs), testSs)
+			close(ch)
+		}()
+
+		ms := []prometheus.Metric{}
+		for m := range ch {
+			ms = append(ms, m)
+		}
+		if len(ms) != test.expectedMetrics {
+			t.Errorf("\n- %v\n- Number of metrics is wrong, want: %d; got: %d", test, test.expectedMetrics, len(ms))
+			continue
+		}
+
+		// The first metric is the total, it only has the cluster labels
+		total := readGauge(ms[0]).labels
+		if _, ok := total["service_arn"]; ok {
+			t.Errorf("\n- %v\n- Total metric shouldn't have the service ARN: %v", test, total)
+		}
+		if (total["cluster_arn"] != "") != test.arnLabels {
+			t.Errorf("\n- %v\n- Total metric cluster ARN is wrong: %v", test, total)
+		}
+		for _, m := range ms[1:4] {
+			got := readGauge(m).labels
+			if !reflect.DeepEqual(got, test.expectedLabels) {
+				t.Errorf("\n- %v\n- Labels are wrong, want: %v; got: %v", test, test.expectedLabels, got)
+			}
+		}
+
+		if test.arnInfo {
+			info := readGauge(ms[4])
+			want := map[string]string{"region": "eu-west-1", "cluster": "cluster1", "service": "service1", "cluster_arn": "arn:c1", "service_arn": "arn:s1"}
+			if info.value != 1 || !reflect.DeepEqual(info.labels, want) {
+				t.Errorf("\n- %v\n- Info metric is wrong, want: %v; got: %v", test, want, info)
+			}
+			if !strings.Contains(ms[4].Desc().String(), `fqName: "ecs_service_info"`) {
+				t.Errorf("\n- %v\n- Info metric name is wrong: %s", test, ms[4].Desc())
+			}
+		}
+	}
+}
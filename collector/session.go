@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/slok/ecs-exporter/log"
+)
+
+const (
+	// DefaultSessionTTL is the time a session is cached without being used when the session cache doesn't set one
+	DefaultSessionTTL = time.Hour
+	// DefaultMaxSessions is the maximum number of cached sessions when the session cache doesn't set one
+	DefaultMaxSessions = 100
+)
+
+// regionRE matches the AWS region names, like eu-west-1, us-gov-west-1 or cn-north-1
+var regionRE = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-[0-9]+$`)
+
+// ValidRegion returns true if the region has the format of an AWS region name
+func ValidRegion(region string) bool {
+	return regionRE.MatchString(region)
+}
+
+// sessionEntry is a cached session
+type sessionEntry struct {
+	session  *session.Session
+	lastUsed time.Time
+}
+
+// SessionCache creates and caches AWS sessions by region and role so they are
+// reused between exporters, the sessions not used for the TTL are removed and
+// when the cache is full the least recently used session is replaced
+type SessionCache struct {
+	sync.Mutex
+	ttl      time.Duration
+	max      int
+	sessions map[string]*sessionEntry // The sessions by region and role
+}
+
+// NewSessionCache returns an initialized session cache, the TTL and the maximum number
+// of sessions use the defaults if they are not positive
+func NewSessionCache(ttl time.Duration, max int) *SessionCache {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	if max <= 0 {
+		max = DefaultMaxSessions
+	}
+	return &SessionCache{
+		ttl:      ttl,
+		max:      max,
+		sessions: map[string]*sessionEntry{},
+	}
+}
+
+// Get returns the session of a region, if the role ARN is not empty the session
+// will use the credentials of the assumed role
+func (c *SessionCache) Get(region string, roleARN string) (*session.Session, error) {
+	if !ValidRegion(region) {
+		return nil, fmt.Errorf("invalid region: %s", region)
+	}
+	key := fmt.Sprintf("%s/%s", region, roleARN)
+	now := time.Now()
+
+	c.Lock()
+	defer c.Unlock()
+
+	if e, ok := c.sessions[key]; ok {
+		e.lastUsed = now
+		return e.session, nil
+	}
+
+	log.Debugf("Creating AWS session for region '%s' and role '%s'", region, roleARN)
+	s := session.New(&aws.Config{Region: aws.String(region)})
+	if s == nil {
+		return nil, fmt.Errorf("error creating aws session")
+	}
+
+	if roleARN != "" {
+		s = s.Copy(&aws.Config{Credentials: stscreds.NewCredentials(s, roleARN)})
+	}
+
+	c.evict(now)
+	c.sessions[key] = &sessionEntry{session: s, lastUsed: now}
+	return s, nil
+}
+
+// Len returns the number of cached sessions
+func (c *SessionCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.sessions)
+}
+
+// evict removes the expired sessions and the least recently used one if the cache is full,
+// needs to be called with the lock acquired
+func (c *SessionCache) evict(now time.Time) {
+	oldest := ""
+	for key, e := range c.sessions {
+		if now.Sub(e.lastUsed) > c.ttl {
+			delete(c.sessions, key)
+			continue
+		}
+		if oldest == "" || e.lastUsed.Before(c.sessions[oldest].lastUsed) {
+			oldest = key
+		}
+	}
+
+	if len(c.sessions) >= c.max {
+		delete(c.sessions, oldest)
+	}
+}
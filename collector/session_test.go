@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionCacheGet(t *testing.T) {
+	c := NewSessionCache(0, 0)
+
+	s1, err := c.Get("eu-west-1", "")
+	if err != nil {
+		t.Fatalf("Getting session shouldn't error, it did: %v", err)
+	}
+
+	s2, _ := c.Get("eu-west-1", "")
+	if s1 != s2 {
+		t.Errorf("Same region and role should reuse the session, it didn't")
+	}
+
+	s3, _ := c.Get("eu-west-1", "arn:aws:iam::123456789012:role/ecs-exporter")
+	if s1 == s3 {
+		t.Errorf("Different role should use a different session, it didn't")
+	}
+
+	s4, _ := c.Get("us-east-1", "")
+	if s1 == s4 {
+		t.Errorf("Different region should use a different session, it didn't")
+	}
+
+	if got := c.Len(); got != 3 {
+		t.Errorf("Cached sessions are wrong, want: %d; got: %d", 3, got)
+	}
+}
+
+func TestSessionCacheInvalidRegion(t *testing.T) {
+	c := NewSessionCache(0, 0)
+	for _, region := range []string{"", "eu", "eu-west", "EU-WEST-1", "eu-west-1/x", "../eu-west-1", "eu-west-1.example.com"} {
+		if _, err := c.Get(region, ""); err == nil {
+			t.Errorf("\n- %s\n- Getting the session of an invalid region should error, it didn't", region)
+		}
+	}
+	if got := c.Len(); got != 0 {
+		t.Errorf("Invalid regions shouldn't be cached, got: %d sessions", got)
+	}
+}
+
+func TestValidRegion(t *testing.T) {
+	tests := []struct {
+		region   string
+		expected bool
+	}{
+		{"eu-west-1", true},
+		{"ap-southeast-2", true},
+		{"us-gov-west-1", true},
+		{"cn-north-1", true},
+		{"us-isob-east-1", true},
+		{"", false},
+		{"eu-west", false},
+		{"Eu-west-1", false},
+		{"eu-west-1a", false},
+		{"eu-west-1 ", false},
+	}
+
+	for _, test := range tests {
+		if got := ValidRegion(test.region); got != test.expected {
+			t.Errorf("\n- %v\n- Region validation is wrong, want: %t; got: %t", test, test.expected, got)
+		}
+	}
+}
+
+func TestSessionCacheEviction(t *testing.T) {
+	c := NewSessionCache(time.Minute, 2)
+
+	s1, _ := c.Get("eu-west-1", "")
+	c.Get("us-east-1", "")
+
+	// The least recently used session is replaced when the cache is full
+	c.Get("eu-west-1", "")
+	c.sessions["us-east-1/"].lastUsed = time.Now().Add(-30 * time.Second)
+	c.sessions["eu-west-1/"].lastUsed = time.Now()
+	c.Get("eu-central-1", "")
+	if _, ok := c.sessions["us-east-1/"]; ok {
+		t.Errorf("Least recently used session should be evicted, it wasn't")
+	}
+	if s, _ := c.Get("eu-west-1", ""); s != s1 {
+		t.Errorf("Recently used session shouldn't be evicted, it was")
+	}
+	if got := c.Len(); got != 2 {
+		t.Errorf("Cached sessions are wrong, want: %d; got: %d", 2, got)
+	}
+
+	// The expired sessions are removed
+	c.sessions["eu-west-1/"].lastUsed = time.Now().Add(-2 * time.Minute)
+	c.sessions["eu-central-1/"].lastUsed = time.Now().Add(-2 * time.Minute)
+	c.Get("us-west-2", "")
+	if got := c.Len(); got != 1 {
+		t.Errorf("Expired sessions should be removed, want: %d sessions; got: %d", 1, got)
+	}
+}
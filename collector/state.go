@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"sort"
+	"time"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+// cluster filter decisions
+const (
+	clusterMatched  = "matched"
+	clusterFiltered = "filtered"
+)
+
+// State is the data gathered from AWS on the last scrape of an exporter
+type State struct {
+	Region          string                    `json:"region"`
+	StartedAt       time.Time                 `json:"startedAt"`
+	DurationSeconds float64                   `json:"durationSeconds"`
+	Resources       map[string]*ResourceState `json:"resources"` // The data that is not from a cluster by resource
+	Clusters        []*ClusterState           `json:"clusters"`
+}
+
+// ClusterState is the data gathered from a cluster on the last scrape
+type ClusterState struct {
+	Cluster   *types.ECSCluster         `json:"cluster"`
+	Filter    string                    `json:"filter"`    // The cluster filter decision, matched or filtered
+	Resources map[string]*ResourceState `json:"resources"` // The cluster data by resource
+}
+
+// ResourceState is the result of gathering a resource on the last scrape
+type ResourceState struct {
+	Data            interface{} `json:"data"`
+	GatheredAt      time.Time   `json:"gatheredAt"`
+	DurationSeconds float64     `json:"durationSeconds"`
+	Stale           bool        `json:"stale"`
+	Error           string      `json:"error,omitempty"`
+}
+
+// state returns the state of the scrape
+func (s *scrape) state(startedAt time.Time) *State {
+	valid := map[string]bool{}
+	for _, c := range s.validClusters {
+		valid[c.ID] = true
+	}
+
+	st := &State{
+		Region:          s.region,
+		StartedAt:       startedAt,
+		DurationSeconds: time.Since(startedAt).Seconds(),
+		Resources:       map[string]*ResourceState{},
+		Clusters:        []*ClusterState{},
+	}
+	clusters := map[string]*ClusterState{}
+	for _, c := range s.clusters {
+		cs := &ClusterState{
+			Cluster:   c,
+			Filter:    clusterFiltered,
+			Resources: map[string]*ResourceState{},
+		}
+		if valid[c.ID] {
+			cs.Filter = clusterMatched
+		}
+		clusters[c.ID] = cs
+		st.Clusters = append(st.Clusters, cs)
+	}
+	sort.Slice(st.Clusters, func(i, j int) bool { return st.Clusters[i].Cluster.Name < st.Clusters[j].Cluster.Name })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.results {
+		rs := &ResourceState{
+			Data:            r.value,
+			GatheredAt:      r.gatheredAt,
+			DurationSeconds: r.duration.Seconds(),
+			Stale:           r.stale,
+		}
+		if r.err != nil {
+			rs.Error = r.err.Error()
+		}
+
+		if r.clusterID == "" {
+			st.Resources[r.resource] = rs
+			continue
+		}
+		if cs, ok := clusters[r.clusterID]; ok {
+			cs.Resources[r.resource] = rs
+		}
+	}
+
+	return st
+}
+
+// State returns the data gathered from AWS on the last scrape, nil if there wasn't any scrape
+func (e *Exporter) State() *State {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	return e.lastState
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/types"
+)
+
+// stateTestClient is an ECSGatherer with fixed clusters and services
+type stateTestClient struct {
+	ECSGatherer
+	clusters    []*types.ECSCluster
+	services    []*types.ECSService
+	servicesErr error
+}
+
+func (c *stateTestClient) GetClusters() ([]*types.ECSCluster, error) {
+	return c.clusters, nil
+}
+
+func (c *stateTestClient) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSService, error) {
+	return c.services, c.servicesErr
+}
+
+func TestScrapeState(t *testing.T) {
+	tests := []struct {
+		servicesErr      error
+		expectedServices int
+		expectedErr      string
+	}{
+		{nil, 1, ""},
+		{errors.New("wanted"), 0, "wanted"},
+	}
+
+	for _, test := range tests {
+		c := &stateTestClient{
+			clusters: []*types.ECSCluster{
+				&types.ECSCluster{ID: "arn:c2", Name: "cluster2"},
+				&types.ECSCluster{ID: "arn:c1", Name: "cluster1"},
+			},
+			services:    []*types.ECSService{&types.ECSService{ID: "arn:s1", Name: "service1"}},
+			servicesErr: test.servicesErr,
+		}
+		s := newScrape("eu-west-1", c, newDataCache(), 0, log.Base())
+		s.loadClusters(func(cluster *types.ECSCluster) bool { return cluster.Name == "cluster1" })
+		s.services(s.validClusters[0])
+
+		st := s.state(time.Now())
+		if st.Region != "eu-west-1" {
+			t.Errorf("\n- %v\n- Region is wrong, want: %s; got: %s", test, "eu-west-1", st.Region)
+		}
+		if _, ok := st.Resources["clusters"]; !ok {
+			t.Errorf("\n- %v\n- Cluster list should be present, it wasn't", test)
+		}
+		if len(st.Clusters) != 2 {
+			t.Fatalf("\n- %v\n- Clusters are wrong, want: %d; got: %d", test, 2, len(st.Clusters))
+		}
+
+		c1, c2 := st.Clusters[0], st.Clusters[1]
+		if c1.Cluster.Name != "cluster1" || c1.Filter != clusterMatched || c2.Filter != clusterFiltered {
+			t.Errorf("\n- %v\n- Cluster filter decisions are wrong, got: %s=%s, %s=%s", test, c1.Cluster.Name, c1.Filter, c2.Cluster.Name, c2.Filter)
+		}
+		if len(c2.Resources) != 0 {
+			t.Errorf("\n- %v\n- Filtered clusters shouldn't have data, got: %v", test, c2.Resources)
+		}
+
+		rs, ok := c1.Resources["services"]
+		if !ok {
+			t.Fatalf("\n- %v\n- Services should be present, they weren't", test)
+		}
+		ss, _ := rs.Data.([]*types.ECSService)
+		if len(ss) != test.expectedServices {
+			t.Errorf("\n- %v\n- Services are wrong, want: %d; got: %d", test, test.expectedServices, len(ss))
+		}
+		if rs.Error != test.expectedErr {
+			t.Errorf("\n- %v\n- Error is wrong, want: %s; got: %s", test, test.expectedErr, rs.Error)
+		}
+	}
+}
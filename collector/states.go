@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+var (
+	// serviceStatuses are the exported service states, all of them are exported for every service
+	serviceStatuses = []string{
+		types.ServiceStatusActive,
+		types.ServiceStatusDraining,
+		types.ServiceStatusInactive,
+	}
+	// deploymentStatuses are the exported deployment states, all of them are exported for every deployment
+	deploymentStatuses = []string{
+		types.DeploymentStatusPrimary,
+		types.DeploymentStatusActive,
+		types.DeploymentStatusInactive,
+	}
+	// containerInstanceStatuses are the exported container instance states, all of them are exported for
+	// every container instance
+	containerInstanceStatuses = []string{
+		types.ContainerInstanceStatusActive,
+		types.ContainerInstanceStatusDraining,
+		types.ContainerInstanceStatusInactive,
+	}
+)
+
+func init() {
+	registerCollector("states", false, newStatesCollector)
+}
+
+// statesCollector collects the status of the services, deployments and container instances as state sets
+// and the creation time of the services and deployments. The creation times are gauges and not OpenMetrics
+// _created samples, they are only allowed on counters, histograms and summaries
+type statesCollector struct {
+	region             string
+	maxServices        int  // The maximum number of services exported per cluster (0 means no limit)
+	containerInstances bool // Collect the container instance states, only when the containerinstances collector is enabled
+	d                  descBuilder
+
+	// Metrics descriptions
+	serviceStatus            *prometheus.Desc
+	serviceCreated           *prometheus.Desc
+	serviceDeploymentStatus  *prometheus.Desc
+	serviceDeploymentCreated *prometheus.Desc
+	containerInstanceStatus  *prometheus.Desc
+}
+
+// newStatesCollector returns an initialized states collector
+func newStatesCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	return &statesCollector{
+		region:             cfg.Region,
+		maxServices:        cfg.MaxServices,
+		containerInstances: cfg.collectorEnabled("containerinstances"),
+		d:                  d,
+
+		serviceStatus: d.stateSetDesc("service", "status",
+			"The status of the service, 1 for the current status",
+			"region", "cluster", "service"),
+		serviceCreated: d.desc("service", "created_timestamp_seconds",
+			"The creation time of the service since unix epoch in seconds",
+			"region", "cluster", "service"),
+		serviceDeploymentStatus: d.stateSetDesc("service", "deployment_status",
+			"The status of the deployment of the service, 1 for the current status",
+			"region", "cluster", "service", "deployment"),
+		serviceDeploymentCreated: d.desc("service", "deployment_created_timestamp_seconds",
+			"The creation time of the deployment of the service since unix epoch in seconds",
+			"region", "cluster", "service", "deployment"),
+		containerInstanceStatus: d.stateSetDesc("container_instance", "status",
+			"The status of the container instance, 1 for the current status",
+			"region", "cluster", "instance"),
+	}
+}
+
+// Describe implements subCollector
+func (c *statesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.serviceStatus
+	ch <- c.serviceCreated
+	ch <- c.serviceDeploymentStatus
+	ch <- c.serviceDeploymentCreated
+	if c.containerInstances {
+		ch <- c.containerInstanceStatus
+	}
+}
+
+// Update implements subCollector
+func (c *statesCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	return s.forEachCluster(func(cluster *types.ECSCluster) error {
+		// The same services as the services collector
+		ss, err := s.services(cluster)
+		if err == nil || ss != nil {
+			c.collectClusterServiceStatesMetrics(ctx, ch, cluster, limitServices(ss, c.maxServices))
+		}
+
+		// The container instances are not gathered when the containerinstances collector is disabled
+		if !c.containerInstances {
+			return err
+		}
+		cis, ciErr := s.containerInstances(cluster)
+		if ciErr == nil || cis != nil {
+			c.collectClusterContainerInstanceStatesMetrics(ctx, ch, cluster, cis)
+		}
+		if err == nil {
+			err = ciErr
+		}
+		return err
+	})
+}
+
+func (c *statesCollector) collectClusterServiceStatesMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, services []*types.ECSService) {
+	for _, s := range services {
+		c.sendStateSet(ctx, ch, c.serviceStatus, serviceStatuses, s.Status, []string{c.region, cluster.Name, s.Name}, cluster.ID, s.ID)
+		if !s.CreatedAt.IsZero() {
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceCreated, prometheus.GaugeValue, float64(s.CreatedAt.Unix()), c.d.values([]string{c.region, cluster.Name, s.Name}, cluster.ID, s.ID)...))
+		}
+
+		for _, d := range s.Deployments {
+			c.sendStateSet(ctx, ch, c.serviceDeploymentStatus, deploymentStatuses, d.Status, []string{c.region, cluster.Name, s.Name, d.ID}, cluster.ID, s.ID)
+			if !d.CreatedAt.IsZero() {
+				sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceDeploymentCreated, prometheus.GaugeValue, float64(d.CreatedAt.Unix()), c.d.values([]string{c.region, cluster.Name, s.Name, d.ID}, cluster.ID, s.ID)...))
+			}
+		}
+	}
+}
+
+func (c *statesCollector) collectClusterContainerInstanceStatesMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, cInstances []*types.ECSContainerInstance) {
+	for _, ci := range cInstances {
+		c.sendStateSet(ctx, ch, c.containerInstanceStatus, containerInstanceStatuses, ci.Status, []string{c.region, cluster.Name, ci.InstanceID}, cluster.ID, ci.ID)
+	}
+}
+
+// sendStateSet sends a metric for every state with 1 for the current state and 0 for the rest, if the current
+// state is not one of the states it's sent too
+func (c *statesCollector) sendStateSet(ctx context.Context, ch chan<- prometheus.Metric, desc *prometheus.Desc, states []string, current string, values []string, arns ...string) {
+	known := false
+	for _, state := range states {
+		var v float64
+		if state == current {
+			v = 1
+			known = true
+		}
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, c.d.values(append(values, state), arns...)...))
+	}
+	if !known && current != "" {
+		sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, c.d.values(append(values, current), arns...)...))
+	}
+}
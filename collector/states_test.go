@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/slok/ecs-exporter/log"
+	"github.com/slok/ecs-exporter/openmetrics"
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestCollectClusterStatesMetrics(t *testing.T) {
+	exp := newStatesCollector(Config{Region: "eu-west-1"}).(*statesCollector)
+	ch := make(chan prometheus.Metric)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{
+		&types.ECSService{ID: "s1", Name: "service1", Status: types.ServiceStatusActive, CreatedAt: time.Unix(1500000000, 0),
+			Deployments: []*types.ECSDeployment{
+				&types.ECSDeployment{ID: "d2", Status: types.DeploymentStatusPrimary, CreatedAt: time.Unix(1500000200, 0)},
+				&types.ECSDeployment{ID: "d1", Status: types.DeploymentStatusActive, CreatedAt: time.Unix(1500000100, 0)},
+			},
+		},
+		&types.ECSService{ID: "s2", Name: "service2", Status: "UNKNOWN"},
+	}
+	testCis := []*types.ECSContainerInstance{
+		&types.ECSContainerInstance{ID: "ci1", InstanceID: "i-1", Status: types.ContainerInstanceStatusDraining},
+	}
+	go func() {
+		exp.collectClusterServiceStatesMetrics(context.TODO(), ch, testC, testSs)
+		exp.collectClusterContainerInstanceStatesMetrics(context.TODO(), ch, testC, testCis)
+		close(ch)
+	}()
+
+	got := map[string]float64{}
+	for m := range ch {
+		g := readGauge(m)
+		desc := m.Desc().String()
+		name := desc[strings.Index(desc, `"`)+1 : strings.Index(desc, `",`)]
+		key := name + "/" + g.labels["service"] + g.labels["instance"] + "/" + g.labels["deployment"] + "/" + g.labels[name]
+		got[key] = g.value
+	}
+
+	// The services without creation time don't have it and the unknown states are exported
+	expected := map[string]float64{
+		"ecs_service_status/service1//ACTIVE":                           1,
+		"ecs_service_status/service1//DRAINING":                         0,
+		"ecs_service_status/service1//INACTIVE":                         0,
+		"ecs_service_created_timestamp_seconds/service1//":              1500000000,
+		"ecs_service_deployment_status/service1/d2/PRIMARY":             1,
+		"ecs_service_deployment_status/service1/d2/ACTIVE":              0,
+		"ecs_service_deployment_status/service1/d2/INACTIVE":            0,
+		"ecs_service_deployment_created_timestamp_seconds/service1/d2/": 1500000200,
+		"ecs_service_deployment_status/service1/d1/PRIMARY":             0,
+		"ecs_service_deployment_status/service1/d1/ACTIVE":              1,
+		"ecs_service_deployment_status/service1/d1/INACTIVE":            0,
+		"ecs_service_deployment_created_timestamp_seconds/service1/d1/": 1500000100,
+		"ecs_service_status/service2//ACTIVE":                           0,
+		"ecs_service_status/service2//DRAINING":                         0,
+		"ecs_service_status/service2//INACTIVE":                         0,
+		"ecs_service_status/service2//UNKNOWN":                          1,
+		"ecs_container_instance_status/i-1//ACTIVE":                     0,
+		"ecs_container_instance_status/i-1//DRAINING":                   1,
+		"ecs_container_instance_status/i-1//INACTIVE":                   0,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Metrics are wrong, want: %v; got: %v", expected, got)
+	}
+}
+
+func TestStateSetDescLabels(t *testing.T) {
+	tests := []struct {
+		cfg           Config
+		expectedLabel string
+	}{
+		{Config{}, "ecs_service_status"},
+		{Config{Namespace: "aws_ecs", ARNLabels: true}, "aws_ecs_service_status"},
+	}
+
+	for _, test := range tests {
+		exp := newStatesCollector(test.cfg).(*statesCollector)
+		desc := exp.serviceStatus.String()
+		// The state label goes after the variable labels and before the ARN labels
+		if !strings.Contains(desc, "[region cluster service "+test.expectedLabel) {
+			t.Errorf("\n- %v\n- The state set should have the %s label, it didn't: %s", test, test.expectedLabel, desc)
+		}
+	}
+}
+
+func TestOpenMetricsFamilyTypes(t *testing.T) {
+	// The info and state set descriptors set their families types with the namespace of the exporter
+	exp, err := New(Config{Namespace: "aws_ecs", Collectors: map[string]bool{"states": true}, Gatherer: &statesTestGatherer{}})
+	if err != nil {
+		t.Fatalf("Creating the exporter shouldn't fail: %v", err)
+	}
+	types := exp.FamilyTypes()
+
+	tests := []struct {
+		name         string
+		expectedType string
+	}{
+		{"aws_ecs_service_status", "# TYPE aws_ecs_service_status stateset\n"},
+		{"aws_ecs_service_info", "# TYPE aws_ecs_service info\n"},
+		{"aws_ecs_service_desired_tasks", "# TYPE aws_ecs_service_desired_tasks gauge\n"},
+	}
+
+	for _, test := range tests {
+		mf := &dto.MetricFamily{Name: proto.String(test.name), Type: dto.MetricType_GAUGE.Enum(), Metric: []*dto.Metric{
+			&dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(1)}},
+		}}
+		var b bytes.Buffer
+		if err := openmetrics.Write(&b, []*dto.MetricFamily{mf}, types); err != nil {
+			t.Fatalf("\n- %v\n- Writing the metrics shouldn't fail: %v", test, err)
+		}
+		if !strings.HasPrefix(b.String(), test.expectedType) {
+			t.Errorf("\n- %v\n- Family type is wrong, want: %q; got: %q", test, test.expectedType, b.String())
+		}
+	}
+
+	// The family types are not shared between exporters
+	other, err := New(Config{Namespace: "other", Gatherer: &statesTestGatherer{}})
+	if err != nil {
+		t.Fatalf("Creating the exporter shouldn't fail: %v", err)
+	}
+	if _, ok := other.FamilyTypes()["aws_ecs_service_info"]; ok {
+		t.Errorf("Family types of other exporters shouldn't be shared, they were")
+	}
+}
+
+// statesTestGatherer is an ECSGatherer with a cluster, its services and its container instances
+type statesTestGatherer struct {
+	ECSGatherer
+	ciCalls int
+}
+
+func (c *statesTestGatherer) GetClusters() ([]*types.ECSCluster, error) {
+	return []*types.ECSCluster{&types.ECSCluster{ID: "c1", Name: "cluster1"}}, nil
+}
+
+func (c *statesTestGatherer) GetClusterServices(cluster *types.ECSCluster) ([]*types.ECSService, error) {
+	return []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1", Status: types.ServiceStatusActive}}, nil
+}
+
+func (c *statesTestGatherer) GetClusterContainerInstances(cluster *types.ECSCluster) ([]*types.ECSContainerInstance, error) {
+	c.ciCalls++
+	return []*types.ECSContainerInstance{&types.ECSContainerInstance{ID: "ci1", InstanceID: "i-1", Status: types.ContainerInstanceStatusActive}}, nil
+}
+
+func TestStatesUpdateContainerInstances(t *testing.T) {
+	tests := []struct {
+		collectors      map[string]bool
+		expectedCICalls int
+		expectedMetrics int
+	}{
+		{nil, 1, 6},
+		{map[string]bool{"containerinstances": true}, 1, 6},
+		{map[string]bool{"containerinstances": false}, 0, 3},
+	}
+
+	for _, test := range tests {
+		exp := newStatesCollector(Config{Region: "eu-west-1", Collectors: test.collectors}).(*statesCollector)
+		client := &statesTestGatherer{}
+		s := newScrape("eu-west-1", client, newDataCache(), 0, log.Base())
+		s.loadClusters(func(*types.ECSCluster) bool { return true })
+
+		ch := make(chan prometheus.Metric)
+		go func() {
+			if err := exp.Update(context.TODO(), s, ch); err != nil {
+				t.Errorf("\n- %v\n- Update shouldn't fail: %v", test, err)
+			}
+			close(ch)
+		}()
+
+		metrics := 0
+		for range ch {
+			metrics++
+		}
+
+		if client.ciCalls != test.expectedCICalls {
+			t.Errorf("\n- %v\n- Container instance calls are wrong, want: %d; got: %d", test, test.expectedCICalls, client.ciCalls)
+		}
+		if metrics != test.expectedMetrics {
+			t.Errorf("\n- %v\n- Number of metrics is wrong, want: %d; got: %d", test, test.expectedMetrics, metrics)
+		}
+	}
+}
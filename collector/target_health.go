@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+// targetHealthStates are the known target health states, all of them are exported for every service and the
+// states missing from the list are exported with their raw value when a target has them
+var targetHealthStates = []string{
+	types.TargetHealthStateInitial,
+	types.TargetHealthStateHealthy,
+	types.TargetHealthStateUnhealthy,
+	types.TargetHealthStateUnused,
+	types.TargetHealthStateDraining,
+}
+
+// targetHealthSeverity is the severity of the target health states, a target of several target groups
+// of a service has the most severe state
+var targetHealthSeverity = map[string]int{
+	types.TargetHealthStateHealthy:   0,
+	types.TargetHealthStateUnused:    1,
+	types.TargetHealthStateDraining:  2,
+	types.TargetHealthStateInitial:   3,
+	types.TargetHealthStateUnhealthy: 4,
+}
+
+func init() {
+	registerCollector("targethealth", false, newTargetHealthCollector)
+}
+
+// targetHealthCollector collects the health of the load balancer targets of the cluster services
+type targetHealthCollector struct {
+	region      string
+	maxServices int // The maximum number of services exported per cluster (0 means no limit)
+	d           descBuilder
+
+	// Metrics descriptions
+	serviceTargets          *prometheus.Desc
+	serviceUnhealthyTargets *prometheus.Desc
+}
+
+// newTargetHealthCollector returns an initialized target health collector
+func newTargetHealthCollector(cfg Config) subCollector {
+	d := newDescBuilder(cfg)
+	return &targetHealthCollector{
+		region:      cfg.Region,
+		maxServices: cfg.MaxServices,
+		d:           d,
+
+		serviceTargets: d.desc("service", "targets",
+			"The number of load balancer targets of the service by health state",
+			"region", "cluster", "service", "state"),
+		serviceUnhealthyTargets: d.desc("service", "unhealthy_targets",
+			"The number of unhealthy load balancer targets of the service by reason",
+			"region", "cluster", "service", "reason"),
+	}
+}
+
+// Describe implements subCollector
+func (c *targetHealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.serviceTargets
+	ch <- c.serviceUnhealthyTargets
+}
+
+// Update implements subCollector
+func (c *targetHealthCollector) Update(ctx context.Context, s *scrape, ch chan<- prometheus.Metric) error {
+	return s.forEachCluster(func(cluster *types.ECSCluster) error {
+		// The same services as the services collector
+		ss, err := s.services(cluster)
+		ss = limitServices(ss, c.maxServices)
+		if len(ss) == 0 {
+			return err
+		}
+
+		ths, thErr := s.targetHealth(cluster, ss)
+		if thErr == nil || ths != nil {
+			c.collectClusterTargetHealthMetrics(ctx, ch, cluster, ss, ths)
+		}
+		if err == nil {
+			err = thErr
+		}
+		return err
+	})
+}
+
+// collectClusterTargetHealthMetrics collects the targets of the services by state, the targets registered on several
+// target groups of a service (same ID and port) are counted once
+func (c *targetHealthCollector) collectClusterTargetHealthMetrics(ctx context.Context, ch chan<- prometheus.Metric, cluster *types.ECSCluster, services []*types.ECSService, targets []*types.TargetHealth) {
+	byTargetGroup := map[string][]*types.TargetHealth{}
+	for _, th := range targets {
+		byTargetGroup[th.TargetGroupARN] = append(byTargetGroup[th.TargetGroupARN], th)
+	}
+
+	for _, s := range services {
+		// Only the services behind a load balancer have targets
+		if len(s.TargetGroups) == 0 {
+			continue
+		}
+
+		byTarget := map[targetKey]*types.TargetHealth{}
+		for _, tg := range s.TargetGroups {
+			for _, th := range byTargetGroup[tg] {
+				k := targetKey{id: th.TargetID, port: th.Port}
+				if prev, ok := byTarget[k]; !ok || targetHealthSeverity[th.State] > targetHealthSeverity[prev.State] {
+					byTarget[k] = th
+				}
+			}
+		}
+
+		states := map[string]int{}
+		reasons := map[string]int{}
+		for _, th := range byTarget {
+			states[th.State]++
+			if th.State == types.TargetHealthStateUnhealthy {
+				reasons[th.Reason]++
+			}
+		}
+
+		exported := make([]string, 0, len(targetHealthStates)+len(states))
+		exported = append(exported, targetHealthStates...)
+		unknown := []string{}
+		for state := range states {
+			if _, ok := targetHealthSeverity[state]; !ok {
+				unknown = append(unknown, state)
+			}
+		}
+		sort.Strings(unknown)
+		exported = append(exported, unknown...)
+
+		for _, state := range exported {
+			values := c.d.values([]string{c.region, cluster.Name, s.Name, state}, cluster.ID, s.ID)
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceTargets, prometheus.GaugeValue, float64(states[state]), values...))
+		}
+
+		rs := make([]string, 0, len(reasons))
+		for r := range reasons {
+			rs = append(rs, r)
+		}
+		sort.Strings(rs)
+		for _, r := range rs {
+			values := c.d.values([]string{c.region, cluster.Name, s.Name, r}, cluster.ID, s.ID)
+			sendSafeMetric(ctx, ch, prometheus.MustNewConstMetric(c.serviceUnhealthyTargets, prometheus.GaugeValue, float64(reasons[r]), values...))
+		}
+	}
+}
+
+// targetKey identifies a load balancer target
+type targetKey struct {
+	id   string
+	port int64
+}
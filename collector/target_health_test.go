@@ -0,0 +1,171 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/slok/ecs-exporter/types"
+)
+
+func TestCollectClusterTargetHealthMetrics(t *testing.T) {
+	exp := newTargetHealthCollector(Config{Region: "eu-west-1"}).(*targetHealthCollector)
+	ch := make(chan prometheus.Metric)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{
+		&types.ECSService{ID: "s1", Name: "service1", TargetGroups: []string{"tg1", "tg2"}},
+		&types.ECSService{ID: "s2", Name: "service2", TargetGroups: []string{"tg3"}},
+		&types.ECSService{ID: "s3", Name: "service3"},
+	}
+	testThs := []*types.TargetHealth{
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-1", Port: 32768, State: "healthy"},
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-2", Port: 32768, State: "unhealthy", Reason: "Target.Timeout"},
+		&types.TargetHealth{TargetGroupARN: "tg2", TargetID: "i-1", Port: 32769, State: "unhealthy", Reason: "Target.ResponseCodeMismatch"},
+		&types.TargetHealth{TargetGroupARN: "tg2", TargetID: "i-2", Port: 32769, State: "unhealthy", Reason: "Target.Timeout"},
+		&types.TargetHealth{TargetGroupARN: "tg2", TargetID: "i-3", Port: 32769, State: "draining", Reason: "Target.DeregistrationInProgress"},
+		&types.TargetHealth{TargetGroupARN: "tg2", TargetID: "i-4", Port: 32769, State: "initial", Reason: "Elb.RegistrationInProgress"},
+	}
+	go func() {
+		exp.collectClusterTargetHealthMetrics(context.TODO(), ch, testC, testSs, testThs)
+		close(ch)
+	}()
+
+	got := map[string]map[string]float64{}
+	for m := range ch {
+		g := readGauge(m)
+		desc := m.Desc().String()
+		name := desc[strings.Index(desc, `"`)+1 : strings.Index(desc, `",`)]
+		if got[g.labels["service"]] == nil {
+			got[g.labels["service"]] = map[string]float64{}
+		}
+		got[g.labels["service"]][name+"/"+g.labels["state"]+g.labels["reason"]] = g.value
+	}
+
+	// The services without target groups don't have metrics
+	expected := map[string]map[string]float64{
+		"service1": {
+			"ecs_service_targets/initial":                               1,
+			"ecs_service_targets/healthy":                               1,
+			"ecs_service_targets/unhealthy":                             3,
+			"ecs_service_targets/unused":                                0,
+			"ecs_service_targets/draining":                              1,
+			"ecs_service_unhealthy_targets/Target.Timeout":              2,
+			"ecs_service_unhealthy_targets/Target.ResponseCodeMismatch": 1,
+		},
+		"service2": {
+			"ecs_service_targets/initial":   0,
+			"ecs_service_targets/healthy":   0,
+			"ecs_service_targets/unhealthy": 0,
+			"ecs_service_targets/unused":    0,
+			"ecs_service_targets/draining":  0,
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Metrics are wrong, want: %v; got: %v", expected, got)
+	}
+}
+
+func TestCollectClusterTargetHealthMetricsSharedTargets(t *testing.T) {
+	exp := newTargetHealthCollector(Config{Region: "eu-west-1"}).(*targetHealthCollector)
+	ch := make(chan prometheus.Metric)
+
+	// The targets of the service are registered on both target groups (e.g. an ALB and an NLB)
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1", TargetGroups: []string{"tg1", "tg2"}}}
+	testThs := []*types.TargetHealth{
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-1", Port: 32768, State: "healthy"},
+		&types.TargetHealth{TargetGroupARN: "tg2", TargetID: "i-1", Port: 32768, State: "healthy"},
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-2", Port: 32768, State: "healthy"},
+		&types.TargetHealth{TargetGroupARN: "tg2", TargetID: "i-2", Port: 32768, State: "unhealthy", Reason: "Target.Timeout"},
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-3", Port: 32768, State: "draining", Reason: "Target.DeregistrationInProgress"},
+		&types.TargetHealth{TargetGroupARN: "tg2", TargetID: "i-3", Port: 32768, State: "unused", Reason: "Target.NotInUse"},
+	}
+	go func() {
+		exp.collectClusterTargetHealthMetrics(context.TODO(), ch, testC, testSs, testThs)
+		close(ch)
+	}()
+
+	got := map[string]float64{}
+	for m := range ch {
+		g := readGauge(m)
+		desc := m.Desc().String()
+		got[desc[strings.Index(desc, `"`)+1:strings.Index(desc, `",`)]+"/"+g.labels["state"]+g.labels["reason"]] = g.value
+	}
+
+	// Every target is counted once with its most severe state
+	expected := map[string]float64{
+		"ecs_service_targets/initial":                  0,
+		"ecs_service_targets/healthy":                  1,
+		"ecs_service_targets/unhealthy":                1,
+		"ecs_service_targets/unused":                   0,
+		"ecs_service_targets/draining":                 1,
+		"ecs_service_unhealthy_targets/Target.Timeout": 1,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Metrics are wrong, want: %v; got: %v", expected, got)
+	}
+}
+
+func TestCollectClusterTargetHealthMetricsUnknownStates(t *testing.T) {
+	exp := newTargetHealthCollector(Config{Region: "eu-west-1"}).(*targetHealthCollector)
+	ch := make(chan prometheus.Metric)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1", TargetGroups: []string{"tg1"}}}
+	testThs := []*types.TargetHealth{
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-1", Port: 32768, State: "healthy"},
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-2", Port: 32768, State: "unavailable", Reason: "Target.HealthCheckDisabled"},
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-3", Port: 32768, State: "unavailable", Reason: "Target.HealthCheckDisabled"},
+		&types.TargetHealth{TargetGroupARN: "tg1", TargetID: "i-4", Port: 32768, State: "unhealthy.draining"},
+	}
+	go func() {
+		exp.collectClusterTargetHealthMetrics(context.TODO(), ch, testC, testSs, testThs)
+		close(ch)
+	}()
+
+	got := map[string]float64{}
+	for m := range ch {
+		g := readGauge(m)
+		desc := m.Desc().String()
+		got[desc[strings.Index(desc, `"`)+1:strings.Index(desc, `",`)]+"/"+g.labels["state"]+g.labels["reason"]] = g.value
+	}
+
+	// The unknown states are counted with their raw value
+	expected := map[string]float64{
+		"ecs_service_targets/initial":            0,
+		"ecs_service_targets/healthy":            1,
+		"ecs_service_targets/unhealthy":          0,
+		"ecs_service_targets/unused":             0,
+		"ecs_service_targets/draining":           0,
+		"ecs_service_targets/unavailable":        2,
+		"ecs_service_targets/unhealthy.draining": 1,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Metrics are wrong, want: %v; got: %v", expected, got)
+	}
+}
+
+func TestCollectClusterTargetHealthMetricsTimeout(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("Test shouldn't panic, it did: %v", r)
+		}
+	}()
+
+	exp := newTargetHealthCollector(Config{Region: "eu-west-1"}).(*targetHealthCollector)
+	ch := make(chan prometheus.Metric)
+	close(ch)
+
+	testC := &types.ECSCluster{ID: "c1", Name: "cluster1"}
+	testSs := []*types.ECSService{&types.ECSService{ID: "s1", Name: "service1", TargetGroups: []string{"tg1"}}}
+	testThs := []*types.TargetHealth{&types.TargetHealth{TargetGroupARN: "tg1", State: "unhealthy", Reason: "Target.Timeout"}}
+
+	// Cancel the context to mock as a finished main function
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exp.collectClusterTargetHealthMetrics(ctx, ch, testC, testSs, testThs)
+}
@@ -0,0 +1,147 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Logger is a leveled logger that adds its fields to every message
+type Logger interface {
+	Debug(args ...interface{})
+	Debugf(format string, args ...interface{})
+	Info(args ...interface{})
+	Infof(format string, args ...interface{})
+	Warn(args ...interface{})
+	Warnf(format string, args ...interface{})
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+	// With returns a logger that adds the field to every message
+	With(key string, value interface{}) Logger
+}
+
+// Format is the output format of the logs
+type Format string
+
+// log formats
+const (
+	LogfmtFormat Format = "logfmt"
+	JSONFormat   Format = "json"
+)
+
+// levels by name
+var levels = map[string]Level{
+	"debug": DebugLevel,
+	"info":  InfoLevel,
+	"warn":  WarnLevel,
+	"error": ErrorLevel,
+}
+
+// ParseLevel returns the level of a level name (debug, info, warn or error)
+func ParseLevel(s string) (Level, error) {
+	l, ok := levels[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("invalid log level: %s", s)
+	}
+	return l, nil
+}
+
+// ParseFormat returns the format of a format name (logfmt or json)
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case LogfmtFormat, JSONFormat:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid log format: %s", s)
+}
+
+// formatter returns the logrus formatter of the format
+func formatter(f Format) logrus.Formatter {
+	if f == JSONFormat {
+		return &logrus.JSONFormatter{}
+	}
+	return &logrus.TextFormatter{DisableColors: true}
+}
+
+// SetFormat sets the output format of the standard logger
+func SetFormat(f Format) {
+	logger.Lock()
+	defer logger.Unlock()
+	logger.Formatter = formatter(f)
+}
+
+// New returns a new logger that writes to w
+func New(w io.Writer, level Level, f Format) Logger {
+	l := logrus.New()
+	l.Out = w
+	l.Level = logrus.Level(level)
+	l.Formatter = formatter(f)
+	return &fieldLogger{
+		logger: &customLogger{Logger: l, Mutex: sync.Mutex{}},
+		fields: logrus.Fields{},
+	}
+}
+
+// Base returns a logger that uses the standard logger
+func Base() Logger {
+	return &fieldLogger{logger: &logger, fields: logrus.Fields{}}
+}
+
+// fieldLogger is a Logger with fields
+type fieldLogger struct {
+	logger *customLogger
+	fields logrus.Fields
+}
+
+// With implements Logger
+func (l *fieldLogger) With(key string, value interface{}) Logger {
+	fields := logrus.Fields{}
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &fieldLogger{logger: l.logger, fields: fields}
+}
+
+// Debug implements Logger
+func (l *fieldLogger) Debug(args ...interface{}) {
+	l.logger.Sourced().WithFields(l.fields).Debug(args...)
+}
+
+// Debugf implements Logger
+func (l *fieldLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Sourced().WithFields(l.fields).Debugf(format, args...)
+}
+
+// Info implements Logger
+func (l *fieldLogger) Info(args ...interface{}) {
+	l.logger.Sourced().WithFields(l.fields).Info(args...)
+}
+
+// Infof implements Logger
+func (l *fieldLogger) Infof(format string, args ...interface{}) {
+	l.logger.Sourced().WithFields(l.fields).Infof(format, args...)
+}
+
+// Warn implements Logger
+func (l *fieldLogger) Warn(args ...interface{}) {
+	l.logger.Sourced().WithFields(l.fields).Warn(args...)
+}
+
+// Warnf implements Logger
+func (l *fieldLogger) Warnf(format string, args ...interface{}) {
+	l.logger.Sourced().WithFields(l.fields).Warnf(format, args...)
+}
+
+// Error implements Logger
+func (l *fieldLogger) Error(args ...interface{}) {
+	l.logger.Sourced().WithFields(l.fields).Error(args...)
+}
+
+// Errorf implements Logger
+func (l *fieldLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Sourced().WithFields(l.fields).Errorf(format, args...)
+}
@@ -0,0 +1,74 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLoggerJSON(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := New(b, InfoLevel, JSONFormat).With("region", "eu-west-1")
+	l.With("cluster", "cluster1").Infof("Hello %s", "world")
+	l.Debugf("Filtered by level")
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Log lines are wrong, want: %d; got: %d", 1, len(lines))
+	}
+
+	got := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("Log should be valid JSON: %v", err)
+	}
+	expected := map[string]string{
+		"msg":     "Hello world",
+		"level":   "info",
+		"region":  "eu-west-1",
+		"cluster": "cluster1",
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("Field %s is wrong, want: %s; got: %v", k, v, got[k])
+		}
+	}
+	if s, _ := got["source"].(string); !strings.HasPrefix(s, "structured_test.go:") {
+		t.Errorf("Source should be the caller, got: %s", s)
+	}
+}
+
+func TestLoggerLogfmt(t *testing.T) {
+	b := &bytes.Buffer{}
+	New(b, DebugLevel, LogfmtFormat).With("operation", "ListClusters").Debug("Getting clusters")
+
+	got := b.String()
+	for _, expected := range []string{`level=debug`, `msg="Getting clusters"`, `operation=ListClusters`} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Log should have %s, got: %s", expected, got)
+		}
+	}
+}
+
+func TestParseLevelFormat(t *testing.T) {
+	tests := []struct {
+		level       string
+		format      string
+		expectedErr bool
+	}{
+		{"debug", "logfmt", false},
+		{"info", "json", false},
+		{"WARN", "JSON", false},
+		{"error", "logfmt", false},
+		{"trace", "logfmt", true},
+		{"info", "xml", true},
+	}
+
+	for _, test := range tests {
+		_, lErr := ParseLevel(test.level)
+		_, fErr := ParseFormat(test.format)
+		if gotErr := lErr != nil || fErr != nil; gotErr != test.expectedErr {
+			t.Errorf("\n- %v\n- Parse error is wrong, want: %t; got: %v %v", test, test.expectedErr, lErr, fErr)
+		}
+	}
+}
@@ -87,11 +87,33 @@ func MockECSDescribeServices(t *testing.T, mockMatcher *sdk.MockECSAPI, wantErro
 	ss := []*ecs.Service{}
 	for _, s := range services {
 		ds := &ecs.Service{
-			ServiceArn:   aws.String(s.ID),
-			ServiceName:  aws.String(s.Name),
-			PendingCount: aws.Int64(s.PendingT),
-			RunningCount: aws.Int64(s.RunningT),
-			DesiredCount: aws.Int64(s.DesiredT),
+			ServiceArn:     aws.String(s.ID),
+			ServiceName:    aws.String(s.Name),
+			PendingCount:   aws.Int64(s.PendingT),
+			RunningCount:   aws.Int64(s.RunningT),
+			DesiredCount:   aws.Int64(s.DesiredT),
+			TaskDefinition: aws.String(s.TaskDefinition),
+			Status:         aws.String(s.Status),
+		}
+		if !s.CreatedAt.IsZero() {
+			ds.CreatedAt = aws.Time(s.CreatedAt)
+		}
+		for _, d := range s.Deployments {
+			dd := &ecs.Deployment{
+				Id:             aws.String(d.ID),
+				Status:         aws.String(d.Status),
+				TaskDefinition: aws.String(d.TaskDefinition),
+				DesiredCount:   aws.Int64(d.DesiredT),
+				PendingCount:   aws.Int64(d.PendingT),
+				RunningCount:   aws.Int64(d.RunningT),
+			}
+			if !d.CreatedAt.IsZero() {
+				dd.CreatedAt = aws.Time(d.CreatedAt)
+			}
+			ds.Deployments = append(ds.Deployments, dd)
+		}
+		for _, tg := range s.TargetGroups {
+			ds.LoadBalancers = append(ds.LoadBalancers, &ecs.LoadBalancer{TargetGroupArn: aws.String(tg)})
 		}
 		ss = append(ss, ds)
 	}
@@ -142,9 +164,12 @@ func MockECSDescribeContainerInstances(t *testing.T, mockMatcher *sdk.MockECSAPI
 	cis := []*ecs.ContainerInstance{}
 	for _, c := range cInstances {
 
-		status := types.ContainerInstanceStatusInactive
-		if c.Active {
-			status = types.ContainerInstanceStatusActive
+		status := c.Status
+		if status == "" {
+			status = types.ContainerInstanceStatusInactive
+			if c.Active {
+				status = types.ContainerInstanceStatusActive
+			}
 		}
 
 		dc := &ecs.ContainerInstance{
@@ -0,0 +1,213 @@
+// Package openmetrics encodes the gathered metric families in the OpenMetrics text format.
+//
+// The Prometheus client model doesn't have the OpenMetrics info and state set types, they are
+// exposed as gauges and the exporter that creates them sets their types on a FamilyTypes passed to
+// Write. A gauge family typed as info named "<name>_info" is encoded as the info family "<name>"
+// and a gauge family typed as state set is encoded as a state set, the rest of the gauge families
+// are encoded as gauges.
+package openmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// Version is the OpenMetrics version of the encoded metrics
+	Version = "1.0.0"
+	// ContentType is the content type of the encoded metrics
+	ContentType = "application/openmetrics-text; version=" + Version + "; charset=utf-8"
+
+	mediaType   = "application/openmetrics-text"
+	infoSuffix  = "_info"
+	totalSuffix = "_total"
+)
+
+// OpenMetrics family types
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+	typeSummary   = "summary"
+	typeInfo      = "info"
+	typeStateSet  = "stateset"
+	typeUnknown   = "unknown"
+)
+
+// FamilyTypes are the OpenMetrics types of the gauge families that are not encoded as gauges by family name
+type FamilyTypes map[string]string
+
+// SetInfo sets the gauge family as an info family, the name is the family name with the "_info" suffix
+func (t FamilyTypes) SetInfo(name string) {
+	t[name] = typeInfo
+}
+
+// SetStateSet sets the gauge family as a state set family, every metric of the family must have a label
+// named as the family with the state
+func (t FamilyTypes) SetStateSet(name string) {
+	t[name] = typeStateSet
+}
+
+// Negotiate returns true if the Accept header prefers the OpenMetrics format over the rest of the
+// media types, the OpenMetrics versions other than 1.0.0 and 0.0.1 are not accepted
+func Negotiate(h http.Header) bool {
+	omQ, otherQ := 0.0, 0.0
+	for _, part := range strings.Split(h.Get("Accept"), ",") {
+		params := strings.Split(part, ";")
+		mt := strings.ToLower(strings.TrimSpace(params[0]))
+		if mt == "" {
+			continue
+		}
+
+		q, version := 1.0, ""
+		for _, p := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.ToLower(kv[0]) {
+			case "q":
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			case "version":
+				version = kv[1]
+			}
+		}
+
+		if mt == mediaType {
+			if (version == "" || version == Version || version == "0.0.1") && q > omQ {
+				omQ = q
+			}
+			continue
+		}
+		if mt != "*/*" && q > otherQ {
+			otherQ = q
+		}
+	}
+	return omQ > 0 && omQ >= otherQ
+}
+
+// Write writes the metric families in the OpenMetrics text format followed by the EOF marker, the gauge
+// families are encoded with their type on the family types (can be nil) or as gauges if missing
+func Write(w io.Writer, mfs []*dto.MetricFamily, types FamilyTypes) error {
+	bw := bufio.NewWriter(w)
+	for _, mf := range mfs {
+		if len(mf.Metric) == 0 {
+			continue
+		}
+		writeFamily(bw, mf, types)
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// writeFamily writes the metadata and the samples of a metric family
+func writeFamily(w *bufio.Writer, mf *dto.MetricFamily, types FamilyTypes) {
+	name := mf.GetName()
+	typ := familyType(mf, types)
+
+	// The info and counter families are named without the sample suffix
+	famName := name
+	switch typ {
+	case typeInfo:
+		famName = strings.TrimSuffix(name, infoSuffix)
+	case typeCounter:
+		famName = strings.TrimSuffix(name, totalSuffix)
+	}
+
+	fmt.Fprintf(w, "# TYPE %s %s\n", famName, typ)
+	if mf.GetHelp() != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", famName, escaper.Replace(mf.GetHelp()))
+	}
+
+	for _, m := range mf.Metric {
+		switch typ {
+		case typeCounter:
+			writeSample(w, famName+totalSuffix, m, "", "", m.GetCounter().GetValue())
+		case typeGauge, typeInfo, typeStateSet:
+			writeSample(w, name, m, "", "", m.GetGauge().GetValue())
+		case typeSummary:
+			s := m.GetSummary()
+			for _, q := range s.GetQuantile() {
+				writeSample(w, name, m, "quantile", formatFloat(q.GetQuantile()), q.GetValue())
+			}
+			writeSample(w, name+"_sum", m, "", "", s.GetSampleSum())
+			writeSample(w, name+"_count", m, "", "", float64(s.GetSampleCount()))
+		case typeHistogram:
+			h := m.GetHistogram()
+			inf := false
+			for _, b := range h.GetBucket() {
+				inf = inf || math.IsInf(b.GetUpperBound(), 1)
+				writeSample(w, name+"_bucket", m, "le", formatFloat(b.GetUpperBound()), float64(b.GetCumulativeCount()))
+			}
+			// The +Inf bucket is required
+			if !inf {
+				writeSample(w, name+"_bucket", m, "le", "+Inf", float64(h.GetSampleCount()))
+			}
+			writeSample(w, name+"_sum", m, "", "", h.GetSampleSum())
+			writeSample(w, name+"_count", m, "", "", float64(h.GetSampleCount()))
+		default:
+			writeSample(w, name, m, "", "", m.GetUntyped().GetValue())
+		}
+	}
+}
+
+// familyType returns the OpenMetrics type of a metric family
+func familyType(mf *dto.MetricFamily, types FamilyTypes) string {
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		return typeCounter
+	case dto.MetricType_SUMMARY:
+		return typeSummary
+	case dto.MetricType_HISTOGRAM:
+		return typeHistogram
+	case dto.MetricType_UNTYPED:
+		return typeUnknown
+	}
+
+	if typ, ok := types[mf.GetName()]; ok {
+		return typ
+	}
+	return typeGauge
+}
+
+// writeSample writes a sample of a metric, the extra label (if not empty) is added to the metric labels
+func writeSample(w *bufio.Writer, name string, m *dto.Metric, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(m.Label) > 0 || extraName != "" {
+		w.WriteByte('{')
+		sep := ""
+		for _, l := range m.Label {
+			fmt.Fprintf(w, `%s%s="%s"`, sep, l.GetName(), escaper.Replace(l.GetValue()))
+			sep = ","
+		}
+		if extraName != "" {
+			fmt.Fprintf(w, `%s%s="%s"`, sep, extraName, escaper.Replace(extraValue))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	// OpenMetrics timestamps are in seconds
+	if m.TimestampMs != nil {
+		w.WriteByte(' ')
+		w.WriteString(formatFloat(float64(m.GetTimestampMs()) / 1000))
+	}
+	w.WriteByte('\n')
+}
+
+// formatFloat formats a value, the infinities are +Inf and -Inf and not a number is NaN
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escaper escapes the backslashes, line feeds and double quotes of the help texts and label values
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
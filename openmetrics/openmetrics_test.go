@@ -0,0 +1,177 @@
+package openmetrics
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"text/plain;version=0.0.4", false},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", false},
+		{"application/openmetrics-text", true},
+		{"application/openmetrics-text;version=1.0.0", true},
+		{"application/openmetrics-text; version=0.0.1", true},
+		{"application/openmetrics-text;version=2.0.0", false},
+		{"application/openmetrics-text;version=1.0.0;q=0", false},
+		{"application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", true},
+		{"text/plain;version=0.0.4,application/openmetrics-text;version=1.0.0;q=0.5", false},
+		{"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,application/openmetrics-text;q=0.8", true},
+	}
+
+	for _, test := range tests {
+		h := http.Header{}
+		h.Set("Accept", test.accept)
+		if got := Negotiate(h); got != test.expected {
+			t.Errorf("\n- %v\n- Negotiation is wrong, want: %t; got: %t", test, test.expected, got)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	gauge := func(name, help string, values map[float64][]*dto.LabelPair) *dto.MetricFamily {
+		mf := &dto.MetricFamily{Name: proto.String(name), Help: proto.String(help), Type: dto.MetricType_GAUGE.Enum()}
+		for _, v := range []float64{0, 1, 2} {
+			if ls, ok := values[v]; ok {
+				mf.Metric = append(mf.Metric, &dto.Metric{Label: ls, Gauge: &dto.Gauge{Value: proto.Float64(v)}})
+			}
+		}
+		return mf
+	}
+	label := func(name, value string) *dto.LabelPair {
+		return &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)}
+	}
+	types := FamilyTypes{}
+	types.SetInfo("ecs_service_info")
+	types.SetStateSet("ecs_service_status")
+
+	tests := []struct {
+		mfs      []*dto.MetricFamily
+		expected string
+	}{
+		{
+			[]*dto.MetricFamily{},
+			"# EOF\n",
+		},
+		{
+			[]*dto.MetricFamily{
+				gauge("ecs_service_info", "Information of the service, always 1", map[float64][]*dto.LabelPair{1: {label("service", "api")}}),
+			},
+			"# TYPE ecs_service info\n# HELP ecs_service Information of the service, always 1\necs_service_info{service=\"api\"} 1\n# EOF\n",
+		},
+		{
+			// Only the families typed as info are info families
+			[]*dto.MetricFamily{
+				gauge("ecs_cluster_info", "", map[float64][]*dto.LabelPair{1: {label("cluster", "c1")}}),
+			},
+			"# TYPE ecs_cluster_info gauge\necs_cluster_info{cluster=\"c1\"} 1\n# EOF\n",
+		},
+		{
+			[]*dto.MetricFamily{
+				gauge("ecs_service_status", "The status", map[float64][]*dto.LabelPair{
+					0: {label("service", "api"), label("ecs_service_status", "DRAINING")},
+					1: {label("service", "api"), label("ecs_service_status", "ACTIVE")},
+				}),
+			},
+			"# TYPE ecs_service_status stateset\n# HELP ecs_service_status The status\necs_service_status{service=\"api\",ecs_service_status=\"DRAINING\"} 0\necs_service_status{service=\"api\",ecs_service_status=\"ACTIVE\"} 1\n# EOF\n",
+		},
+		{
+			// Only the families typed as state set are state sets
+			[]*dto.MetricFamily{
+				gauge("ecs_cluster_status", "", map[float64][]*dto.LabelPair{
+					0: {label("cluster", "c1"), label("ecs_cluster_status", "INACTIVE")},
+					1: {label("cluster", "c1"), label("ecs_cluster_status", "ACTIVE")},
+				}),
+			},
+			"# TYPE ecs_cluster_status gauge\necs_cluster_status{cluster=\"c1\",ecs_cluster_status=\"INACTIVE\"} 0\necs_cluster_status{cluster=\"c1\",ecs_cluster_status=\"ACTIVE\"} 1\n# EOF\n",
+		},
+		{
+			[]*dto.MetricFamily{
+				gauge("ecs_up", "Was the \"last\" query\nof ecs successful.", map[float64][]*dto.LabelPair{1: {label("region", "eu\\west\n\"1\"")}}),
+			},
+			"# TYPE ecs_up gauge\n# HELP ecs_up Was the \\\"last\\\" query\\nof ecs successful.\necs_up{region=\"eu\\\\west\\n\\\"1\\\"\"} 1\n# EOF\n",
+		},
+		{
+			[]*dto.MetricFamily{
+				&dto.MetricFamily{Name: proto.String("ecs_service_dropped_total"), Type: dto.MetricType_COUNTER.Enum(), Metric: []*dto.Metric{
+					&dto.Metric{Counter: &dto.Counter{Value: proto.Float64(3)}, TimestampMs: proto.Int64(1500000000500)},
+				}},
+				&dto.MetricFamily{Name: proto.String("requests"), Type: dto.MetricType_COUNTER.Enum(), Metric: []*dto.Metric{
+					&dto.Metric{Counter: &dto.Counter{Value: proto.Float64(1)}},
+				}},
+				&dto.MetricFamily{Name: proto.String("empty"), Type: dto.MetricType_COUNTER.Enum()},
+			},
+			"# TYPE ecs_service_dropped counter\necs_service_dropped_total 3 1.5000000005e+09\n# TYPE requests counter\nrequests_total 1\n# EOF\n",
+		},
+		{
+			[]*dto.MetricFamily{
+				&dto.MetricFamily{Name: proto.String("duration_seconds"), Type: dto.MetricType_HISTOGRAM.Enum(), Metric: []*dto.Metric{
+					&dto.Metric{Histogram: &dto.Histogram{SampleCount: proto.Uint64(3), SampleSum: proto.Float64(1.5), Bucket: []*dto.Bucket{
+						&dto.Bucket{UpperBound: proto.Float64(0.5), CumulativeCount: proto.Uint64(2)},
+					}}},
+				}},
+				&dto.MetricFamily{Name: proto.String("latency_seconds"), Type: dto.MetricType_SUMMARY.Enum(), Metric: []*dto.Metric{
+					&dto.Metric{Summary: &dto.Summary{SampleCount: proto.Uint64(2), SampleSum: proto.Float64(3), Quantile: []*dto.Quantile{
+						&dto.Quantile{Quantile: proto.Float64(0.5), Value: proto.Float64(1)},
+					}}},
+				}},
+				&dto.MetricFamily{Name: proto.String("legacy"), Type: dto.MetricType_UNTYPED.Enum(), Metric: []*dto.Metric{
+					&dto.Metric{Untyped: &dto.Untyped{Value: proto.Float64(7)}},
+				}},
+			},
+			"# TYPE duration_seconds histogram\nduration_seconds_bucket{le=\"0.5\"} 2\nduration_seconds_bucket{le=\"+Inf\"} 3\nduration_seconds_sum 1.5\nduration_seconds_count 3\n" +
+				"# TYPE latency_seconds summary\nlatency_seconds{quantile=\"0.5\"} 1\nlatency_seconds_sum 3\nlatency_seconds_count 2\n" +
+				"# TYPE legacy unknown\nlegacy 7\n# EOF\n",
+		},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := Write(&b, test.mfs, types); err != nil {
+			t.Fatalf("\n- %v\n- Writing the metrics shouldn't fail: %v", test, err)
+		}
+		if got := b.String(); got != test.expected {
+			t.Errorf("\n- %v\n- Metrics are wrong, want:\n%s\ngot:\n%s", test, test.expected, got)
+		}
+	}
+
+	// Without the family types the info and state set families are gauges
+	var b bytes.Buffer
+	mfs := []*dto.MetricFamily{gauge("ecs_service_info", "", map[float64][]*dto.LabelPair{1: nil})}
+	if err := Write(&b, mfs, nil); err != nil {
+		t.Fatalf("Writing the metrics shouldn't fail: %v", err)
+	}
+	if expected := "# TYPE ecs_service_info gauge\necs_service_info 1\n# EOF\n"; b.String() != expected {
+		t.Errorf("Metrics are wrong, want:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestWriteRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "duration_seconds", Help: "The duration.", Buckets: []float64{1}})
+	h.Observe(0.5)
+	reg.MustRegister(h)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := Write(&b, mfs, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# TYPE duration_seconds histogram\n# HELP duration_seconds The duration.\nduration_seconds_bucket{le=\"1\"} 1\nduration_seconds_bucket{le=\"+Inf\"} 1\nduration_seconds_sum 0.5\nduration_seconds_count 1\n# EOF\n"
+	if got := b.String(); got != expected {
+		t.Errorf("Metrics are wrong, want:\n%s\ngot:\n%s", expected, got)
+	}
+}
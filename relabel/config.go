@@ -0,0 +1,119 @@
+// Package relabel applies Prometheus style relabeling rules and series limits
+// to the gathered metrics before they are exposed.
+package relabel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/prometheus/common/model"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Action is the action of a relabeling rule
+type Action string
+
+// relabeling actions
+const (
+	Replace   Action = "replace"   // Sets the target label to the replacement of the source labels if the regex matches
+	Keep      Action = "keep"      // Drops the series whose source labels don't match the regex
+	Drop      Action = "drop"      // Drops the series whose source labels match the regex
+	LabelDrop Action = "labeldrop" // Removes the labels whose name matches the regex
+	LabelKeep Action = "labelkeep" // Removes the labels whose name doesn't match the regex
+	LabelMap  Action = "labelmap"  // Copies the labels whose name matches the regex to the replacement label name, the invalid names are ignored
+)
+
+// rule defaults
+const (
+	defaultSeparator   = ";"
+	defaultRegex       = "(.*)"
+	defaultReplacement = "$1"
+	defaultAction      = Replace
+)
+
+// metricNameLabel is the label that has the metric name on the source labels
+const metricNameLabel = "__name__"
+
+// Rule is a relabeling rule
+type Rule struct {
+	SourceLabels []string `yaml:"source_labels"` // The labels whose values are concatenated and matched against the regex
+	Separator    string   `yaml:"separator"`     // The separator of the concatenated source labels (default ";")
+	Regex        string   `yaml:"regex"`         // The regex matched against the source labels value or the label names, anchored on both ends (default "(.*)")
+	TargetLabel  string   `yaml:"target_label"`  // The label set by the replace action
+	Replacement  string   `yaml:"replacement"`   // The replacement with the regex capture groups (default "$1")
+	Action       Action   `yaml:"action"`        // The action of the rule (default "replace")
+
+	re *regexp.Regexp
+}
+
+// Config is the relabeling configuration
+type Config struct {
+	Rules []*Rule `yaml:"relabel_configs"` // The rules applied in order to every series
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler to set the rule defaults
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Rule
+	p := plain{
+		Separator:   defaultSeparator,
+		Regex:       defaultRegex,
+		Replacement: defaultReplacement,
+		Action:      defaultAction,
+	}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	*r = Rule(p)
+	return nil
+}
+
+// LoadFile reads and validates the relabeling configuration file
+func LoadFile(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("error parsing relabel config file %s: %v", path, err)
+	}
+
+	for i, r := range c.Rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("invalid relabel rule %d on %s: %v", i, path, err)
+		}
+	}
+	return c, nil
+}
+
+// compile validates the rule and compiles its regex
+func (r *Rule) compile() error {
+	re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid regex %s: %v", r.Regex, err)
+	}
+	r.re = re
+
+	switch r.Action {
+	case Replace:
+		if r.TargetLabel == "" {
+			return fmt.Errorf("replace action requires target_label")
+		}
+		if r.TargetLabel == metricNameLabel {
+			return fmt.Errorf("metric name can't be replaced")
+		}
+		if !model.LabelName(r.TargetLabel).IsValid() {
+			return fmt.Errorf("invalid target_label: %s", r.TargetLabel)
+		}
+	case Keep, Drop:
+		if len(r.SourceLabels) == 0 {
+			return fmt.Errorf("%s action requires source_labels", r.Action)
+		}
+	case LabelDrop, LabelKeep, LabelMap:
+	default:
+		return fmt.Errorf("invalid action: %s", r.Action)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package relabel
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Processor applies the relabeling rules and the series limit to the gathered metrics
+type Processor struct {
+	config    *Config
+	maxSeries int
+	overflow  *prometheus.CounterVec
+}
+
+// NewProcessor returns a processor with the relabeling configuration (can be nil) and the maximum
+// number of series per metric family (0 means no limit), the overflow counter is registered on the registry
+func NewProcessor(config *Config, maxSeries int, reg prometheus.Registerer) (*Processor, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	p := &Processor{
+		config:    config,
+		maxSeries: maxSeries,
+		overflow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "ecs_exporter",
+			Name:      "series_overflow_total",
+			Help:      "The total number of series not exposed because of the maximum number of series per metric family.",
+		}, []string{"family"}),
+	}
+	if err := reg.Register(p.overflow); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Gatherer returns a gatherer that processes the metrics of g
+func (p *Processor) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		return p.process(mfs), err
+	})
+}
+
+// process applies the relabeling rules and the series limit to the metric families
+func (p *Processor) process(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+	res := []*dto.MetricFamily{}
+	for _, mf := range mfs {
+		ms := []*dto.Metric{}
+		seen := map[string]bool{}
+		for _, m := range mf.Metric {
+			if len(p.config.Rules) > 0 && !p.relabel(mf.GetName(), m) {
+				continue
+			}
+
+			// The relabeling can make series equal, only the first one is kept
+			id := seriesID(m)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			ms = append(ms, m)
+		}
+
+		if p.maxSeries > 0 && len(ms) > p.maxSeries {
+			p.overflow.WithLabelValues(mf.GetName()).Add(float64(len(ms) - p.maxSeries))
+			ms = ms[:p.maxSeries]
+		}
+
+		if len(ms) == 0 {
+			continue
+		}
+		mf.Metric = ms
+		res = append(res, mf)
+	}
+	return res
+}
+
+// relabel applies the relabeling rules to the metric labels, returns false if the metric has been dropped
+func (p *Processor) relabel(name string, m *dto.Metric) bool {
+	labels := map[string]string{metricNameLabel: name}
+	for _, l := range m.Label {
+		labels[l.GetName()] = l.GetValue()
+	}
+
+	if !p.config.Process(labels) {
+		return false
+	}
+
+	delete(labels, metricNameLabel)
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	m.Label = make([]*dto.LabelPair, 0, len(names))
+	for _, n := range names {
+		m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(n), Value: proto.String(labels[n])})
+	}
+	return true
+}
+
+// seriesID returns an unique identifier of the metric labels
+func seriesID(m *dto.Metric) string {
+	parts := make([]string, 0, len(m.Label))
+	for _, l := range m.Label {
+		parts = append(parts, l.GetName()+"\xff"+l.GetValue())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\xfe")
+}
@@ -0,0 +1,94 @@
+package relabel
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestProcessorGatherer(t *testing.T) {
+	tests := []struct {
+		rules            []*Rule
+		maxSeries        int
+		expectedSeries   map[string]int
+		expectedOverflow float64
+	}{
+		{nil, 0, map[string]int{"ecs_instance_up": 4, "ecs_services": 2}, 0},
+		{nil, 3, map[string]int{"ecs_instance_up": 3, "ecs_services": 2}, 1},
+		{[]*Rule{&Rule{Regex: "instance", Action: LabelDrop}}, 0, map[string]int{"ecs_instance_up": 2, "ecs_services": 2}, 0},
+		{[]*Rule{&Rule{SourceLabels: []string{"cluster"}, Regex: "c2", Action: Drop}}, 0, map[string]int{"ecs_instance_up": 2, "ecs_services": 1}, 0},
+		{[]*Rule{&Rule{SourceLabels: []string{"__name__"}, Regex: "ecs_services", Action: Drop}}, 1, map[string]int{"ecs_instance_up": 1}, 3},
+	}
+
+	for _, test := range tests {
+		reg := prometheus.NewRegistry()
+		instances := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ecs_instance_up", Help: "test"}, []string{"cluster", "instance"})
+		services := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "ecs_services", Help: "test"}, []string{"cluster"})
+		reg.MustRegister(instances, services)
+		instances.WithLabelValues("c1", "i-1").Set(1)
+		instances.WithLabelValues("c1", "i-2").Set(1)
+		instances.WithLabelValues("c2", "i-3").Set(1)
+		instances.WithLabelValues("c2", "i-4").Set(1)
+		services.WithLabelValues("c1").Set(1)
+		services.WithLabelValues("c2").Set(1)
+
+		for _, r := range test.rules {
+			newTestRule(t, r)
+		}
+		overflowReg := prometheus.NewRegistry()
+		p, err := NewProcessor(&Config{Rules: test.rules}, test.maxSeries, overflowReg)
+		if err != nil {
+			t.Fatalf("Creation of the processor shouldn't error: %v", err)
+		}
+
+		mfs, err := p.Gatherer(reg).Gather()
+		if err != nil {
+			t.Fatalf("\n- %v\n- Gathering shouldn't error: %v", test, err)
+		}
+		got := map[string]int{}
+		for _, mf := range mfs {
+			got[mf.GetName()] = len(mf.Metric)
+		}
+		if len(got) != len(test.expectedSeries) {
+			t.Errorf("\n- %v\n- Families are wrong, want: %v; got: %v", test, test.expectedSeries, got)
+		}
+		for name, n := range test.expectedSeries {
+			if got[name] != n {
+				t.Errorf("\n- %v\n- Series of %s are wrong, want: %d; got: %d", test, name, n, got[name])
+			}
+		}
+
+		// Overflow counter
+		overflow := float64(0)
+		omfs, _ := overflowReg.Gather()
+		for _, mf := range omfs {
+			for _, m := range mf.Metric {
+				overflow += m.GetCounter().GetValue()
+			}
+		}
+		if overflow != test.expectedOverflow {
+			t.Errorf("\n- %v\n- Overflow is wrong, want: %v; got: %v", test, test.expectedOverflow, overflow)
+		}
+	}
+}
+
+func TestRelabelSortsLabels(t *testing.T) {
+	p := &Processor{config: &Config{Rules: []*Rule{newTestRule(t, &Rule{SourceLabels: []string{"b"}, TargetLabel: "a"})}}}
+	m := &dto.Metric{Label: []*dto.LabelPair{}}
+	for _, n := range []string{"b", "c"} {
+		name, value := n, "v"+n
+		m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &value})
+	}
+
+	if !p.relabel("m", m) {
+		t.Fatalf("Metric shouldn't be dropped")
+	}
+	names := []string{}
+	for _, l := range m.Label {
+		names = append(names, l.GetName())
+	}
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" {
+		t.Errorf("Labels should be sorted, got: %v", names)
+	}
+}
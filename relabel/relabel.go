@@ -0,0 +1,74 @@
+package relabel
+
+import (
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Process applies the rules in order to the labels of a series, the labels have the
+// metric name on the __name__ label. Returns false if the series has been dropped
+func (c *Config) Process(labels map[string]string) bool {
+	for _, r := range c.Rules {
+		if !r.process(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// process applies the rule to the labels, returns false if the series has been dropped
+func (r *Rule) process(labels map[string]string) bool {
+	values := make([]string, 0, len(r.SourceLabels))
+	for _, l := range r.SourceLabels {
+		values = append(values, labels[l])
+	}
+	value := strings.Join(values, r.Separator)
+
+	switch r.Action {
+	case Keep:
+		return r.re.MatchString(value)
+	case Drop:
+		return !r.re.MatchString(value)
+	case Replace:
+		idx := r.re.FindStringSubmatchIndex(value)
+		if idx == nil {
+			return true
+		}
+		res := string(r.re.ExpandString(nil, r.Replacement, value, idx))
+		if res == "" {
+			delete(labels, r.TargetLabel)
+		} else {
+			labels[r.TargetLabel] = res
+		}
+	case LabelDrop:
+		for name := range labels {
+			if name != metricNameLabel && r.re.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case LabelKeep:
+		for name := range labels {
+			if name != metricNameLabel && !r.re.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case LabelMap:
+		mapped := map[string]string{}
+		for name, v := range labels {
+			if name == metricNameLabel || !r.re.MatchString(name) {
+				continue
+			}
+			// The replacement can generate invalid label names, they would break the exposition
+			mappedName := r.re.ReplaceAllString(name, r.Replacement)
+			if !model.LabelName(mappedName).IsValid() {
+				continue
+			}
+			mapped[mappedName] = v
+		}
+		for name, v := range mapped {
+			labels[name] = v
+		}
+	}
+	return true
+}
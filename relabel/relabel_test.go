@@ -0,0 +1,181 @@
+package relabel
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestRule(t *testing.T, r *Rule) *Rule {
+	if r.Separator == "" {
+		r.Separator = defaultSeparator
+	}
+	if r.Regex == "" {
+		r.Regex = defaultRegex
+	}
+	if r.Replacement == "" {
+		r.Replacement = defaultReplacement
+	}
+	if r.Action == "" {
+		r.Action = defaultAction
+	}
+	if err := r.compile(); err != nil {
+		t.Fatalf("Rule should be valid: %v", err)
+	}
+	return r
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		rule         *Rule
+		labels       map[string]string
+		expected     map[string]string
+		expectedKeep bool
+	}{
+		{
+			&Rule{SourceLabels: []string{"instance"}, Regex: "i-(.{4}).*", TargetLabel: "instance", Replacement: "i-$1"},
+			map[string]string{"__name__": "m", "instance": "i-0123456789"},
+			map[string]string{"__name__": "m", "instance": "i-0123"},
+			true,
+		},
+		{
+			&Rule{SourceLabels: []string{"cluster", "service"}, Regex: "(.*);(.*)", TargetLabel: "id", Replacement: "$1/$2"},
+			map[string]string{"__name__": "m", "cluster": "c1", "service": "s1"},
+			map[string]string{"__name__": "m", "cluster": "c1", "service": "s1", "id": "c1/s1"},
+			true,
+		},
+		{
+			&Rule{SourceLabels: []string{"cluster"}, Regex: "nomatch", TargetLabel: "cluster", Replacement: "x"},
+			map[string]string{"__name__": "m", "cluster": "c1"},
+			map[string]string{"__name__": "m", "cluster": "c1"},
+			true,
+		},
+		{
+			&Rule{SourceLabels: []string{"cluster"}, Regex: "c1", TargetLabel: "cluster"},
+			map[string]string{"__name__": "m", "cluster": "c1"},
+			map[string]string{"__name__": "m"},
+			true,
+		},
+		{
+			&Rule{SourceLabels: []string{"__name__", "service"}, Regex: "ecs_service_.*;.*-canary", Action: Drop},
+			map[string]string{"__name__": "ecs_service_running_tasks", "service": "api-canary"},
+			nil,
+			false,
+		},
+		{
+			&Rule{SourceLabels: []string{"__name__", "service"}, Regex: "ecs_service_.*;.*-canary", Action: Drop},
+			map[string]string{"__name__": "ecs_service_running_tasks", "service": "api"},
+			map[string]string{"__name__": "ecs_service_running_tasks", "service": "api"},
+			true,
+		},
+		{
+			&Rule{SourceLabels: []string{"cluster"}, Regex: "prod-.*", Action: Keep},
+			map[string]string{"__name__": "m", "cluster": "staging-1"},
+			nil,
+			false,
+		},
+		{
+			&Rule{Regex: "instance", Action: LabelDrop},
+			map[string]string{"__name__": "m", "cluster": "c1", "instance": "i-1"},
+			map[string]string{"__name__": "m", "cluster": "c1"},
+			true,
+		},
+		{
+			&Rule{Regex: "region|cluster", Action: LabelKeep},
+			map[string]string{"__name__": "m", "region": "r1", "cluster": "c1", "instance": "i-1"},
+			map[string]string{"__name__": "m", "region": "r1", "cluster": "c1"},
+			true,
+		},
+		{
+			&Rule{Regex: "aws_(.+)", Action: LabelMap},
+			map[string]string{"__name__": "m", "aws_account": "1111"},
+			map[string]string{"__name__": "m", "aws_account": "1111", "account": "1111"},
+			true,
+		},
+		{
+			&Rule{Regex: "aws_(.+)", Replacement: "aws-$1", Action: LabelMap},
+			map[string]string{"__name__": "m", "aws_account": "1111"},
+			map[string]string{"__name__": "m", "aws_account": "1111"},
+			true,
+		},
+		{
+			&Rule{Regex: "(.+)_id", Replacement: "${1}", Action: LabelMap},
+			map[string]string{"__name__": "m", "1_id": "a", "task_id": "b"},
+			map[string]string{"__name__": "m", "1_id": "a", "task_id": "b", "task": "b"},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		c := &Config{Rules: []*Rule{newTestRule(t, test.rule)}}
+		keep := c.Process(test.labels)
+		if keep != test.expectedKeep {
+			t.Errorf("\n- %v\n- Keep is wrong, want: %t; got: %t", test.rule, test.expectedKeep, keep)
+			continue
+		}
+		if keep && !reflect.DeepEqual(test.labels, test.expected) {
+			t.Errorf("\n- %v\n- Labels are wrong, want: %v; got: %v", test.rule, test.expected, test.labels)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		config      string
+		expectedErr bool
+		expected    []*Rule
+	}{
+		{"", false, nil},
+		{
+			"relabel_configs:\n- source_labels: [instance]\n  target_label: host\n",
+			false,
+			[]*Rule{&Rule{SourceLabels: []string{"instance"}, Separator: ";", Regex: "(.*)", TargetLabel: "host", Replacement: "$1", Action: Replace}},
+		},
+		{
+			"relabel_configs:\n- regex: instance\n  action: labeldrop\n",
+			false,
+			[]*Rule{&Rule{Separator: ";", Regex: "instance", Replacement: "$1", Action: LabelDrop}},
+		},
+		{"relabel_configs:\n- source_labels: [instance]\n", true, nil},
+		{"relabel_configs:\n- source_labels: [instance]\n  target_label: __name__\n", true, nil},
+		{"relabel_configs:\n- source_labels: [instance]\n  target_label: host-name\n", true, nil},
+		{"relabel_configs:\n- source_labels: [instance]\n  target_label: 1host\n", true, nil},
+		{"relabel_configs:\n- action: keep\n", true, nil},
+		{"relabel_configs:\n- action: hashmod\n", true, nil},
+		{"relabel_configs:\n- regex: '['\n  action: labeldrop\n", true, nil},
+		{"unknown: true\n", true, nil},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "ecs-exporter-relabel")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "relabel.yml")
+		if err := ioutil.WriteFile(path, []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := LoadFile(path)
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("\n- %v\n- Loading the config should error, it didn't", test.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("\n- %v\n- Loading the config shouldn't error: %v", test.config, err)
+			continue
+		}
+
+		for _, r := range c.Rules {
+			r.re = nil
+		}
+		if len(c.Rules) != len(test.expected) || (len(c.Rules) > 0 && !reflect.DeepEqual(c.Rules, test.expected)) {
+			t.Errorf("\n- %v\n- Rules are wrong, want: %v; got: %v", test.config, test.expected, c.Rules)
+		}
+	}
+}
@@ -1,15 +1,57 @@
 package types
 
+import (
+	"time"
+)
+
 const (
 	ContainerInstanceStatusActive   = "ACTIVE"
+	ContainerInstanceStatusDraining = "DRAINING"
 	ContainerInstanceStatusInactive = "INACTIVE"
+
+	ServiceStatusActive   = "ACTIVE"
+	ServiceStatusDraining = "DRAINING"
+	ServiceStatusInactive = "INACTIVE"
+
+	DeploymentStatusPrimary  = "PRIMARY"
+	DeploymentStatusActive   = "ACTIVE"
+	DeploymentStatusInactive = "INACTIVE"
+
+	InstanceLifecycleOnDemand = "on-demand"
+
+	AutoScalingLifecycleInService = "InService"
+
+	TargetHealthStateInitial   = "initial"
+	TargetHealthStateHealthy   = "healthy"
+	TargetHealthStateUnhealthy = "unhealthy"
+	TargetHealthStateUnused    = "unused"
+	TargetHealthStateDraining  = "draining"
+
+	CloudWatchCPUUtilization    = "CPUUtilization"
+	CloudWatchMemoryUtilization = "MemoryUtilization"
+	CloudWatchCPUReservation    = "CPUReservation"
+	CloudWatchMemoryReservation = "MemoryReservation"
 )
 
 // ECSService represents a service on an ECS cluster
 type ECSService struct {
-	ID                           string // Service ARN
-	Name                         string // Name of the service
-	DesiredT, PendingT, RunningT int64  // Service task information
+	ID                           string           // Service ARN
+	Name                         string           // Name of the service
+	DesiredT, PendingT, RunningT int64            // Service task information
+	TargetGroups                 []string         // The ARNs of the load balancer target groups of the service
+	TaskDefinition               string           // The ARN of the task definition of the service
+	Status                       string           // The status of the service (ACTIVE, DRAINING or INACTIVE)
+	CreatedAt                    time.Time        // When was the service created
+	Deployments                  []*ECSDeployment // The deployments of the service
+}
+
+// ECSDeployment represents a deployment of a service
+type ECSDeployment struct {
+	ID                           string    // Deployment ID
+	Status                       string    // The status of the deployment (PRIMARY, ACTIVE or INACTIVE)
+	TaskDefinition               string    // The ARN of the task definition of the deployment
+	DesiredT, PendingT, RunningT int64     // Deployment task information
+	CreatedAt                    time.Time // When was the deployment created
 }
 
 // ECSCluster reprensens a cluster on ECS
@@ -24,5 +66,65 @@ type ECSContainerInstance struct {
 	InstanceID string // EC2 instance ID
 	AgentConn  bool   // The state of container instnace agent
 	Active     bool   // The state of the container instance
+	Status     string // The status of the container instance (ACTIVE, DRAINING or INACTIVE)
 	PendingT   int64  // The number of tasks in the container instance with pending state
 }
+
+// EC2Instance represents the EC2 instance of a container instance
+type EC2Instance struct {
+	ID               string    // EC2 instance ID
+	Type             string    // The instance type
+	AvailabilityZone string    // The availability zone of the instance
+	Lifecycle        string    // The lifecycle of the instance (spot, scheduled or on-demand)
+	LaunchTime       time.Time // When the instance was launched
+	PrivateIP        string    // The private IP address of the instance
+}
+
+// AutoScalingGroup represents an Auto Scaling group with container instances
+type AutoScalingGroup struct {
+	ID                                string                 // Auto Scaling group ARN
+	Name                              string                 // Name of the Auto Scaling group
+	DesiredCapacity, MinSize, MaxSize int64                  // Capacity of the Auto Scaling group
+	Instances                         []*AutoScalingInstance // The instances of the Auto Scaling group
+}
+
+// AutoScalingInstance represents an instance of an Auto Scaling group
+type AutoScalingInstance struct {
+	InstanceID     string // EC2 instance ID
+	LifecycleState string // The lifecycle state of the instance on the Auto Scaling group
+}
+
+// ScalableTarget represents the Application Auto Scaling target of the desired count of a service
+type ScalableTarget struct {
+	ResourceID               string // The resource ID of the target (service/<cluster>/<service>)
+	ServiceName              string // Name of the service
+	MinCapacity, MaxCapacity int64  // Bounds of the service desired count
+}
+
+// TargetHealth represents the health of a target of a load balancer target group
+type TargetHealth struct {
+	TargetGroupARN string // The ARN of the target group
+	TargetID       string // The ID of the target (instance ID or IP address)
+	Port           int64  // The port of the target
+	State          string // The health state of the target
+	Reason         string // The reason code of the target health state, if the target is not healthy
+}
+
+// CloudWatchMetric represents a datapoint of a CloudWatch metric of a cluster or service
+type CloudWatchMetric struct {
+	Name        string    // The CloudWatch metric name
+	ServiceName string    // Name of the service, empty for the cluster metrics
+	Value       float64   // The average of the metric on the period
+	Timestamp   time.Time // The start of the period of the datapoint
+}
+
+// ContainerImage represents the image of a container of a task definition
+type ContainerImage struct {
+	TaskDefinition string    // The ARN of the task definition
+	Container      string    // Name of the container
+	Image          string    // The image of the container as set on the task definition
+	Repository     string    // The repository of the image, including the registry
+	Tag            string    // The tag of the image, empty if the image is referenced by digest
+	Digest         string    // The digest of the image, empty if unknown
+	PushedAt       time.Time // When the image was pushed, zero if unknown (only for ECR images)
+}
@@ -0,0 +1,138 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TLS client authentication types
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// Config is the configuration of the exporter web endpoint
+type Config struct {
+	TLSConfig      TLSConfig         `yaml:"tls_server_config"` // The TLS configuration, if empty TLS is disabled
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`  // The bcrypt hashed passwords by user, if empty basic auth is disabled
+}
+
+// TLSConfig is the TLS configuration of the exporter web endpoint
+type TLSConfig struct {
+	CertFile       string `yaml:"cert_file"`        // The server certificate file
+	KeyFile        string `yaml:"key_file"`         // The server key file
+	ClientCAFile   string `yaml:"client_ca_file"`   // The CA file used to verify client certificates for mutual TLS
+	ClientAuthType string `yaml:"client_auth_type"` // The client authentication policy, by default RequireAndVerifyClientCert if client CA is set
+}
+
+// enabled returns true if TLS is configured
+func (t *TLSConfig) enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// files returns the files used by the TLS configuration
+func (t *TLSConfig) files() []string {
+	fs := []string{}
+	for _, f := range []string{t.CertFile, t.KeyFile, t.ClientCAFile} {
+		if f != "" {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// loadConfig reads and validates the web configuration file, the relative TLS
+// files are relative to the configuration file directory
+func loadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("error parsing web config file %s: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for _, f := range []*string{&c.TLSConfig.CertFile, &c.TLSConfig.KeyFile, &c.TLSConfig.ClientCAFile} {
+		if *f != "" && !filepath.IsAbs(*f) {
+			*f = filepath.Join(dir, *f)
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid web config file %s: %v", path, err)
+	}
+
+	return c, nil
+}
+
+// validate checks the configuration is valid
+func (c *Config) validate() error {
+	t := c.TLSConfig
+	if t.enabled() && (t.CertFile == "" || t.KeyFile == "") {
+		return fmt.Errorf("both cert_file and key_file are required for TLS")
+	}
+
+	if !t.enabled() && (t.ClientCAFile != "" || t.ClientAuthType != "") {
+		return fmt.Errorf("client authentication requires TLS")
+	}
+
+	if _, ok := clientAuthTypes[t.ClientAuthType]; t.ClientAuthType != "" && !ok {
+		return fmt.Errorf("invalid client_auth_type: %s", t.ClientAuthType)
+	}
+
+	for user, hash := range c.BasicAuthUsers {
+		if user == "" || hash == "" {
+			return fmt.Errorf("basic auth users require user and hashed password")
+		}
+	}
+
+	return nil
+}
+
+// tlsConfig loads the TLS files and returns the TLS configuration, nil if TLS is not configured
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	t := c.TLSConfig
+	if !t.enabled() {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading TLS certificate: %v", err)
+	}
+
+	tc := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if t.ClientCAFile != "" {
+		b, err := ioutil.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("invalid client CA file: %s", t.ClientCAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if t.ClientAuthType != "" {
+		tc.ClientAuth = clientAuthTypes[t.ClientAuthType]
+	}
+
+	return tc, nil
+}
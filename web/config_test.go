@@ -0,0 +1,71 @@
+package web
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		config         string
+		expectedErr    bool
+		expectedTLS    bool
+		expectedAuth   tls.ClientAuthType
+		expectedUsers  int
+		expectedClient bool
+	}{
+		{"", false, false, tls.NoClientCert, 0, false},
+		{"basic_auth_users:\n  alice: $2a$04$hash\n", false, false, tls.NoClientCert, 1, false},
+		{"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n", false, true, tls.NoClientCert, 0, false},
+		{"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_ca_file: server.crt\n", false, true, tls.RequireAndVerifyClientCert, 0, true},
+		{"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_ca_file: server.crt\n  client_auth_type: VerifyClientCertIfGiven\n", false, true, tls.VerifyClientCertIfGiven, 0, true},
+		{"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_auth_type: Wrong\n", true, false, tls.NoClientCert, 0, false},
+		{"tls_server_config:\n  cert_file: server.crt\n", true, false, tls.NoClientCert, 0, false},
+		{"tls_server_config:\n  client_ca_file: server.crt\n", true, false, tls.NoClientCert, 0, false},
+		{"tls_server_config:\n  cert_file: missing.crt\n  key_file: server.key\n", true, false, tls.NoClientCert, 0, false},
+		{"basic_auth_users:\n  alice: \"\"\n", true, false, tls.NoClientCert, 0, false},
+		{"unknown_field: true\n", true, false, tls.NoClientCert, 0, false},
+	}
+
+	for _, test := range tests {
+		dir := newTestDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "web.yml")
+		if err := ioutil.WriteFile(path, []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := loadConfig(path)
+		var tc *tls.Config
+		if err == nil {
+			tc, err = c.tlsConfig()
+		}
+
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("\n- %v\n- Loading the config should error, it didn't", test)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("\n- %v\n- Loading the config shouldn't error: %v", test, err)
+			continue
+		}
+
+		if (tc != nil) != test.expectedTLS {
+			t.Errorf("\n- %v\n- TLS state is wrong, want: %t; got: %t", test, test.expectedTLS, tc != nil)
+		}
+		if tc != nil && tc.ClientAuth != test.expectedAuth {
+			t.Errorf("\n- %v\n- Client auth is wrong, want: %v; got: %v", test, test.expectedAuth, tc.ClientAuth)
+		}
+		if tc != nil && (tc.ClientCAs != nil) != test.expectedClient {
+			t.Errorf("\n- %v\n- Client CA state is wrong, want: %t; got: %t", test, test.expectedClient, tc.ClientCAs != nil)
+		}
+		if len(c.BasicAuthUsers) != test.expectedUsers {
+			t.Errorf("\n- %v\n- Basic auth users are wrong, want: %d; got: %d", test, test.expectedUsers, len(c.BasicAuthUsers))
+		}
+	}
+}
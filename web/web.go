@@ -0,0 +1,192 @@
+// Package web serves the exporter HTTP endpoints with the optional TLS and basic
+// auth protection set on a web configuration file.
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/slok/ecs-exporter/log"
+)
+
+// configReloader loads the web configuration and reloads it when the configuration
+// file or any of the TLS files change
+type configReloader struct {
+	sync.Mutex
+	path      string
+	config    *Config
+	tlsConfig *tls.Config
+	modTimes  map[string]time.Time
+	authCache map[string]bool // The successful basic auth checks by user and password hash
+}
+
+// newConfigReloader returns an initialized config reloader, the first load needs to be valid
+func newConfigReloader(path string) (*configReloader, error) {
+	r := &configReloader{path: path}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load loads the configuration and the TLS files
+func (r *configReloader) load() error {
+	c, err := loadConfig(r.path)
+	if err != nil {
+		return err
+	}
+
+	tc, err := c.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	r.config = c
+	r.tlsConfig = tc
+	r.modTimes = modTimes(append(c.TLSConfig.files(), r.path))
+	r.authCache = map[string]bool{}
+	return nil
+}
+
+// get returns the current configuration, reloading it if any of the files has changed. If the
+// reload fails the previous configuration is kept
+func (r *configReloader) get() (*Config, *tls.Config) {
+	r.Lock()
+	defer r.Unlock()
+
+	files := []string{}
+	for f := range r.modTimes {
+		files = append(files, f)
+	}
+	current := modTimes(files)
+	changed := false
+	for f, t := range r.modTimes {
+		if !current[f].Equal(t) {
+			changed = true
+			break
+		}
+	}
+
+	if changed {
+		log.Infof("Web config file %s changed, reloading", r.path)
+		if err := r.load(); err != nil {
+			log.Errorf("Error reloading web config, using previous config: %v", err)
+			// Don't retry until the files change again
+			r.modTimes = current
+		}
+	}
+
+	return r.config, r.tlsConfig
+}
+
+// authenticate checks the basic auth credentials, the successful checks are cached
+// as bcrypt is slow by design
+func (r *configReloader) authenticate(c *Config, user, pass string) bool {
+	hash, ok := c.BasicAuthUsers[user]
+	if !ok {
+		// Compare anyway so unknown users take the same time
+		hash = "$2a$10$OrvOXbBizpn6IG3Vek6DLuTriTOJqcQ4zZiOu.jeTCAIZh2ljeYBO"
+	}
+
+	key := fmt.Sprintf("%s:%x:%x", user, sha256.Sum256([]byte(hash)), sha256.Sum256([]byte(pass)))
+	r.Lock()
+	cached := r.authCache[key]
+	r.Unlock()
+	if cached {
+		return true
+	}
+
+	valid := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil && ok
+	if valid {
+		r.Lock()
+		r.authCache[key] = true
+		r.Unlock()
+	}
+	return valid
+}
+
+// modTimes returns the modification time of the files, zero if the file can't be read
+func modTimes(files []string) map[string]time.Time {
+	res := map[string]time.Time{}
+	for _, f := range files {
+		var t time.Time
+		if fi, err := os.Stat(f); err == nil {
+			t = fi.ModTime()
+		}
+		res[f] = t
+	}
+	return res
+}
+
+// basicAuth protects the handler with the basic auth users of the configuration
+func (r *configReloader) basicAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c, _ := r.get()
+		if len(c.BasicAuthUsers) == 0 {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		user, pass, ok := req.BasicAuth()
+		if !ok || !r.authenticate(c, user, pass) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ECS Exporter"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// Serve serves the server handler on the listener using the web configuration file. If the
+// configuration file is empty the handler will be served on plain HTTP without authentication
+func Serve(srv *http.Server, ln net.Listener, configFile string) error {
+	if configFile == "" {
+		return srv.Serve(ln)
+	}
+
+	r, err := newConfigReloader(configFile)
+	if err != nil {
+		return err
+	}
+	h := srv.Handler
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	srv.Handler = r.basicAuth(h)
+
+	_, tc := r.get()
+	if tc == nil {
+		log.Infof("TLS is disabled")
+		return srv.Serve(ln)
+	}
+
+	log.Infof("TLS is enabled")
+	srv.TLSConfig = &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			_, tc := r.get()
+			if tc == nil {
+				return nil, fmt.Errorf("TLS has been disabled on a TLS server, restart is required")
+			}
+			return tc, nil
+		},
+	}
+	return srv.Serve(tls.NewListener(ln, srv.TLSConfig))
+}
+
+// ListenAndServe listens on the server address and serves the server handler using the
+// web configuration file
+func ListenAndServe(srv *http.Server, configFile string) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	return Serve(srv, ln, configFile)
+}
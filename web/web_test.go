@@ -0,0 +1,231 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestDir creates a temporary directory with a self signed server certificate and key
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ecs-exporter-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestCert(t, dir, "server", time.Now())
+	return dir
+}
+
+// writeTestCert writes a self signed certificate for localhost on the directory
+func writeTestCert(t *testing.T, dir, name string, notBefore time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(notBefore.UnixNano()),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             notBefore.Add(-time.Hour),
+		NotAfter:              notBefore.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	k := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".crt"), crt, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), k, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config       string
+		user         string
+		pass         string
+		expectedCode int
+	}{
+		{"", "", "", http.StatusOK},
+		{"basic_auth_users:\n  alice: " + string(hash) + "\n", "alice", "secret", http.StatusOK},
+		{"basic_auth_users:\n  alice: " + string(hash) + "\n", "alice", "wrong", http.StatusUnauthorized},
+		{"basic_auth_users:\n  alice: " + string(hash) + "\n", "bob", "secret", http.StatusUnauthorized},
+		{"basic_auth_users:\n  alice: " + string(hash) + "\n", "", "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		dir := newTestDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "web.yml")
+		if err := ioutil.WriteFile(path, []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := newConfigReloader(path)
+		if err != nil {
+			t.Fatalf("\n- %v\n- Loading the config shouldn't error: %v", test, err)
+		}
+		h := r.basicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		// Twice to check the cached checks
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest("GET", "/metrics", nil)
+			if test.user != "" {
+				req.SetBasicAuth(test.user, test.pass)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != test.expectedCode {
+				t.Errorf("\n- %v\n- Status code is wrong, want: %d; got: %d", test, test.expectedCode, w.Code)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("\n- %v\n- Unauthorized responses should have the authenticate header", test)
+			}
+		}
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "web.yml")
+	if err := ioutil.WriteFile(path, []byte("tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := newConfigReloader(path)
+	if err != nil {
+		t.Fatalf("Loading the config shouldn't error: %v", err)
+	}
+	_, tc := r.get()
+	first := tc.Certificates[0].Certificate[0]
+
+	// Rotate the certificate
+	later := time.Now().Add(time.Minute)
+	writeTestCert(t, dir, "server", later)
+	for _, f := range []string{"server.crt", "server.key"} {
+		os.Chtimes(filepath.Join(dir, f), later, later)
+	}
+	_, tc = r.get()
+	if string(tc.Certificates[0].Certificate[0]) == string(first) {
+		t.Errorf("Certificate should be reloaded after it changed, it wasn't")
+	}
+	rotated := tc.Certificates[0].Certificate[0]
+
+	// Invalid configuration keeps the previous one
+	if err := ioutil.WriteFile(path, []byte("tls_server_config:\n  cert_file: missing.crt\n  key_file: server.key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Minute)
+	os.Chtimes(path, later, later)
+	_, tc = r.get()
+	if tc == nil || string(tc.Certificates[0].Certificate[0]) != string(rotated) {
+		t.Errorf("Invalid config should keep the previous config, it didn't")
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	writeTestCert(t, dir, "client", time.Now())
+	path := filepath.Join(dir, "web.yml")
+	config := "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_ca_file: client.crt\n" +
+		"basic_auth_users:\n  alice: " + string(hash) + "\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go Serve(srv, ln, path)
+	defer srv.Close()
+
+	serverCA, _ := ioutil.ReadFile(filepath.Join(dir, "server.crt"))
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(serverCA)
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		withClientCert bool
+		withAuth       bool
+		expectedErr    bool
+		expectedCode   int
+	}{
+		{true, true, false, http.StatusOK},
+		{true, false, false, http.StatusUnauthorized},
+		{false, true, true, 0},
+	}
+
+	for _, test := range tests {
+		tc := &tls.Config{RootCAs: pool}
+		if test.withClientCert {
+			tc.Certificates = []tls.Certificate{clientCert}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}
+		req, _ := http.NewRequest("GET", "https://"+ln.Addr().String()+"/metrics", nil)
+		if test.withAuth {
+			req.SetBasicAuth("alice", "secret")
+		}
+
+		resp, err := c.Do(req)
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("\n- %v\n- Request should error, it didn't", test)
+				resp.Body.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("\n- %v\n- Request shouldn't error: %v", test, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.expectedCode {
+			t.Errorf("\n- %v\n- Status code is wrong, want: %d; got: %d", test, test.expectedCode, resp.StatusCode)
+		}
+	}
+}